@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/forwarder"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/logging"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/rabbitmq"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/restapi"
+)
+
+// rmq-rest-forwarder consumes the request queue filled by win-sound-scanner and replays
+// every message as a POST/PUT call against the device repository REST API.
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx); err != nil {
+		log.Fatalf("exit with error: %v", err)
+	}
+}
+
+func run(ctx context.Context) error {
+	logger := logging.NewAppLogger()
+
+	rabbitCfg, err := rabbitmq.LoadConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	restCfg, err := restapi.LoadConfigFromEnv()
+	if err != nil {
+		return err
+	}
+
+	logging.PrintInfo(logger, "Forwarding queue %s to %s", rabbitCfg.QueueName, restCfg.BaseURL)
+
+	fwd := forwarder.NewForwarder(restapi.NewClient(restCfg, logger), logger)
+	consumer := rabbitmq.NewRequestConsumer(rabbitCfg, logger)
+	if err := consumer.Consume(ctx, fwd.Run); err != nil {
+		return err
+	}
+
+	logging.PrintInfo(logger, "Shutting down...")
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+
+package main
+
+// COM only exists on Windows; the simulated device source does not need it.
+const COINIT_MULTITHREADED = 0x0
+
+func CoInitializeEx(_ uintptr) error {
+	return nil
+}
+
+func CoUninitialize() {}
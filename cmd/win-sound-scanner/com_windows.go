@@ -0,0 +1,35 @@
+//go:build windows
+
+package main
+
+import (
+	"syscall"
+)
+
+var (
+	modOle32           = syscall.NewLazyDLL("ole32.dll")
+	procCoInitializeEx = modOle32.NewProc("CoInitializeEx")
+	procCoUninitialize = modOle32.NewProc("CoUninitialize")
+)
+
+//goland:noinspection ALL
+const (
+	COINIT_APARTMENTTHREADED = 0x2 // Single-threaded apartment
+	COINIT_MULTITHREADED     = 0x0 // Multithreaded apartment
+)
+
+// suppress unused
+var _ = COINIT_APARTMENTTHREADED
+var _ = COINIT_MULTITHREADED
+
+func CoInitializeEx(coInit uintptr) error {
+	ret, _, _ := procCoInitializeEx.Call(0, coInit)
+	if ret != 0 {
+		return syscall.Errno(ret)
+	}
+	return nil
+}
+
+func CoUninitialize() {
+	procCoUninitialize.Call() // best-effort cleanup; failure is ignored
+}
@@ -11,8 +11,14 @@ import (
 func main() {
 	if len(os.Args) > 1 {
 		cmd := strings.ToLower(strings.TrimSpace(os.Args[1]))
+		if cmd == "schema" {
+			if err := runSchema(os.Args[2:]); err != nil {
+				log.Fatalf("schema generation failed: %v", err)
+			}
+			return
+		}
 		if !isServiceCommand(cmd) {
-			log.Fatalf("unsupported command %q (supported: install, uninstall, start, stop, restart)", cmd)
+			log.Fatalf("unsupported command %q (supported: install, uninstall, start, stop, restart, schema)", cmd)
 		}
 
 		svc, err := newService()
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/schema"
+)
+
+// runSchema writes the JSON Schema and AsyncAPI documents of the published messages.
+func runSchema(args []string) error {
+	flags := flag.NewFlagSet("schema", flag.ContinueOnError)
+	out := flags.String("out", schema.DefaultDir, "directory to write the documents to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v", flags.Args())
+	}
+	return schema.Write(*out)
+}
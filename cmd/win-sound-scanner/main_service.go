@@ -24,6 +24,14 @@ const (
 
 var serviceEnvKeys = []string{
 	scannerapp.EnvWinSoundEnqueuer,
+	scannerapp.EnvWinSoundSource,
+	scannerapp.EnvWinSoundSimulatedScenario,
+	scannerapp.EnvWinSoundEndpoints,
+	scannerapp.EnvWinSoundVolumeQuietPeriod,
+	scannerapp.EnvWinSoundVolumeMaxLatency,
+	scannerapp.EnvWinSoundVolumeRange,
+	scannerapp.EnvWinSoundResyncInterval,
+	scannerapp.EnvWinSoundRabbitMQURL,
 	scannerapp.EnvWinSoundRabbitMQHost,
 	scannerapp.EnvWinSoundRabbitMQPort,
 	scannerapp.EnvWinSoundRabbitMQVHost,
@@ -32,6 +40,42 @@ var serviceEnvKeys = []string{
 	scannerapp.EnvWinSoundRabbitMQExchange,
 	scannerapp.EnvWinSoundRabbitMQQueue,
 	scannerapp.EnvWinSoundRabbitMQRoutingKey,
+	scannerapp.EnvWinSoundRabbitMQRoutingKeyTemplate,
+	scannerapp.EnvWinSoundRabbitMQBodyFormat,
+	scannerapp.EnvWinSoundRabbitMQTopology,
+	scannerapp.EnvWinSoundRabbitMQExchangeType,
+	scannerapp.EnvWinSoundRabbitMQQueueType,
+	scannerapp.EnvWinSoundRabbitMQMessageTTL,
+	scannerapp.EnvWinSoundRabbitMQQueueMaxLength,
+	scannerapp.EnvWinSoundRabbitMQQueueOverflow,
+	scannerapp.EnvWinSoundRabbitMQDeadLetterExchange,
+	scannerapp.EnvWinSoundRabbitMQDeadLetterRoutingKey,
+	scannerapp.EnvWinSoundRabbitMQAlternateExchange,
+	scannerapp.EnvWinSoundRabbitMQStartup,
+	scannerapp.EnvWinSoundRabbitMQMaxInFlight,
+	scannerapp.EnvWinSoundRabbitMQHosts,
+	scannerapp.EnvWinSoundRabbitMQHostSelection,
+	scannerapp.EnvWinSoundRabbitMQHostQuarantine,
+	scannerapp.EnvWinSoundRabbitMQTLS,
+	scannerapp.EnvWinSoundRabbitMQTLSCAFile,
+	scannerapp.EnvWinSoundRabbitMQTLSCertFile,
+	scannerapp.EnvWinSoundRabbitMQTLSKeyFile,
+	scannerapp.EnvWinSoundRabbitMQTLSServerName,
+	scannerapp.EnvWinSoundRabbitMQTLSInsecureSkipVerify,
+	scannerapp.EnvWinSoundRabbitMQAuth,
+	scannerapp.EnvWinSoundQueueCapacity,
+	scannerapp.EnvWinSoundQueueOverflow,
+	scannerapp.EnvWinSoundQueueDrainTimeout,
+	scannerapp.EnvWinSoundOutbox,
+	scannerapp.EnvWinSoundOutboxDir,
+	scannerapp.EnvWinSoundOutboxMaxMB,
+	scannerapp.EnvWinSoundOutboxMaxAgeHours,
+	scannerapp.EnvWinSoundHTTPBaseURL,
+	scannerapp.EnvWinSoundHTTPBearerToken,
+	scannerapp.EnvWinSoundHTTPUser,
+	scannerapp.EnvWinSoundHTTPPassword,
+	scannerapp.EnvWinSoundHTTPTimeout,
+	scannerapp.EnvWinSoundHTTPMaxAttempts,
 }
 
 type scannerProgram struct {
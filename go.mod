@@ -6,6 +6,7 @@ require (
 	github.com/collect-sound-devices/sound-win-scanner/v4 v4.0.5-rc.21
 	github.com/kardianos/service v1.2.4
 	github.com/rabbitmq/amqp091-go v1.10.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require golang.org/x/sys v0.34.0 // indirect
@@ -0,0 +1,53 @@
+package contract
+
+// FieldDescriptions documents the message fields for the generated JSON Schema and AsyncAPI documents.
+// The generator fails on a field without an entry, so a new field can not be published undocumented.
+// Fields of the envelope source are keyed as "source.<name>".
+var FieldDescriptions = map[string]string{
+	FieldDeviceMessageType:   "Kind of change: 0 confirmed, 1 discovered, 2 detached, 3/4 render/capture volume, 5/6 default render/capture, 7/8 render/capture mute.",
+	FieldUpdateDate:          "When the scanner observed the state, UTC, RFC 3339 with seconds.",
+	FieldFlowType:            "Data flow of the endpoint: 1 render (playback), 2 capture (recording).",
+	FieldName:                "Friendly name of the endpoint.",
+	FieldPnpID:               "Plug and Play ID of the endpoint.",
+	FieldPreviousPnpID:       "Plug and Play ID of the endpoint that was the default before.",
+	FieldRenderVolume:        "Render volume of the endpoint, 0 to 1000.",
+	FieldCaptureVolume:       "Capture volume of the endpoint, 0 to 1000.",
+	FieldVolume:              "New volume, 0 to 1000.",
+	FieldVolumeMin:           "Lowest volume seen while volume changes were coalesced, 0 to 1000.",
+	FieldVolumeMax:           "Highest volume seen while volume changes were coalesced, 0 to 1000.",
+	FieldRenderMuted:         "Whether render is muted; only sent when the device source reports mute state.",
+	FieldCaptureMuted:        "Whether capture is muted; only sent when the device source reports mute state.",
+	FieldMuted:               "New mute state.",
+	FieldHostName:            "Name of the computer the scanner runs on.",
+	FieldOperationSystemName: "Name and version of the operating system.",
+	FieldHTTPRequest:         "Method of the device repository API call the message stands for.",
+	FieldURLSuffix:           "Path of the API call below the base URL; /<pnpId>/<hostName> for PUT, empty for POST.",
+	FieldIsDefault:           "Whether the endpoint is the default of its flow.",
+
+	FieldSchemaVersion: "Version of the message body: 1 for the flat body, 2 for the envelope.",
+	FieldEventID:       "ID of the event, equal to the AMQP message ID; the same for every retry.",
+	FieldEventType:     "Name of the event type.",
+	FieldOccurredAt:    "When the scanner saw the event, UTC.",
+	FieldPublishedAt:   "When the message was published, UTC; later than occurredAt if it waited in the outbox.",
+	FieldSource:        "The scanner that published the event.",
+	FieldPayload:       "The flat body of the event.",
+	"source.host":      "Name of the computer the scanner runs on.",
+	"source.app":       "Application name of the scanner.",
+	"source.version":   "Version of the scanner.",
+}
+
+// EventDescriptions documents the event types for the generated documents.
+var EventDescriptions = map[EventType]string{
+	EventTypeRenderDeviceConfirmed:   "Full state of the default render endpoint, posted at startup and on resync.",
+	EventTypeCaptureDeviceConfirmed:  "Full state of the default capture endpoint, posted at startup and on resync.",
+	EventTypeRenderDeviceDiscovered:  "Full state of a render endpoint that became the default or was plugged in.",
+	EventTypeCaptureDeviceDiscovered: "Full state of a capture endpoint that became the default or was plugged in.",
+	EventTypeRenderVolumeChanged:     "The volume of a render endpoint changed.",
+	EventTypeCaptureVolumeChanged:    "The volume of a capture endpoint changed.",
+	EventTypeRenderDeviceDetached:    "A render endpoint was removed.",
+	EventTypeCaptureDeviceDetached:   "A capture endpoint was removed.",
+	EventTypeDefaultRenderChanged:    "The default render endpoint switched to another device.",
+	EventTypeDefaultCaptureChanged:   "The default capture endpoint switched to another device.",
+	EventTypeRenderMuteChanged:       "A render endpoint was muted or unmuted.",
+	EventTypeCaptureMuteChanged:      "A capture endpoint was muted or unmuted.",
+}
@@ -0,0 +1,53 @@
+package contract
+
+import "time"
+
+const (
+	// SchemaVersionFlat is the flat body: the REST payload with the httpRequest and urlSuffix fields.
+	SchemaVersionFlat = 1
+	// SchemaVersionEnvelope is the Envelope body.
+	SchemaVersionEnvelope = 2
+)
+
+const (
+	FieldSchemaVersion = "schemaVersion"
+	FieldEventID       = "eventId"
+	FieldEventType     = "eventType"
+	FieldOccurredAt    = "occurredAt"
+	FieldPublishedAt   = "publishedAt"
+	FieldSource        = "source"
+	FieldPayload       = "payload"
+)
+
+// Envelope is the versioned message body: the event metadata around the flat body, which is kept as Payload.
+type Envelope struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	EventID       string `json:"eventId"`
+	// EventType is the EventType name, e.g. "RenderVolumeChanged".
+	EventType string `json:"eventType"`
+	// OccurredAt is when the scanner saw the event; PublishedAt when it was sent, later if it waited in the outbox.
+	OccurredAt  time.Time      `json:"occurredAt"`
+	PublishedAt time.Time      `json:"publishedAt"`
+	Source      Source         `json:"source"`
+	Payload     map[string]any `json:"payload"`
+}
+
+// Source identifies the scanner that published an event.
+type Source struct {
+	Host    string `json:"host,omitempty"`
+	App     string `json:"app"`
+	Version string `json:"version"`
+}
+
+// Fields returns the envelope as top-level body fields, for a body that carries the flat fields alongside.
+func (e Envelope) Fields() map[string]any {
+	return map[string]any{
+		FieldSchemaVersion: e.SchemaVersion,
+		FieldEventID:       e.EventID,
+		FieldEventType:     e.EventType,
+		FieldOccurredAt:    e.OccurredAt,
+		FieldPublishedAt:   e.PublishedAt,
+		FieldSource:        e.Source,
+		FieldPayload:       e.Payload,
+	}
+}
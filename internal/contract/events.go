@@ -0,0 +1,360 @@
+package contract
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// MaxVolume is the top of the volume scale: the sound library reports the master volume scalar times 1000.
+const MaxVolume = 1000
+
+// Event is the typed content of a request; every event kind has its own struct.
+// Values is the conversion to the wire format, Fields the string form kept in the outbox.
+type Event interface {
+	// Ref names the device the event is about.
+	Ref() DeviceRef
+	// Values returns the body fields with their JSON types, keyed by the Field* names.
+	Values() map[string]any
+	// Validate reports missing or out of range fields.
+	Validate() error
+}
+
+// DeviceRef identifies the endpoint an event is about.
+type DeviceRef struct {
+	HostName string
+	PnpID    string
+}
+
+func (r DeviceRef) Ref() DeviceRef {
+	return r
+}
+
+// DeviceSnapshot is the full state of an endpoint, posted when it is discovered or confirmed.
+type DeviceSnapshot struct {
+	DeviceRef
+	UpdateDate          time.Time
+	Name                string
+	RenderVolume        int
+	CaptureVolume       int
+	OperationSystemName string
+	IsDefault           bool
+	// RenderMuted and CaptureMuted are nil when the device source does not report mute state.
+	RenderMuted  *bool
+	CaptureMuted *bool
+}
+
+// VolumeChange is the new volume of an endpoint.
+type VolumeChange struct {
+	DeviceRef
+	UpdateDate time.Time
+	Volume     int
+	// VolumeMin and VolumeMax are the range a coalesced volume moved through; nil unless reported.
+	VolumeMin *int
+	VolumeMax *int
+}
+
+// MuteChange is the new mute state of an endpoint.
+type MuteChange struct {
+	DeviceRef
+	UpdateDate time.Time
+	Muted      bool
+}
+
+// DeviceDetached reports that an endpoint was removed.
+type DeviceDetached struct {
+	DeviceRef
+	UpdateDate time.Time
+	IsDefault  bool
+}
+
+// DefaultChange reports that the default endpoint of a flow switched from PreviousPnpID to PnpID.
+type DefaultChange struct {
+	DeviceRef
+	UpdateDate    time.Time
+	PreviousPnpID string
+}
+
+func (e DeviceSnapshot) Values() map[string]any {
+	values := map[string]any{
+		FieldName:                e.Name,
+		FieldPnpID:               e.PnpID,
+		FieldRenderVolume:        e.RenderVolume,
+		FieldCaptureVolume:       e.CaptureVolume,
+		FieldOperationSystemName: e.OperationSystemName,
+		FieldHostName:            e.HostName,
+		FieldIsDefault:           e.IsDefault,
+	}
+	setDate(values, e.UpdateDate)
+	if e.RenderMuted != nil {
+		values[FieldRenderMuted] = *e.RenderMuted
+	}
+	if e.CaptureMuted != nil {
+		values[FieldCaptureMuted] = *e.CaptureMuted
+	}
+	return values
+}
+
+func (e DeviceSnapshot) Validate() error {
+	if err := e.require(FieldPnpID); err != nil {
+		return err
+	}
+	if err := checkVolume(FieldRenderVolume, e.RenderVolume); err != nil {
+		return err
+	}
+	return checkVolume(FieldCaptureVolume, e.CaptureVolume)
+}
+
+func (e VolumeChange) Values() map[string]any {
+	values := map[string]any{
+		FieldVolume:   e.Volume,
+		FieldHostName: e.HostName,
+	}
+	setDate(values, e.UpdateDate)
+	setPnpID(values, e.PnpID)
+	if e.VolumeMin != nil {
+		values[FieldVolumeMin] = *e.VolumeMin
+	}
+	if e.VolumeMax != nil {
+		values[FieldVolumeMax] = *e.VolumeMax
+	}
+	return values
+}
+
+func (e VolumeChange) Validate() error {
+	if err := e.require(); err != nil {
+		return err
+	}
+	if err := checkVolume(FieldVolume, e.Volume); err != nil {
+		return err
+	}
+	if (e.VolumeMin == nil) != (e.VolumeMax == nil) {
+		return fmt.Errorf("%s and %s must be set together", FieldVolumeMin, FieldVolumeMax)
+	}
+	return nil
+}
+
+func (e MuteChange) Values() map[string]any {
+	values := map[string]any{
+		FieldMuted:    e.Muted,
+		FieldHostName: e.HostName,
+	}
+	setDate(values, e.UpdateDate)
+	setPnpID(values, e.PnpID)
+	return values
+}
+
+func (e MuteChange) Validate() error {
+	return e.require()
+}
+
+func (e DeviceDetached) Values() map[string]any {
+	values := map[string]any{
+		FieldPnpID:     e.PnpID,
+		FieldHostName:  e.HostName,
+		FieldIsDefault: e.IsDefault,
+	}
+	setDate(values, e.UpdateDate)
+	return values
+}
+
+func (e DeviceDetached) Validate() error {
+	return e.require(FieldPnpID)
+}
+
+func (e DefaultChange) Values() map[string]any {
+	values := map[string]any{
+		FieldPnpID:         e.PnpID,
+		FieldPreviousPnpID: e.PreviousPnpID,
+		FieldHostName:      e.HostName,
+	}
+	setDate(values, e.UpdateDate)
+	return values
+}
+
+func (e DefaultChange) Validate() error {
+	if err := e.require(FieldPnpID); err != nil {
+		return err
+	}
+	if e.PreviousPnpID == "" {
+		return fmt.Errorf("missing %s", FieldPreviousPnpID)
+	}
+	return nil
+}
+
+// require reports a missing host name, and a missing PnP ID if FieldPnpID is listed.
+// Volume and mute changes may be reported before the device is known, so their PnP ID is optional.
+func (r DeviceRef) require(fields ...string) error {
+	if r.HostName == "" {
+		return fmt.Errorf("missing %s", FieldHostName)
+	}
+	for _, field := range fields {
+		if field == FieldPnpID && r.PnpID == "" {
+			return fmt.Errorf("missing %s", FieldPnpID)
+		}
+	}
+	return nil
+}
+
+func checkVolume(field string, volume int) error {
+	if volume < 0 || volume > MaxVolume {
+		return fmt.Errorf("%s %d is outside 0 .. %d", field, volume, MaxVolume)
+	}
+	return nil
+}
+
+func setDate(values map[string]any, date time.Time) {
+	if !date.IsZero() {
+		values[FieldUpdateDate] = date.UTC().Format(time.RFC3339)
+	}
+}
+
+func setPnpID(values map[string]any, pnpID string) {
+	if pnpID != "" {
+		values[FieldPnpID] = pnpID
+	}
+}
+
+// Fields returns the values of e as strings, as kept in the outbox and compared for duplicate suppression.
+func Fields(e Event) map[string]string {
+	if e == nil {
+		return nil
+	}
+	values := e.Values()
+	fields := make(map[string]string, len(values))
+	for key, value := range values {
+		switch v := value.(type) {
+		case string:
+			fields[key] = v
+		case int:
+			fields[key] = strconv.Itoa(v)
+		case bool:
+			fields[key] = strconv.FormatBool(v)
+		default:
+			fields[key] = fmt.Sprint(v)
+		}
+	}
+	return fields
+}
+
+// Fits reports whether e is the struct of the event type's kind.
+func Fits(event EventType, e Event) bool {
+	switch e.(type) {
+	case DeviceSnapshot:
+		return event == EventTypeRenderDeviceConfirmed || event == EventTypeCaptureDeviceConfirmed ||
+			event == EventTypeRenderDeviceDiscovered || event == EventTypeCaptureDeviceDiscovered
+	case VolumeChange:
+		return event == EventTypeRenderVolumeChanged || event == EventTypeCaptureVolumeChanged
+	case MuteChange:
+		return event == EventTypeRenderMuteChanged || event == EventTypeCaptureMuteChanged
+	case DeviceDetached:
+		return event == EventTypeRenderDeviceDetached || event == EventTypeCaptureDeviceDetached
+	case DefaultChange:
+		return event == EventTypeDefaultRenderChanged || event == EventTypeDefaultCaptureChanged
+	default:
+		return false
+	}
+}
+
+// ParseEvent reads the string fields of an event of the given type back into its struct, e.g. from the outbox.
+// It only converts and does not Validate: a stored event was valid when it was accepted, and a later,
+// stricter rule must not drop it.
+func ParseEvent(event EventType, fields map[string]string) (Event, error) {
+	r := fieldReader{fields: fields}
+	ref := DeviceRef{HostName: fields[FieldHostName], PnpID: fields[FieldPnpID]}
+
+	var e Event
+	switch event {
+	case EventTypeRenderDeviceConfirmed, EventTypeCaptureDeviceConfirmed, EventTypeRenderDeviceDiscovered, EventTypeCaptureDeviceDiscovered:
+		e = DeviceSnapshot{
+			DeviceRef:           ref,
+			UpdateDate:          r.date(),
+			Name:                fields[FieldName],
+			RenderVolume:        r.integer(FieldRenderVolume),
+			CaptureVolume:       r.integer(FieldCaptureVolume),
+			OperationSystemName: fields[FieldOperationSystemName],
+			IsDefault:           r.flag(FieldIsDefault),
+			RenderMuted:         r.optionalBoolean(FieldRenderMuted),
+			CaptureMuted:        r.optionalBoolean(FieldCaptureMuted),
+		}
+	case EventTypeRenderVolumeChanged, EventTypeCaptureVolumeChanged:
+		e = VolumeChange{
+			DeviceRef:  ref,
+			UpdateDate: r.date(),
+			Volume:     r.integer(FieldVolume),
+			VolumeMin:  r.optionalInteger(FieldVolumeMin),
+			VolumeMax:  r.optionalInteger(FieldVolumeMax),
+		}
+	case EventTypeRenderMuteChanged, EventTypeCaptureMuteChanged:
+		e = MuteChange{DeviceRef: ref, UpdateDate: r.date(), Muted: r.boolean(FieldMuted)}
+	case EventTypeRenderDeviceDetached, EventTypeCaptureDeviceDetached:
+		e = DeviceDetached{DeviceRef: ref, UpdateDate: r.date(), IsDefault: r.flag(FieldIsDefault)}
+	case EventTypeDefaultRenderChanged, EventTypeDefaultCaptureChanged:
+		e = DefaultChange{DeviceRef: ref, UpdateDate: r.date(), PreviousPnpID: fields[FieldPreviousPnpID]}
+	default:
+		return nil, fmt.Errorf("unknown event type %d", event)
+	}
+
+	if r.err != nil {
+		return nil, fmt.Errorf("%s: %w", event, r.err)
+	}
+	return e, nil
+}
+
+// fieldReader converts string fields, keeping the first error.
+type fieldReader struct {
+	fields map[string]string
+	err    error
+}
+
+func (r *fieldReader) date() time.Time {
+	v, ok := r.fields[FieldUpdateDate]
+	if !ok {
+		return time.Time{}
+	}
+	date, err := time.Parse(time.RFC3339, v)
+	r.fail(FieldUpdateDate, v, err)
+	return date
+}
+
+func (r *fieldReader) integer(key string) int {
+	n, err := strconv.Atoi(r.fields[key])
+	r.fail(key, r.fields[key], err)
+	return n
+}
+
+func (r *fieldReader) optionalInteger(key string) *int {
+	if _, ok := r.fields[key]; !ok {
+		return nil
+	}
+	n := r.integer(key)
+	return &n
+}
+
+func (r *fieldReader) boolean(key string) bool {
+	b, err := strconv.ParseBool(r.fields[key])
+	r.fail(key, r.fields[key], err)
+	return b
+}
+
+// flag reads a boolean that events stored before the field existed lack; missing means false.
+func (r *fieldReader) flag(key string) bool {
+	if _, ok := r.fields[key]; !ok {
+		return false
+	}
+	return r.boolean(key)
+}
+
+func (r *fieldReader) optionalBoolean(key string) *bool {
+	if _, ok := r.fields[key]; !ok {
+		return nil
+	}
+	b := r.boolean(key)
+	return &b
+}
+
+func (r *fieldReader) fail(key, value string, err error) {
+	if err != nil && r.err == nil {
+		r.err = fmt.Errorf("invalid %s %q", key, value)
+	}
+}
@@ -10,18 +10,50 @@ const (
 	EventTypeCaptureDeviceDiscovered
 	EventTypeRenderVolumeChanged
 	EventTypeCaptureVolumeChanged
+	EventTypeRenderDeviceDetached
+	EventTypeCaptureDeviceDetached
+	EventTypeDefaultRenderChanged
+	EventTypeDefaultCaptureChanged
+	EventTypeRenderMuteChanged
+	EventTypeCaptureMuteChanged
 )
 
+var eventTypeNames = [...]string{
+	EventTypeNothing:                 "Nothing",
+	EventTypeRenderDeviceConfirmed:   "RenderDeviceConfirmed",
+	EventTypeCaptureDeviceConfirmed:  "CaptureDeviceConfirmed",
+	EventTypeRenderDeviceDiscovered:  "RenderDeviceDiscovered",
+	EventTypeCaptureDeviceDiscovered: "CaptureDeviceDiscovered",
+	EventTypeRenderVolumeChanged:     "RenderVolumeChanged",
+	EventTypeCaptureVolumeChanged:    "CaptureVolumeChanged",
+	EventTypeRenderDeviceDetached:    "RenderDeviceDetached",
+	EventTypeCaptureDeviceDetached:   "CaptureDeviceDetached",
+	EventTypeDefaultRenderChanged:    "DefaultRenderChanged",
+	EventTypeDefaultCaptureChanged:   "DefaultCaptureChanged",
+	EventTypeRenderMuteChanged:       "RenderMuteChanged",
+	EventTypeCaptureMuteChanged:      "CaptureMuteChanged",
+}
+
+// String returns the event name, e.g. "RenderVolumeChanged".
+func (e EventType) String() string {
+	if int(e) < len(eventTypeNames) {
+		return eventTypeNames[e]
+	}
+	return "Unknown"
+}
+
 type MessageType uint8
 
 const (
-	MessageTypeConfirmed  = 0
-	MessageTypeDiscovered = 1
-	//	MessageTypeDetached                          = 2
+	MessageTypeConfirmed                         = 0
+	MessageTypeDiscovered                        = 1
+	MessageTypeDetached              MessageType = 2
 	MessageTypeVolumeRenderChanged   MessageType = 3
 	MessageTypeVolumeCaptureChanged  MessageType = 4
 	MessageTypeDefaultRenderChanged  MessageType = 5
 	MessageTypeDefaultCaptureChanged MessageType = 6
+	MessageTypeMuteRenderChanged     MessageType = 7
+	MessageTypeMuteCaptureChanged    MessageType = 8
 )
 
 type FlowType uint8
@@ -37,11 +69,18 @@ const (
 	FieldFlowType            = "flowType"
 	FieldName                = "name"
 	FieldPnpID               = "pnpId"
+	FieldPreviousPnpID       = "previousPnpId"
 	FieldRenderVolume        = "renderVolume"
 	FieldCaptureVolume       = "captureVolume"
 	FieldVolume              = "volume"
+	FieldVolumeMin           = "volumeMin"
+	FieldVolumeMax           = "volumeMax"
+	FieldRenderMuted         = "renderMuted"
+	FieldCaptureMuted        = "captureMuted"
+	FieldMuted               = "muted"
 	FieldHostName            = "hostName"
 	FieldOperationSystemName = "operationSystemName"
 	FieldHTTPRequest         = "httpRequest"
 	FieldURLSuffix           = "urlSuffix"
+	FieldIsDefault           = "isDefault"
 )
@@ -0,0 +1,85 @@
+package devicesource
+
+import (
+	"sort"
+	"strings"
+)
+
+// noPlugAndPlayContainer is the container ID Windows assigns to endpoints without a Plug and Play device.
+const noPlugAndPlayContainer = "00000000-0000-0000-FFFF-FFFFFFFFFFFF"
+
+// endpointPnpID derives the PnP ID the sound library reports for an endpoint: its container ID,
+// or for endpoints without one the endpoint ID cut to 79 characters, without braces, in upper case.
+// Enumerated endpoints must carry the same ID as the default devices, or they would be reported twice.
+func endpointPnpID(containerID, endpointID string) string {
+	if containerID != "" && !strings.EqualFold(containerID, noPlugAndPlayContainer) {
+		return strings.ToUpper(strings.Trim(containerID, "{}"))
+	}
+	id := endpointID
+	if len(id) > 79 {
+		id = id[:79]
+	}
+	id = strings.NewReplacer("{", "", "}", "").Replace(id)
+	return strings.ToUpper(id)
+}
+
+// mergeEndpoints folds the endpoints sharing a PnP ID into one description, as the sound library does
+// for e.g. the speaker and microphone of one headset: the flows and volumes are combined and the
+// distinct names are joined by "/" in sorted order. The result is sorted by PnP ID.
+func mergeEndpoints(endpoints []Description) []Description {
+	byID := make(map[string]*Description, len(endpoints))
+	names := make(map[string]map[string]bool, len(endpoints))
+	for _, ep := range endpoints {
+		merged, ok := byID[ep.PnpID]
+		if !ok {
+			ep := ep
+			byID[ep.PnpID] = &ep
+			names[ep.PnpID] = map[string]bool{ep.Name: true}
+			continue
+		}
+		names[ep.PnpID][ep.Name] = true
+		if ep.IsRender {
+			merged.IsRender = true
+			merged.RenderVolume = ep.RenderVolume
+			merged.RenderMuted = ep.RenderMuted
+		}
+		if ep.IsCapture {
+			merged.IsCapture = true
+			merged.CaptureVolume = ep.CaptureVolume
+			merged.CaptureMuted = ep.CaptureMuted
+		}
+	}
+
+	result := make([]Description, 0, len(byID))
+	for id, desc := range byID {
+		list := make([]string, 0, len(names[id]))
+		for name := range names[id] {
+			list = append(list, name)
+		}
+		sort.Strings(list)
+		desc.Name = strings.Join(list, "/")
+		result = append(result, *desc)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].PnpID < result[j].PnpID })
+	return result
+}
+
+// endpointsKey identifies a set of endpoints by PnP ID, name and flow, ignoring volume and mute,
+// so that a change of the key means endpoints came or went.
+func endpointsKey(endpoints []Description) string {
+	var b strings.Builder
+	for _, ep := range endpoints {
+		b.WriteString(ep.PnpID)
+		b.WriteByte('|')
+		b.WriteString(ep.Name)
+		b.WriteByte('|')
+		if ep.IsRender {
+			b.WriteByte('r')
+		}
+		if ep.IsCapture {
+			b.WriteByte('c')
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
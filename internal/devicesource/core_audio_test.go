@@ -0,0 +1,55 @@
+package devicesource
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEndpointPnpID(t *testing.T) {
+	longID := "{0.0.1.00000000}.{" + strings.Repeat("a", 100) + "}"
+	cases := []struct {
+		name, container, endpoint, want string
+	}{
+		{"container", "{5b3d1c2a-0000-1111-2222-333344445555}", "{0.0.0.00000000}.{x}", "5B3D1C2A-0000-1111-2222-333344445555"},
+		{"no plug and play", noPlugAndPlayContainer, "{0.0.0.00000000}.{ab-cd}", "0.0.0.00000000.AB-CD"},
+		{"no container", "", "{0.0.0.00000000}.{ab-cd}", "0.0.0.00000000.AB-CD"},
+		{"long endpoint ID", "", longID, strings.ToUpper(strings.NewReplacer("{", "", "}", "").Replace(longID[:79]))},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := endpointPnpID(tc.container, tc.endpoint); got != tc.want {
+				t.Fatalf("endpointPnpID = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMergeEndpoints_FoldsFlowsOfOneDevice(t *testing.T) {
+	got := mergeEndpoints([]Description{
+		{PnpID: "USB", Name: "Headset Microphone", IsCapture: true, CaptureVolume: 600},
+		{PnpID: "HDMI", Name: "Monitor", IsRender: true, RenderVolume: 1000},
+		{PnpID: "USB", Name: "Headset Earphone", IsRender: true, RenderVolume: 250},
+	})
+
+	want := []Description{
+		{PnpID: "HDMI", Name: "Monitor", IsRender: true, RenderVolume: 1000},
+		{PnpID: "USB", Name: "Headset Earphone/Headset Microphone", IsRender: true, IsCapture: true, RenderVolume: 250, CaptureVolume: 600},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("mergeEndpoints = %+v, want %+v", got, want)
+	}
+}
+
+func TestEndpointsKey_IgnoresVolume(t *testing.T) {
+	before := []Description{{PnpID: "A", Name: "Speakers", IsRender: true, RenderVolume: 100}}
+	louder := []Description{{PnpID: "A", Name: "Speakers", IsRender: true, RenderVolume: 900}}
+	plugged := append(louder, Description{PnpID: "B", Name: "Mic", IsCapture: true})
+
+	if endpointsKey(before) != endpointsKey(louder) {
+		t.Fatal("a volume change must not change the key")
+	}
+	if endpointsKey(before) == endpointsKey(plugged) {
+		t.Fatal("a new endpoint must change the key")
+	}
+}
@@ -0,0 +1,490 @@
+//go:build windows && cgo
+
+package devicesource
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// The sound library reports neither the endpoints other than the default devices nor the mute state,
+// so both are read from Core Audio directly through the COM interfaces below.
+
+var (
+	modOle32             = syscall.NewLazyDLL("ole32.dll")
+	procCoInitializeEx   = modOle32.NewProc("CoInitializeEx")
+	procCoUninitialize   = modOle32.NewProc("CoUninitialize")
+	procCoCreateInstance = modOle32.NewProc("CoCreateInstance")
+	procCoTaskMemFree    = modOle32.NewProc("CoTaskMemFree")
+	procPropVariantClear = modOle32.NewProc("PropVariantClear")
+)
+
+const (
+	coinitMultithreaded = 0x0
+	rpcEChangedMode     = 0x80010106
+	clsctxInprocServer  = 0x1
+	clsctxAll           = 0x17
+	stgmRead            = 0x0
+	deviceStateActive   = 0x1
+
+	eRender  = 0
+	eCapture = 1
+	eAll     = 2
+	eConsole = 0
+
+	formFactorHeadset = 5
+
+	vtUI4    = 19
+	vtLPWSTR = 31
+	vtCLSID  = 72
+)
+
+// coreAudioPollInterval is how often the endpoints and the mute state are compared with the previous poll.
+const coreAudioPollInterval = 2 * time.Second
+
+type guid struct {
+	data1 uint32
+	data2 uint16
+	data3 uint16
+	data4 [8]byte
+}
+
+func (g *guid) String() string {
+	return fmt.Sprintf("%08X-%04X-%04X-%02X%02X-%02X%02X%02X%02X%02X%02X",
+		g.data1, g.data2, g.data3, g.data4[0], g.data4[1],
+		g.data4[2], g.data4[3], g.data4[4], g.data4[5], g.data4[6], g.data4[7])
+}
+
+type propertyKey struct {
+	fmtid guid
+	pid   uint32
+}
+
+// propVariant is the PROPVARIANT layout: the type, three reserved words and a two pointer wide value.
+type propVariant struct {
+	vt  uint16
+	_   [3]uint16
+	val uintptr
+	_   uintptr
+}
+
+var (
+	clsidMMDeviceEnumerator = guid{0xBCDE0395, 0xE52F, 0x467C, [8]byte{0x8E, 0x3D, 0xC4, 0x57, 0x92, 0x91, 0x69, 0x2E}}
+	iidIMMDeviceEnumerator  = guid{0xA95664D2, 0x9614, 0x4F35, [8]byte{0xA7, 0x46, 0xDE, 0x8D, 0xB6, 0x36, 0x17, 0xE6}}
+	iidIMMEndpoint          = guid{0x1BE09788, 0x6894, 0x4089, [8]byte{0x85, 0x86, 0x9A, 0x2A, 0x6C, 0x26, 0x5A, 0xC5}}
+	iidIAudioEndpointVolume = guid{0x5CDF2C82, 0x841E, 0x4546, [8]byte{0x97, 0x22, 0x0C, 0xF7, 0x40, 0x78, 0x22, 0x9A}}
+
+	pkeyDeviceFriendlyName      = propertyKey{guid{0xA45C254E, 0xDF1C, 0x4EFD, [8]byte{0x80, 0x20, 0x67, 0xD1, 0x46, 0xA8, 0x50, 0xE0}}, 14}
+	pkeyAudioEndpointFormFactor = propertyKey{guid{0x1DA5D803, 0xD492, 0x4EDD, [8]byte{0x8C, 0x23, 0xE0, 0xC0, 0xFF, 0xEE, 0x7F, 0x0E}}, 0}
+	pkeyDeviceContainerID       = propertyKey{guid{0x8C7ED206, 0x3F8A, 0x4827, [8]byte{0xB3, 0xAB, 0xAE, 0x9E, 0x1F, 0xAE, 0xFC, 0x6C}}, 2}
+)
+
+// comObject is a COM interface pointer; the vtable is indexed by method number.
+type comObject struct {
+	vtbl *[16]uintptr
+}
+
+// Method numbers after the three IUnknown methods.
+const (
+	methodQueryInterface = 0
+	methodRelease        = 2
+
+	methodEnumAudioEndpoints      = 3 // IMMDeviceEnumerator
+	methodGetDefaultAudioEndpoint = 4
+
+	methodGetCount = 3 // IMMDeviceCollection
+	methodItem     = 4
+
+	methodActivate          = 3 // IMMDevice
+	methodOpenPropertyStore = 4
+	methodGetID             = 5
+
+	methodGetDataFlow = 3 // IMMEndpoint
+
+	methodGetValue = 5 // IPropertyStore
+
+	methodGetMasterVolumeLevelScalar = 9 // IAudioEndpointVolume
+	methodGetMute                    = 15
+)
+
+func hresultError(op string, hr uintptr) error {
+	if int32(uint32(hr)) < 0 {
+		return fmt.Errorf("%s: %w", op, syscall.Errno(uint32(hr)))
+	}
+	return nil
+}
+
+func (o *comObject) release() {
+	syscall.SyscallN(o.vtbl[methodRelease], uintptr(unsafe.Pointer(o)))
+}
+
+// withCOM runs fn on a locked OS thread with COM initialized, as the Core Audio calls require.
+// A thread that is already in a single-threaded apartment is used as it is.
+func withCOM(fn func() error) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	hr, _, _ := procCoInitializeEx.Call(0, coinitMultithreaded)
+	switch {
+	case uint32(hr) == rpcEChangedMode:
+	case int32(uint32(hr)) < 0:
+		return fmt.Errorf("CoInitializeEx: %w", syscall.Errno(uint32(hr)))
+	default:
+		defer procCoUninitialize.Call()
+	}
+	return fn()
+}
+
+func newDeviceEnumerator() (*comObject, error) {
+	var enumerator *comObject
+	hr, _, _ := procCoCreateInstance.Call(
+		uintptr(unsafe.Pointer(&clsidMMDeviceEnumerator)), 0, clsctxAll,
+		uintptr(unsafe.Pointer(&iidIMMDeviceEnumerator)), uintptr(unsafe.Pointer(&enumerator)))
+	if err := hresultError("CoCreateInstance MMDeviceEnumerator", hr); err != nil {
+		return nil, err
+	}
+	return enumerator, nil
+}
+
+// readActiveEndpoints lists the active render and capture endpoints in the form of the sound library.
+func readActiveEndpoints() ([]Description, error) {
+	var endpoints []Description
+	err := withCOM(func() error {
+		enumerator, err := newDeviceEnumerator()
+		if err != nil {
+			return err
+		}
+		defer enumerator.release()
+
+		endpoints, err = activeEndpoints(enumerator)
+		return err
+	})
+	return endpoints, err
+}
+
+// readDefaultMutes returns the mute state of the flows whose default endpoint belongs to the device with pnpID,
+// e.g. both for a headset that is the default render and capture device. A flow is nil when its default endpoint
+// belongs to another device or its mute state can not be read.
+func readDefaultMutes(pnpID string) (render, capture *bool) {
+	_ = withCOM(func() error {
+		enumerator, err := newDeviceEnumerator()
+		if err != nil {
+			return err
+		}
+		defer enumerator.release()
+
+		render = defaultMuteOf(enumerator, eRender, pnpID)
+		capture = defaultMuteOf(enumerator, eCapture, pnpID)
+		return nil
+	})
+	return render, capture
+}
+
+func defaultMuteOf(enumerator *comObject, flow uint32, pnpID string) *bool {
+	state, err := defaultMute(enumerator, flow)
+	if err != nil || state.pnpID != pnpID {
+		return nil
+	}
+	return &state.muted
+}
+
+// defaultMute returns the mute state of the default endpoint of flow.
+func defaultMute(enumerator *comObject, flow uint32) (defaultMuteState, error) {
+	var device *comObject
+	hr, _, _ := syscall.SyscallN(enumerator.vtbl[methodGetDefaultAudioEndpoint], uintptr(unsafe.Pointer(enumerator)),
+		uintptr(flow), eConsole, uintptr(unsafe.Pointer(&device)))
+	if err := hresultError("GetDefaultAudioEndpoint", hr); err != nil {
+		return defaultMuteState{}, err
+	}
+	defer device.release()
+
+	id, ok := endpointID(device)
+	if !ok {
+		return defaultMuteState{}, errors.New("default endpoint has no ID")
+	}
+	_, _, containerID, ok := endpointProperties(device)
+	if !ok {
+		return defaultMuteState{}, fmt.Errorf("default endpoint %q has no properties", id)
+	}
+	_, muted, ok := endpointVolume(device)
+	if !ok {
+		return defaultMuteState{}, fmt.Errorf("default endpoint %q has no volume control", id)
+	}
+	return defaultMuteState{id: id, pnpID: endpointPnpID(containerID, id), muted: muted}, nil
+}
+
+func activeEndpoints(enumerator *comObject) ([]Description, error) {
+	var collection *comObject
+	hr, _, _ := syscall.SyscallN(enumerator.vtbl[methodEnumAudioEndpoints], uintptr(unsafe.Pointer(enumerator)),
+		eAll, deviceStateActive, uintptr(unsafe.Pointer(&collection)))
+	if err := hresultError("EnumAudioEndpoints", hr); err != nil {
+		return nil, err
+	}
+	defer collection.release()
+
+	var count uint32
+	hr, _, _ = syscall.SyscallN(collection.vtbl[methodGetCount], uintptr(unsafe.Pointer(collection)),
+		uintptr(unsafe.Pointer(&count)))
+	if err := hresultError("IMMDeviceCollection.GetCount", hr); err != nil {
+		return nil, err
+	}
+
+	endpoints := make([]Description, 0, count)
+	for i := uint32(0); i < count; i++ {
+		var device *comObject
+		hr, _, _ = syscall.SyscallN(collection.vtbl[methodItem], uintptr(unsafe.Pointer(collection)),
+			uintptr(i), uintptr(unsafe.Pointer(&device)))
+		if hresultError("IMMDeviceCollection.Item", hr) != nil {
+			continue
+		}
+		// An endpoint that vanishes or fails while it is read is skipped, as the sound library does.
+		if desc, ok := describeEndpoint(device); ok {
+			endpoints = append(endpoints, desc)
+		}
+		device.release()
+	}
+	return mergeEndpoints(endpoints), nil
+}
+
+// describeEndpoint reads an endpoint like the sound library does: render headsets are left out,
+// and a muted endpoint reports volume 0.
+func describeEndpoint(device *comObject) (Description, bool) {
+	id, ok := endpointID(device)
+	if !ok {
+		return Description{}, false
+	}
+	flow, ok := dataFlow(device)
+	if !ok {
+		return Description{}, false
+	}
+	name, formFactor, containerID, ok := endpointProperties(device)
+	if !ok || (flow == eRender && formFactor == formFactorHeadset) {
+		return Description{}, false
+	}
+	volume, muted, ok := endpointVolume(device)
+	if !ok {
+		return Description{}, false
+	}
+
+	desc := Description{PnpID: endpointPnpID(containerID, id), Name: name}
+	switch flow {
+	case eRender:
+		desc.IsRender, desc.RenderVolume, desc.RenderMuted = true, volume, &muted
+	case eCapture:
+		desc.IsCapture, desc.CaptureVolume, desc.CaptureMuted = true, volume, &muted
+	default:
+		return Description{}, false
+	}
+	return desc, true
+}
+
+func endpointID(device *comObject) (string, bool) {
+	var id *uint16
+	hr, _, _ := syscall.SyscallN(device.vtbl[methodGetID], uintptr(unsafe.Pointer(device)), uintptr(unsafe.Pointer(&id)))
+	if hresultError("IMMDevice.GetId", hr) != nil || id == nil {
+		return "", false
+	}
+	defer procCoTaskMemFree.Call(uintptr(unsafe.Pointer(id)))
+	return utf16PtrToString(id), true
+}
+
+func dataFlow(device *comObject) (uint32, bool) {
+	var endpoint *comObject
+	hr, _, _ := syscall.SyscallN(device.vtbl[methodQueryInterface], uintptr(unsafe.Pointer(device)),
+		uintptr(unsafe.Pointer(&iidIMMEndpoint)), uintptr(unsafe.Pointer(&endpoint)))
+	if hresultError("QueryInterface IMMEndpoint", hr) != nil {
+		return 0, false
+	}
+	defer endpoint.release()
+
+	var flow uint32
+	hr, _, _ = syscall.SyscallN(endpoint.vtbl[methodGetDataFlow], uintptr(unsafe.Pointer(endpoint)),
+		uintptr(unsafe.Pointer(&flow)))
+	return flow, hresultError("IMMEndpoint.GetDataFlow", hr) == nil
+}
+
+// endpointProperties reads the friendly name, the form factor and the container ID.
+func endpointProperties(device *comObject) (name string, formFactor uint32, containerID string, ok bool) {
+	var store *comObject
+	hr, _, _ := syscall.SyscallN(device.vtbl[methodOpenPropertyStore], uintptr(unsafe.Pointer(device)),
+		stgmRead, uintptr(unsafe.Pointer(&store)))
+	if hresultError("IMMDevice.OpenPropertyStore", hr) != nil {
+		return "", 0, "", false
+	}
+	defer store.release()
+
+	name = "UnknownDeviceName"
+	readProperty(store, &pkeyDeviceFriendlyName, func(pv *propVariant) {
+		if pv.vt == vtLPWSTR {
+			name = utf16PtrToString(*(**uint16)(unsafe.Pointer(&pv.val)))
+		}
+	})
+	readProperty(store, &pkeyAudioEndpointFormFactor, func(pv *propVariant) {
+		if pv.vt == vtUI4 {
+			formFactor = uint32(pv.val)
+		}
+	})
+	readProperty(store, &pkeyDeviceContainerID, func(pv *propVariant) {
+		if pv.vt == vtCLSID {
+			containerID = (*(**guid)(unsafe.Pointer(&pv.val))).String()
+		}
+	})
+	return name, formFactor, containerID, true
+}
+
+// readProperty passes the value of key to read, if it can be read, and clears it afterwards.
+func readProperty(store *comObject, key *propertyKey, read func(*propVariant)) {
+	pv := new(propVariant)
+	hr, _, _ := syscall.SyscallN(store.vtbl[methodGetValue], uintptr(unsafe.Pointer(store)),
+		uintptr(unsafe.Pointer(key)), uintptr(unsafe.Pointer(pv)))
+	if hresultError("IPropertyStore.GetValue", hr) != nil {
+		return
+	}
+	read(pv)
+	procPropVariantClear.Call(uintptr(unsafe.Pointer(pv)))
+}
+
+// endpointVolume returns the master volume on the 0..1000 scale, 0 while muted, and the mute state.
+func endpointVolume(device *comObject) (volume uint16, muted bool, ok bool) {
+	var endpointVolume *comObject
+	hr, _, _ := syscall.SyscallN(device.vtbl[methodActivate], uintptr(unsafe.Pointer(device)),
+		uintptr(unsafe.Pointer(&iidIAudioEndpointVolume)), clsctxInprocServer, 0, uintptr(unsafe.Pointer(&endpointVolume)))
+	if hresultError("IMMDevice.Activate IAudioEndpointVolume", hr) != nil {
+		return 0, false, false
+	}
+	defer endpointVolume.release()
+
+	var mute int32
+	hr, _, _ = syscall.SyscallN(endpointVolume.vtbl[methodGetMute], uintptr(unsafe.Pointer(endpointVolume)),
+		uintptr(unsafe.Pointer(&mute)))
+	if hresultError("IAudioEndpointVolume.GetMute", hr) != nil {
+		return 0, false, false
+	}
+	if mute != 0 {
+		return 0, true, true
+	}
+
+	var scalar float32
+	hr, _, _ = syscall.SyscallN(endpointVolume.vtbl[methodGetMasterVolumeLevelScalar], uintptr(unsafe.Pointer(endpointVolume)),
+		uintptr(unsafe.Pointer(&scalar)))
+	if hresultError("IAudioEndpointVolume.GetMasterVolumeLevelScalar", hr) != nil {
+		return 0, false, false
+	}
+	return uint16(math.Round(float64(scalar) * 1000)), false, true
+}
+
+func utf16PtrToString(p *uint16) string {
+	if p == nil {
+		return ""
+	}
+	var s []uint16
+	for ptr := unsafe.Pointer(p); *(*uint16)(ptr) != 0; ptr = unsafe.Add(ptr, 2) {
+		s = append(s, *(*uint16)(ptr))
+	}
+	return syscall.UTF16ToString(s)
+}
+
+// coreAudioHandlers are called by the watcher; they may be nil.
+type coreAudioHandlers struct {
+	endpointsChanged   func()
+	renderMuteChanged  func()
+	captureMuteChanged func()
+}
+
+// coreAudioState is what the watcher compares between polls.
+type coreAudioState struct {
+	endpoints string
+	render    defaultMuteState
+	capture   defaultMuteState
+}
+
+// defaultMuteState is the mute state of a default endpoint; id is empty when it can not be read.
+type defaultMuteState struct {
+	id    string
+	pnpID string
+	muted bool
+}
+
+// coreAudioWatcher polls the active endpoints and the mute state of the default endpoints and calls the handlers
+// when endpoints come or go or the default endpoint is muted or unmuted. Core Audio would notify through an
+// IMMNotificationClient and IAudioEndpointVolumeCallback, which Go can only implement with hand-built vtables.
+type coreAudioWatcher struct {
+	handlers func() coreAudioHandlers
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func startCoreAudioWatcher(handlers func() coreAudioHandlers) *coreAudioWatcher {
+	w := &coreAudioWatcher{handlers: handlers, stop: make(chan struct{}), done: make(chan struct{})}
+	last, _ := readCoreAudioState()
+	go w.run(last)
+	return w
+}
+
+func (w *coreAudioWatcher) close() {
+	close(w.stop)
+	<-w.done
+}
+
+func (w *coreAudioWatcher) run(last coreAudioState) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(coreAudioPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+
+		current, err := readCoreAudioState()
+		if err != nil {
+			continue
+		}
+		h := w.handlers()
+		if current.endpoints != last.endpoints && h.endpointsChanged != nil {
+			h.endpointsChanged()
+		}
+		// A switch of the default endpoint is reported by the sound library, with the mute state of the new one.
+		if muteChanged(last.render, current.render) && h.renderMuteChanged != nil {
+			h.renderMuteChanged()
+		}
+		if muteChanged(last.capture, current.capture) && h.captureMuteChanged != nil {
+			h.captureMuteChanged()
+		}
+		last = current
+	}
+}
+
+func muteChanged(last, current defaultMuteState) bool {
+	return current.id != "" && current.id == last.id && current.muted != last.muted
+}
+
+func readCoreAudioState() (coreAudioState, error) {
+	var state coreAudioState
+	err := withCOM(func() error {
+		enumerator, err := newDeviceEnumerator()
+		if err != nil {
+			return err
+		}
+		defer enumerator.release()
+
+		endpoints, err := activeEndpoints(enumerator)
+		if err != nil {
+			return err
+		}
+		state.endpoints = endpointsKey(endpoints)
+		// Without a default endpoint of a flow its state stays empty.
+		state.render, _ = defaultMute(enumerator, eRender)
+		state.capture, _ = defaultMute(enumerator, eCapture)
+		return nil
+	})
+	return state, err
+}
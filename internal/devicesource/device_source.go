@@ -0,0 +1,107 @@
+package devicesource
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// KindSoundLib is the native Windows Core Audio backend provided by soundlibwrap.
+	KindSoundLib = "soundlib"
+	// KindSimulated plays a scripted scenario and runs on every platform.
+	KindSimulated = "simulated"
+)
+
+// ErrNoDevice is returned when no default endpoint exists for the requested flow.
+var ErrNoDevice = errors.New("no default device")
+
+// Description describes an audio endpoint.
+// RenderMuted and CaptureMuted are nil when the mute state of that flow is unknown,
+// e.g. the source does not report it, the endpoint lacks the flow, or reading it failed.
+type Description struct {
+	PnpID         string
+	Name          string
+	IsRender      bool
+	IsCapture     bool
+	RenderVolume  uint16
+	CaptureVolume uint16
+	RenderMuted   *bool
+	CaptureMuted  *bool
+}
+
+// DeviceSource is the audio backend the scanner reads devices and change notifications from.
+// Handlers must be set before Initialize; they may be called from a backend thread.
+type DeviceSource interface {
+	Initialize(appName, appVersion string) error
+	Uninitialize() error
+	DefaultRender() (Description, error)
+	DefaultCapture() (Description, error)
+	OperatingSystemName() (string, error)
+
+	SetDefaultRenderHandler(func(present bool))
+	SetDefaultCaptureHandler(func(present bool))
+	SetRenderVolumeChangedHandler(func())
+	SetCaptureVolumeChangedHandler(func())
+}
+
+// EndpointEnumerator is implemented by device sources that can list every active endpoint,
+// not only the default render and capture devices.
+type EndpointEnumerator interface {
+	ActiveEndpoints() ([]Description, error)
+	SetEndpointsChangedHandler(func())
+}
+
+// MuteNotifier is implemented by device sources that report the mute state of the default endpoints.
+// Sources without it leave RenderMuted/CaptureMuted nil.
+type MuteNotifier interface {
+	SetRenderMuteChangedHandler(func())
+	SetCaptureMuteChangedHandler(func())
+}
+
+// Options select and configure a DeviceSource.
+type Options struct {
+	Kind         string
+	ScenarioPath string
+}
+
+// native is set by the platform file that provides the soundlibwrap backend, if any.
+var native func() DeviceSource
+
+// New builds the device source named by opts.Kind; an empty kind selects the native backend.
+func New(opts Options) (DeviceSource, error) {
+	kind := strings.ToLower(strings.TrimSpace(opts.Kind))
+	if kind == "" {
+		kind = KindSoundLib
+	}
+
+	switch kind {
+	case KindSoundLib:
+		if native == nil {
+			return nil, fmt.Errorf("device source %q is not available on this platform (use %q)", KindSoundLib, KindSimulated)
+		}
+		return native(), nil
+	case KindSimulated:
+		scenario := DefaultScenario()
+		if strings.TrimSpace(opts.ScenarioPath) != "" {
+			loaded, err := LoadScenario(opts.ScenarioPath)
+			if err != nil {
+				return nil, err
+			}
+			scenario = loaded
+		}
+		return NewSimulatedSource(scenario), nil
+	default:
+		return nil, fmt.Errorf("unsupported device source %q (supported: %s)", kind, strings.Join(supportedKinds(), ", "))
+	}
+}
+
+func supportedKinds() []string {
+	kinds := []string{KindSimulated}
+	if native != nil {
+		kinds = append(kinds, KindSoundLib)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
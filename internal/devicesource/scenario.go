@@ -0,0 +1,192 @@
+package devicesource
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ActionPlug   = "plug"
+	ActionUnplug = "unplug"
+	ActionVolume = "volume"
+	ActionAdd    = "add"
+	ActionRemove = "remove"
+	ActionMute   = "mute"
+
+	FlowRender  = "render"
+	FlowCapture = "capture"
+)
+
+// Scenario is a scripted timeline played by the simulated device source.
+type Scenario struct {
+	OperatingSystemName string           `json:"operatingSystemName,omitempty"`
+	Render              *ScenarioDevice  `json:"render,omitempty"`
+	Capture             *ScenarioDevice  `json:"capture,omitempty"`
+	Endpoints           []ScenarioDevice `json:"endpoints,omitempty"`
+	Loop                bool             `json:"loop,omitempty"`
+	Events              []ScenarioEvent  `json:"events"`
+}
+
+// ScenarioDevice is the state of a simulated endpoint. Flow is only needed for non-default endpoints.
+type ScenarioDevice struct {
+	Flow          string `json:"flow,omitempty"`
+	PnpID         string `json:"pnpId"`
+	Name          string `json:"name"`
+	RenderVolume  uint16 `json:"renderVolume,omitempty"`
+	CaptureVolume uint16 `json:"captureVolume,omitempty"`
+	RenderMuted   bool   `json:"renderMuted,omitempty"`
+	CaptureMuted  bool   `json:"captureMuted,omitempty"`
+}
+
+// ScenarioEvent happens After the previous event (or the start of the scenario).
+// plug/unplug change the default endpoint of Flow, add/remove change a non-default endpoint.
+type ScenarioEvent struct {
+	After  Duration        `json:"after"`
+	Action string          `json:"action"`
+	Flow   string          `json:"flow"`
+	Device *ScenarioDevice `json:"device,omitempty"`
+	Volume *uint16         `json:"volume,omitempty"`
+	Muted  *bool           `json:"muted,omitempty"`
+}
+
+// Duration accepts Go duration strings such as "1.5s" in JSON.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("duration must be a string such as \"2s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LoadScenario reads and validates a scenario file: YAML for the .yaml and .yml extensions, JSON otherwise.
+func LoadScenario(path string) (Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Scenario{}, fmt.Errorf("read scenario: %w", err)
+	}
+	parse := ParseScenario
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		parse = ParseYAMLScenario
+	}
+	scenario, err := parse(data)
+	if err != nil {
+		return Scenario{}, fmt.Errorf("scenario %s: %w", path, err)
+	}
+	return scenario, nil
+}
+
+// ParseScenario decodes and validates a JSON scenario.
+func ParseScenario(data []byte) (Scenario, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var scenario Scenario
+	if err := decoder.Decode(&scenario); err != nil {
+		return Scenario{}, err
+	}
+	if err := scenario.validate(); err != nil {
+		return Scenario{}, err
+	}
+	return scenario, nil
+}
+
+// ParseYAMLScenario decodes and validates a YAML scenario. It has the fields of the JSON form;
+// the document is converted to JSON, so both are checked the same way.
+func ParseYAMLScenario(data []byte) (Scenario, error) {
+	var document any
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return Scenario{}, err
+	}
+	converted, err := json.Marshal(document)
+	if err != nil {
+		return Scenario{}, fmt.Errorf("convert YAML: %w", err)
+	}
+	return ParseScenario(converted)
+}
+
+func (s Scenario) validate() error {
+	for i, device := range s.Endpoints {
+		if device.Flow != FlowRender && device.Flow != FlowCapture {
+			return fmt.Errorf("endpoint %d: unsupported flow %q (supported: %s, %s)", i, device.Flow, FlowRender, FlowCapture)
+		}
+		if strings.TrimSpace(device.PnpID) == "" {
+			return fmt.Errorf("endpoint %d: pnpId is required", i)
+		}
+	}
+
+	var total time.Duration
+	for i, ev := range s.Events {
+		if ev.After < 0 {
+			return fmt.Errorf("event %d: negative delay", i)
+		}
+		total += time.Duration(ev.After)
+
+		switch ev.Flow {
+		case FlowRender, FlowCapture:
+		default:
+			return fmt.Errorf("event %d: unsupported flow %q (supported: %s, %s)", i, ev.Flow, FlowRender, FlowCapture)
+		}
+
+		switch ev.Action {
+		case ActionPlug, ActionAdd, ActionRemove:
+			if ev.Device == nil || strings.TrimSpace(ev.Device.PnpID) == "" {
+				return fmt.Errorf("event %d: %s requires a device with pnpId", i, ev.Action)
+			}
+		case ActionUnplug:
+		case ActionVolume:
+			if ev.Volume == nil {
+				return fmt.Errorf("event %d: %s requires volume", i, ActionVolume)
+			}
+		case ActionMute:
+			if ev.Muted == nil {
+				return fmt.Errorf("event %d: %s requires muted", i, ActionMute)
+			}
+		default:
+			return fmt.Errorf("event %d: unsupported action %q (supported: %s, %s, %s, %s, %s, %s)", i, ev.Action, ActionPlug, ActionUnplug, ActionVolume, ActionMute, ActionAdd, ActionRemove)
+		}
+	}
+	if s.Loop && total <= 0 {
+		return fmt.Errorf("a looping scenario needs a positive total duration")
+	}
+	return nil
+}
+
+// DefaultScenario loops through volume changes and a headset being plugged in and out.
+func DefaultScenario() Scenario {
+	volume := func(v uint16) *uint16 { return &v }
+	speakers := &ScenarioDevice{PnpID: "{0.0.0.00000000}.{sim-speakers}", Name: "Simulated Speakers", RenderVolume: 40}
+	headset := &ScenarioDevice{PnpID: "{0.0.0.00000000}.{sim-headset}", Name: "Simulated Headset", RenderVolume: 25}
+
+	return Scenario{
+		OperatingSystemName: "Simulated OS",
+		Render:              speakers,
+		Capture:             &ScenarioDevice{PnpID: "{0.0.1.00000000}.{sim-microphone}", Name: "Simulated Microphone", CaptureVolume: 70},
+		Loop:                true,
+		Events: []ScenarioEvent{
+			{After: Duration(5 * time.Second), Action: ActionVolume, Flow: FlowRender, Volume: volume(55)},
+			{After: Duration(5 * time.Second), Action: ActionVolume, Flow: FlowCapture, Volume: volume(60)},
+			{After: Duration(5 * time.Second), Action: ActionUnplug, Flow: FlowRender},
+			{After: Duration(1 * time.Second), Action: ActionPlug, Flow: FlowRender, Device: headset},
+			{After: Duration(5 * time.Second), Action: ActionUnplug, Flow: FlowRender},
+			{After: Duration(1 * time.Second), Action: ActionPlug, Flow: FlowRender, Device: speakers},
+		},
+	}
+}
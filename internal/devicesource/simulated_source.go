@@ -0,0 +1,300 @@
+package devicesource
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SimulatedSource is a DeviceSource that plays a Scenario instead of reading Core Audio.
+type SimulatedSource struct {
+	scenario Scenario
+	sleep    func(ctx context.Context, d time.Duration) bool
+
+	mu             sync.Mutex
+	render         *Description
+	capture        *Description
+	renderHandler  func(present bool)
+	captureHandler func(present bool)
+	renderVolume   func()
+	captureVolume  func()
+	renderMute     func()
+	captureMute    func()
+	endpoints      []Description // active non-default endpoints
+	endpointsEvent func()
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewSimulatedSource(scenario Scenario) *SimulatedSource {
+	return &SimulatedSource{
+		scenario: scenario,
+		sleep:    sleepCtx,
+		done:     make(chan struct{}),
+	}
+}
+
+func (s *SimulatedSource) Initialize(_, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		return fmt.Errorf("simulated source is already initialized")
+	}
+	s.render = toDescription(s.scenario.Render, FlowRender)
+	s.capture = toDescription(s.scenario.Capture, FlowCapture)
+	s.endpoints = nil
+	for i := range s.scenario.Endpoints {
+		s.endpoints = append(s.endpoints, *toDescription(&s.scenario.Endpoints[i], s.scenario.Endpoints[i].Flow))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go s.play(ctx)
+	return nil
+}
+
+func (s *SimulatedSource) Uninitialize() error {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-s.done
+	}
+	return nil
+}
+
+// Done is closed once a non-looping scenario has played out or the source was uninitialized.
+func (s *SimulatedSource) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *SimulatedSource) DefaultRender() (Description, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.render == nil {
+		return Description{}, fmt.Errorf("render: %w", ErrNoDevice)
+	}
+	d := *s.render
+	if s.capture != nil && s.capture.PnpID == d.PnpID {
+		d.CaptureMuted = s.capture.CaptureMuted
+	}
+	return d, nil
+}
+
+func (s *SimulatedSource) DefaultCapture() (Description, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.capture == nil {
+		return Description{}, fmt.Errorf("capture: %w", ErrNoDevice)
+	}
+	d := *s.capture
+	if s.render != nil && s.render.PnpID == d.PnpID {
+		d.RenderMuted = s.render.RenderMuted
+	}
+	return d, nil
+}
+
+// ActiveEndpoints lists the default endpoints followed by the other active endpoints.
+func (s *SimulatedSource) ActiveEndpoints() ([]Description, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var active []Description
+	seen := make(map[string]bool)
+	for _, d := range []*Description{s.render, s.capture} {
+		if d != nil && !seen[d.PnpID] {
+			seen[d.PnpID] = true
+			active = append(active, *d)
+		}
+	}
+	for _, d := range s.endpoints {
+		if !seen[d.PnpID] {
+			seen[d.PnpID] = true
+			active = append(active, d)
+		}
+	}
+	return active, nil
+}
+
+func (s *SimulatedSource) OperatingSystemName() (string, error) {
+	if s.scenario.OperatingSystemName == "" {
+		return "Simulated OS", nil
+	}
+	return s.scenario.OperatingSystemName, nil
+}
+
+func (s *SimulatedSource) SetDefaultRenderHandler(h func(present bool)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.renderHandler = h
+}
+
+func (s *SimulatedSource) SetDefaultCaptureHandler(h func(present bool)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.captureHandler = h
+}
+
+func (s *SimulatedSource) SetRenderVolumeChangedHandler(h func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.renderVolume = h
+}
+
+func (s *SimulatedSource) SetCaptureVolumeChangedHandler(h func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.captureVolume = h
+}
+
+func (s *SimulatedSource) SetRenderMuteChangedHandler(h func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.renderMute = h
+}
+
+func (s *SimulatedSource) SetCaptureMuteChangedHandler(h func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.captureMute = h
+}
+
+func (s *SimulatedSource) SetEndpointsChangedHandler(h func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.endpointsEvent = h
+}
+
+func (s *SimulatedSource) play(ctx context.Context) {
+	defer close(s.done)
+
+	for {
+		for _, ev := range s.scenario.Events {
+			if !s.sleep(ctx, time.Duration(ev.After)) {
+				return
+			}
+			s.apply(ev)
+		}
+		if !s.scenario.Loop {
+			return
+		}
+	}
+}
+
+// apply changes the simulated state and then notifies outside the lock, like a native callback would.
+func (s *SimulatedSource) apply(ev ScenarioEvent) {
+	s.mu.Lock()
+	device := &s.render
+	presentHandler, volumeHandler, muteHandler := s.renderHandler, s.renderVolume, s.renderMute
+	if ev.Flow == FlowCapture {
+		device = &s.capture
+		presentHandler, volumeHandler, muteHandler = s.captureHandler, s.captureVolume, s.captureMute
+	}
+	endpointsHandler := s.endpointsEvent
+
+	var notify []func()
+	switch ev.Action {
+	case ActionPlug:
+		// The previous default stays active as a non-default endpoint.
+		if previous := *device; previous != nil && previous.PnpID != ev.Device.PnpID {
+			s.endpoints = append(s.endpoints, *previous)
+		}
+		*device = toDescription(ev.Device, ev.Flow)
+		s.endpoints = removeEndpoint(s.endpoints, ev.Device.PnpID)
+		if presentHandler != nil {
+			notify = append(notify, func() { presentHandler(true) })
+		}
+		notify = append(notify, endpointsHandler)
+	case ActionUnplug:
+		*device = nil
+		if presentHandler != nil {
+			notify = append(notify, func() { presentHandler(false) })
+		}
+		notify = append(notify, endpointsHandler)
+	case ActionVolume:
+		if *device != nil {
+			if ev.Flow == FlowCapture {
+				(*device).CaptureVolume = *ev.Volume
+			} else {
+				(*device).RenderVolume = *ev.Volume
+			}
+			notify = append(notify, volumeHandler)
+		}
+	case ActionMute:
+		if *device != nil {
+			muted := *ev.Muted
+			if ev.Flow == FlowCapture {
+				(*device).CaptureMuted = &muted
+			} else {
+				(*device).RenderMuted = &muted
+			}
+			notify = append(notify, muteHandler)
+		}
+	case ActionAdd:
+		s.endpoints = append(removeEndpoint(s.endpoints, ev.Device.PnpID), *toDescription(ev.Device, ev.Flow))
+		notify = append(notify, endpointsHandler)
+	case ActionRemove:
+		s.endpoints = removeEndpoint(s.endpoints, ev.Device.PnpID)
+		notify = append(notify, endpointsHandler)
+	}
+	s.mu.Unlock()
+
+	for _, n := range notify {
+		if n != nil {
+			n()
+		}
+	}
+}
+
+func removeEndpoint(endpoints []Description, pnpID string) []Description {
+	kept := endpoints[:0]
+	for _, d := range endpoints {
+		if d.PnpID != pnpID {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
+
+// toDescription describes device as an endpoint of flow; only the mute state of that flow is known.
+func toDescription(device *ScenarioDevice, flow string) *Description {
+	if device == nil {
+		return nil
+	}
+	desc := &Description{
+		PnpID:         device.PnpID,
+		Name:          device.Name,
+		IsRender:      flow == FlowRender,
+		IsCapture:     flow == FlowCapture,
+		RenderVolume:  device.RenderVolume,
+		CaptureVolume: device.CaptureVolume,
+	}
+	switch flow {
+	case FlowRender:
+		muted := device.RenderMuted
+		desc.RenderMuted = &muted
+	case FlowCapture:
+		muted := device.CaptureMuted
+		desc.CaptureMuted = &muted
+	}
+	return desc
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
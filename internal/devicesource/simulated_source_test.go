@@ -0,0 +1,140 @@
+package devicesource
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testScenario = `{
+  "operatingSystemName": "Test OS",
+  "render": {"pnpId": "speakers", "name": "Speakers", "renderVolume": 40},
+  "events": [
+    {"after": "10ms", "action": "volume", "flow": "render", "volume": 55},
+    {"after": "0s", "action": "unplug", "flow": "render"},
+    {"after": "0s", "action": "plug", "flow": "capture", "device": {"pnpId": "mic", "name": "Mic", "captureVolume": 70}}
+  ]
+}`
+
+func TestSimulatedSource_PlaysScenario(t *testing.T) {
+	scenario, err := ParseScenario([]byte(testScenario))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSimulatedSource(scenario)
+	s.sleep = func(ctx context.Context, _ time.Duration) bool { return ctx.Err() == nil }
+
+	var mu sync.Mutex
+	var notifications []string
+	record := func(n string) {
+		mu.Lock()
+		defer mu.Unlock()
+		notifications = append(notifications, n)
+	}
+	var renderVolumeSeen uint16
+	s.SetRenderVolumeChangedHandler(func() {
+		desc, _ := s.DefaultRender()
+		renderVolumeSeen = desc.RenderVolume
+		record("render volume")
+	})
+	s.SetDefaultRenderHandler(func(present bool) {
+		if !present {
+			record("render removed")
+		}
+	})
+	s.SetDefaultCaptureHandler(func(present bool) {
+		if present {
+			record("capture added")
+		}
+	})
+
+	if _, err := s.DefaultCapture(); !errors.Is(err, ErrNoDevice) {
+		t.Fatalf("expected ErrNoDevice before initialization, got %v", err)
+	}
+	if err := s.Initialize("test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	<-s.Done()
+	_ = s.Uninitialize()
+
+	want := []string{"render volume", "render removed", "capture added"}
+	if len(notifications) != len(want) {
+		t.Fatalf("expected %v, got %v", want, notifications)
+	}
+	for i := range want {
+		if notifications[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, notifications)
+		}
+	}
+	if renderVolumeSeen != 55 {
+		t.Fatalf("expected handler to observe volume 55, got %d", renderVolumeSeen)
+	}
+	if _, err := s.DefaultRender(); !errors.Is(err, ErrNoDevice) {
+		t.Fatalf("expected unplugged render device, got %v", err)
+	}
+	if desc, err := s.DefaultCapture(); err != nil || desc.PnpID != "mic" || !desc.IsCapture {
+		t.Fatalf("unexpected capture device %+v, %v", desc, err)
+	}
+}
+
+func TestParseYAMLScenario_MatchesJSON(t *testing.T) {
+	const yamlScenario = `
+operatingSystemName: Test OS
+render: {pnpId: speakers, name: Speakers, renderVolume: 40}
+events:
+  - {after: 10ms, action: volume, flow: render, volume: 55}
+  - {after: 0s, action: unplug, flow: render}
+  - after: 0s
+    action: plug
+    flow: capture
+    device: {pnpId: mic, name: Mic, captureVolume: 70}
+`
+	want, err := ParseScenario([]byte(testScenario))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseYAMLScenario([]byte(yamlScenario))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	if _, err := ParseYAMLScenario([]byte("events: []\nspeed: 2\n")); err == nil {
+		t.Fatal("expected unknown fields to be rejected")
+	}
+}
+
+func TestLoadScenario_ExamplesAgree(t *testing.T) {
+	fromJSON, err := LoadScenario("../../docs/simulated-scenario.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromYAML, err := LoadScenario("../../docs/simulated-scenario.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromYAML, fromJSON) {
+		t.Fatalf("expected the YAML example to match the JSON one, got %+v and %+v", fromYAML, fromJSON)
+	}
+}
+
+func TestParseScenario_RejectsInvalidEvents(t *testing.T) {
+	cases := map[string]string{
+		"unknown action": `{"events":[{"after":"1s","action":"explode","flow":"render"}]}`,
+		"unknown flow":   `{"events":[{"after":"1s","action":"unplug","flow":"loopback"}]}`,
+		"plug no device": `{"events":[{"after":"1s","action":"plug","flow":"render"}]}`,
+		"bad duration":   `{"events":[{"after":5,"action":"unplug","flow":"render"}]}`,
+		"busy loop":      `{"loop":true,"events":[{"after":"0s","action":"unplug","flow":"render"}]}`,
+	}
+	for name, data := range cases {
+		if _, err := ParseScenario([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+//go:build windows && cgo
+
+package devicesource
+
+import (
+	"sync"
+
+	"github.com/collect-sound-devices/sound-win-scanner/v4/pkg/soundlibwrap"
+)
+
+func init() {
+	native = func() DeviceSource { return &soundLibSource{} }
+}
+
+// soundLibSource adapts the package-level soundlibwrap API to DeviceSource.
+// The endpoints other than the default devices and the mute state come from Core Audio, see core_audio_windows.go.
+type soundLibSource struct {
+	handle  soundlibwrap.Handle
+	watcher *coreAudioWatcher
+
+	mu       sync.Mutex
+	handlers coreAudioHandlers
+}
+
+func (s *soundLibSource) Initialize(appName, appVersion string) error {
+	h, err := soundlibwrap.Initialize(appName, appVersion)
+	if err != nil {
+		return err
+	}
+
+	if err := soundlibwrap.RegisterCallbacks(h); err != nil {
+		_ = soundlibwrap.Uninitialize(h)
+		return err
+	}
+	s.handle = h
+	s.watcher = startCoreAudioWatcher(s.coreAudioHandlers)
+	return nil
+}
+
+func (s *soundLibSource) Uninitialize() error {
+	if s.handle == 0 {
+		return nil
+	}
+	s.watcher.close()
+	s.watcher = nil
+	err := soundlibwrap.Uninitialize(s.handle)
+	s.handle = 0
+	return err
+}
+
+func (s *soundLibSource) DefaultRender() (Description, error) {
+	desc, err := soundlibwrap.GetDefaultRender(s.handle)
+	if err != nil {
+		return Description{}, err
+	}
+	d := fromSoundLib(desc)
+	if d.PnpID != "" {
+		d.RenderMuted, d.CaptureMuted = readDefaultMutes(d.PnpID)
+	}
+	return d, nil
+}
+
+func (s *soundLibSource) DefaultCapture() (Description, error) {
+	desc, err := soundlibwrap.GetDefaultCapture(s.handle)
+	if err != nil {
+		return Description{}, err
+	}
+	d := fromSoundLib(desc)
+	if d.PnpID != "" {
+		d.RenderMuted, d.CaptureMuted = readDefaultMutes(d.PnpID)
+	}
+	return d, nil
+}
+
+// ActiveEndpoints lists every active render and capture endpoint, merged by PnP ID like the default devices.
+func (s *soundLibSource) ActiveEndpoints() ([]Description, error) {
+	return readActiveEndpoints()
+}
+
+func (s *soundLibSource) SetEndpointsChangedHandler(h func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers.endpointsChanged = h
+}
+
+func (s *soundLibSource) SetRenderMuteChangedHandler(h func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers.renderMuteChanged = h
+}
+
+func (s *soundLibSource) SetCaptureMuteChangedHandler(h func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers.captureMuteChanged = h
+}
+
+func (s *soundLibSource) coreAudioHandlers() coreAudioHandlers {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.handlers
+}
+
+func (s *soundLibSource) OperatingSystemName() (string, error) {
+	return soundlibwrap.GetExtendedOperatingSystemName(s.handle)
+}
+
+func (s *soundLibSource) SetDefaultRenderHandler(h func(present bool)) {
+	soundlibwrap.SetDefaultRenderHandler(h)
+}
+
+func (s *soundLibSource) SetDefaultCaptureHandler(h func(present bool)) {
+	soundlibwrap.SetDefaultCaptureHandler(h)
+}
+
+func (s *soundLibSource) SetRenderVolumeChangedHandler(h func()) {
+	soundlibwrap.SetRenderVolumeChangedHandler(h)
+}
+
+func (s *soundLibSource) SetCaptureVolumeChangedHandler(h func()) {
+	soundlibwrap.SetCaptureVolumeChangedHandler(h)
+}
+
+func fromSoundLib(desc soundlibwrap.Description) Description {
+	return Description{
+		PnpID:         desc.PnpID,
+		Name:          desc.Name,
+		IsRender:      desc.IsRender,
+		IsCapture:     desc.IsCapture,
+		RenderVolume:  desc.RenderVolume,
+		CaptureVolume: desc.CaptureVolume,
+	}
+}
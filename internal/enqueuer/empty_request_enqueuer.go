@@ -1,6 +1,7 @@
 package enqueuer
 
 import (
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
 	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/logging"
 )
 
@@ -19,7 +20,7 @@ func (e *EmptyRequestEnqueuer) EnqueueRequest(request Request) error {
 	e.logger.Printf(
 		"[info, empty enqueuer] event=%d fields=%v",
 		request.Event,
-		request.Fields,
+		contract.Fields(request.Data),
 	)
 	return nil
 }
@@ -1,16 +1,91 @@
 package enqueuer
 
 import (
-	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
 	"time"
+
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
 )
 
 type Request struct {
 	Timestamp time.Time
 	Event     contract.EventType
-	Fields    map[string]string
+	// Data is the struct of the event's kind, e.g. contract.VolumeChange for EventTypeRenderVolumeChanged.
+	Data contract.Event
+}
+
+// Validate reports a request whose data does not fit its event type or misses required fields.
+func (r Request) Validate() error {
+	if r.Data == nil {
+		return fmt.Errorf("%s: no event data", r.Event)
+	}
+	if !contract.Fits(r.Event, r.Data) {
+		return fmt.Errorf("%s: unexpected event data %T", r.Event, r.Data)
+	}
+	if err := r.Data.Validate(); err != nil {
+		return fmt.Errorf("%s: %w", r.Event, err)
+	}
+	return nil
+}
+
+// ID identifies the request by its content, so every retry of the same request gets the same ID,
+// also after it was restored from the outbox.
+func (r Request) ID() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d", r.Timestamp.UTC().Format(time.RFC3339Nano), r.Event)
+
+	fields := contract.Fields(r.Data)
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(h, "\x00%s=%s", key, fields[key])
+	}
+
+	return hex.EncodeToString(h.Sum(nil)[:16])
 }
 
 type EnqueueRequest interface {
 	EnqueueRequest(request Request) error
 }
+
+// PipelinedEnqueueRequest is implemented by enqueuers that can send a request without waiting until the
+// receiver acknowledged it, like the RabbitMQ enqueuer waiting for publisher confirms.
+// SendRequest sends in the order of the calls and returns a wait that must be called; wait returns what
+// EnqueueRequest would have. Up to MaxInFlight sent requests may be unwaited, a further SendRequest blocks.
+type PipelinedEnqueueRequest interface {
+	EnqueueRequest
+	SendRequest(request Request) (wait func() error)
+	MaxInFlight() int
+}
+
+// Send sends request through e without waiting for the acknowledgement if e is pipelined,
+// otherwise it enqueues synchronously and wait returns the result.
+func Send(e EnqueueRequest, request Request) (wait func() error) {
+	if pipelined, ok := e.(PipelinedEnqueueRequest); ok {
+		return pipelined.SendRequest(request)
+	}
+	err := e.EnqueueRequest(request)
+	return func() error { return err }
+}
+
+// MaxInFlight returns how many requests sent through e with Send may be unwaited at the same time.
+func MaxInFlight(e EnqueueRequest) int {
+	if pipelined, ok := e.(PipelinedEnqueueRequest); ok && pipelined.MaxInFlight() > 0 {
+		return pipelined.MaxInFlight()
+	}
+	return 1
+}
+
+// IsPermanent reports errors that declare that repeating the request can not succeed, e.g. a 4xx REST response.
+// Anything else, including transport errors that are not Temporary like a refused connection, may succeed later.
+func IsPermanent(err error) bool {
+	var permanent interface{ Permanent() bool }
+	return errors.As(err, &permanent) && permanent.Permanent()
+}
@@ -0,0 +1,78 @@
+package enqueuer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+)
+
+func TestRequestID_IsStableAcrossCopiesAndStorage(t *testing.T) {
+	request := Request{
+		Timestamp: time.Date(2026, 10, 16, 10, 0, 0, 123456789, time.FixedZone("CEST", 2*60*60)),
+		Event:     contract.EventTypeRenderVolumeChanged,
+		Data:      contract.VolumeChange{DeviceRef: contract.DeviceRef{HostName: "host-1", PnpID: "spk"}, Volume: 40},
+	}
+
+	// The outbox keeps the timestamp in UTC and the data as string fields.
+	data, err := contract.ParseEvent(request.Event, contract.Fields(request.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := Request{Timestamp: request.Timestamp.UTC(), Event: request.Event, Data: data}
+
+	if request.ID() != restored.ID() {
+		t.Fatalf("expected the same ID after storage, got %s and %s", request.ID(), restored.ID())
+	}
+	if len(request.ID()) != 32 {
+		t.Fatalf("expected 32 hex characters, got %q", request.ID())
+	}
+
+	changed := restored
+	changed.Data = contract.VolumeChange{DeviceRef: contract.DeviceRef{HostName: "host-1", PnpID: "spk"}, Volume: 41}
+	if changed.ID() == request.ID() {
+		t.Fatal("expected a different ID for a different request")
+	}
+}
+
+func TestRequestValidate(t *testing.T) {
+	host := contract.DeviceRef{HostName: "host-1"}
+	tests := []struct {
+		name    string
+		request Request
+		want    string
+	}{
+		{"no data", Request{Event: contract.EventTypeRenderMuteChanged}, "no event data"},
+		{"wrong kind", Request{Event: contract.EventTypeRenderMuteChanged, Data: contract.VolumeChange{DeviceRef: host}}, "unexpected event data contract.VolumeChange"},
+		{"missing host", Request{Event: contract.EventTypeRenderDeviceDetached, Data: contract.DeviceDetached{DeviceRef: contract.DeviceRef{PnpID: "spk"}}}, "missing hostName"},
+		{"missing pnpId", Request{Event: contract.EventTypeCaptureDeviceConfirmed, Data: contract.DeviceSnapshot{DeviceRef: host}}, "missing pnpId"},
+		{"volume range", Request{Event: contract.EventTypeCaptureVolumeChanged, Data: contract.VolumeChange{DeviceRef: host, Volume: 1001}}, "volume 1001 is outside 0 .. 1000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.request.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected an error mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	valid := Request{Event: contract.EventTypeRenderVolumeChanged, Data: contract.VolumeChange{DeviceRef: host, Volume: 0}}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("a volume change before the device is known is valid, got %v", err)
+	}
+}
+
+func TestRequestValidate_AcceptsTheNativeVolumeScale(t *testing.T) {
+	host := contract.DeviceRef{HostName: "host-1", PnpID: "spk"}
+	for _, request := range []Request{
+		{Event: contract.EventTypeRenderVolumeChanged, Data: contract.VolumeChange{DeviceRef: host, Volume: 750}},
+		{Event: contract.EventTypeRenderDeviceConfirmed, Data: contract.DeviceSnapshot{DeviceRef: host, RenderVolume: 750, CaptureVolume: 1000}},
+	} {
+		if err := request.Validate(); err != nil {
+			t.Fatalf("%s: %v", request.Event, err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package enqueuer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+)
+
+// RestRequest is a Request shaped as the call to the device repository REST API.
+type RestRequest struct {
+	Method      string
+	URLSuffix   string
+	FlowType    contract.FlowType
+	MessageType contract.MessageType
+	// Payload holds the body fields, without the transport fields httpRequest and urlSuffix.
+	Payload map[string]any
+}
+
+// NewRestRequest computes method, URL suffix and body of the REST call for a valid request.
+func NewRestRequest(request Request) RestRequest {
+	payload := map[string]any{}
+	if request.Data != nil {
+		payload = request.Data.Values()
+	}
+
+	flowType, messageType := calculateFlowAndMessageType(request.Event)
+	payload[contract.FieldDeviceMessageType] = messageType
+
+	httpRequest, urlSuffix := resolveHttpRequest(request, payload)
+
+	if httpRequest == "POST" {
+		if flowType != 0 {
+			payload[contract.FieldFlowType] = flowType
+		}
+	}
+	if _, ok := payload[contract.FieldUpdateDate]; !ok && !request.Timestamp.IsZero() {
+		payload[contract.FieldUpdateDate] = request.Timestamp.UTC().Format(time.RFC3339)
+	}
+
+	return RestRequest{
+		Method:      httpRequest,
+		URLSuffix:   urlSuffix,
+		FlowType:    flowType,
+		MessageType: messageType,
+		Payload:     payload,
+	}
+}
+
+func resolveHttpRequest(request Request, payload map[string]any) (string, string) {
+	var httpRequest string
+
+	switch request.Event {
+	case contract.EventTypeRenderDeviceDiscovered,
+		contract.EventTypeCaptureDeviceDiscovered,
+		contract.EventTypeRenderDeviceConfirmed,
+		contract.EventTypeCaptureDeviceConfirmed:
+		httpRequest = "POST"
+	default:
+		httpRequest = "PUT"
+	}
+
+	var urlSuffix string
+	if httpRequest == "PUT" {
+		var ref contract.DeviceRef
+		if request.Data != nil {
+			ref = request.Data.Ref()
+		}
+
+		urlSuffix = fmt.Sprintf("/%s/%s", ref.PnpID, ref.HostName)
+		delete(payload, contract.FieldHostName) // contract.FieldHostName is only used for building the URL suffix, so we must remove it from the payload
+	}
+
+	return httpRequest, urlSuffix
+}
+
+func calculateFlowAndMessageType(event contract.EventType) (contract.FlowType, contract.MessageType) {
+
+	var flow contract.FlowType
+	var message contract.MessageType
+
+	switch event {
+	case contract.EventTypeRenderDeviceConfirmed, contract.EventTypeRenderDeviceDiscovered, contract.EventTypeRenderVolumeChanged,
+		contract.EventTypeRenderDeviceDetached, contract.EventTypeDefaultRenderChanged, contract.EventTypeRenderMuteChanged:
+		flow = contract.FlowTypeRender
+	case contract.EventTypeCaptureDeviceConfirmed, contract.EventTypeCaptureDeviceDiscovered, contract.EventTypeCaptureVolumeChanged,
+		contract.EventTypeCaptureDeviceDetached, contract.EventTypeDefaultCaptureChanged, contract.EventTypeCaptureMuteChanged:
+		flow = contract.FlowTypeCapture
+	default:
+		flow = 0
+	}
+
+	switch event {
+	case contract.EventTypeRenderDeviceConfirmed, contract.EventTypeCaptureDeviceConfirmed:
+		message = contract.MessageTypeConfirmed
+	case contract.EventTypeRenderDeviceDiscovered, contract.EventTypeCaptureDeviceDiscovered:
+		message = contract.MessageTypeDiscovered
+	case contract.EventTypeRenderDeviceDetached, contract.EventTypeCaptureDeviceDetached:
+		message = contract.MessageTypeDetached
+	case contract.EventTypeDefaultRenderChanged:
+		message = contract.MessageTypeDefaultRenderChanged
+	case contract.EventTypeDefaultCaptureChanged:
+		message = contract.MessageTypeDefaultCaptureChanged
+	case contract.EventTypeRenderVolumeChanged:
+		message = contract.MessageTypeVolumeRenderChanged
+	case contract.EventTypeCaptureVolumeChanged:
+		message = contract.MessageTypeVolumeCaptureChanged
+	case contract.EventTypeRenderMuteChanged:
+		message = contract.MessageTypeMuteRenderChanged
+	case contract.EventTypeCaptureMuteChanged:
+		message = contract.MessageTypeMuteCaptureChanged
+	default:
+		message = 0
+	}
+
+	return flow, message
+}
@@ -0,0 +1,80 @@
+package enqueuer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+)
+
+func TestNewRestRequest_DeviceIsPosted(t *testing.T) {
+	r := NewRestRequest(Request{
+		Timestamp: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Event:     contract.EventTypeCaptureDeviceConfirmed,
+		Data: contract.DeviceSnapshot{
+			DeviceRef:     contract.DeviceRef{HostName: "host-1", PnpID: "mic"},
+			CaptureVolume: 70,
+		},
+	})
+
+	if r.Method != "POST" || r.URLSuffix != "" {
+		t.Fatalf("unexpected method=%s urlSuffix=%q", r.Method, r.URLSuffix)
+	}
+	if r.Payload[contract.FieldFlowType] != contract.FlowTypeCapture || r.Payload[contract.FieldCaptureVolume] != 70 {
+		t.Fatalf("unexpected payload %v", r.Payload)
+	}
+	if r.Payload[contract.FieldHostName] != "host-1" || r.Payload[contract.FieldUpdateDate] != "2026-01-02T03:04:05Z" {
+		t.Fatalf("unexpected payload %v", r.Payload)
+	}
+}
+
+func TestNewRestRequest_DetachedIsPut(t *testing.T) {
+	r := NewRestRequest(Request{
+		Event: contract.EventTypeRenderDeviceDetached,
+		Data:  contract.DeviceDetached{DeviceRef: contract.DeviceRef{HostName: "host-1", PnpID: "speakers"}},
+	})
+
+	if r.Method != "PUT" || r.URLSuffix != "/speakers/host-1" {
+		t.Fatalf("unexpected method=%s urlSuffix=%q", r.Method, r.URLSuffix)
+	}
+	if r.Payload[contract.FieldDeviceMessageType] != contract.MessageTypeDetached {
+		t.Fatalf("unexpected message type %v", r.Payload[contract.FieldDeviceMessageType])
+	}
+	if _, ok := r.Payload[contract.FieldHostName]; ok {
+		t.Fatalf("hostName must only be part of the URL suffix, got %v", r.Payload)
+	}
+}
+
+func TestNewRestRequest_DefaultChangedIsPutToNewDevice(t *testing.T) {
+	r := NewRestRequest(Request{
+		Event: contract.EventTypeDefaultCaptureChanged,
+		Data: contract.DefaultChange{
+			DeviceRef:     contract.DeviceRef{HostName: "host-1", PnpID: "webcam-mic"},
+			PreviousPnpID: "mic",
+		},
+	})
+
+	if r.Method != "PUT" || r.URLSuffix != "/webcam-mic/host-1" || r.FlowType != contract.FlowTypeCapture {
+		t.Fatalf("unexpected method=%s urlSuffix=%q flow=%d", r.Method, r.URLSuffix, r.FlowType)
+	}
+	if r.Payload[contract.FieldDeviceMessageType] != contract.MessageTypeDefaultCaptureChanged || r.Payload[contract.FieldPreviousPnpID] != "mic" {
+		t.Fatalf("unexpected payload %v", r.Payload)
+	}
+}
+
+func TestNewRestRequest_MuteChangedIsPutWithBoolean(t *testing.T) {
+	r := NewRestRequest(Request{
+		Event: contract.EventTypeRenderMuteChanged,
+		Data: contract.MuteChange{
+			DeviceRef: contract.DeviceRef{HostName: "host-1", PnpID: "speakers"},
+			Muted:     true,
+		},
+	})
+
+	if r.Method != "PUT" || r.URLSuffix != "/speakers/host-1" || r.FlowType != contract.FlowTypeRender {
+		t.Fatalf("unexpected method=%s urlSuffix=%q flow=%d", r.Method, r.URLSuffix, r.FlowType)
+	}
+	if r.Payload[contract.FieldDeviceMessageType] != contract.MessageTypeMuteRenderChanged || r.Payload[contract.FieldMuted] != true {
+		t.Fatalf("unexpected payload %v", r.Payload)
+	}
+}
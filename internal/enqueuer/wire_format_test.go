@@ -0,0 +1,100 @@
+package enqueuer
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	c "github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/wire")
+
+// The golden files hold the flat message body as produced before the events were typed;
+// the typed events must keep producing it byte for byte.
+func TestWireFormat_MatchesGoldenFiles(t *testing.T) {
+	at := time.Date(2026, 10, 16, 8, 30, 0, 0, time.UTC)
+	studio := func(pnpID string) c.DeviceRef { return c.DeviceRef{HostName: "studio-pc", PnpID: pnpID} }
+	muted, unmuted := true, false
+	low, high := 30, 60
+
+	tests := []struct {
+		name    string
+		request Request
+	}{
+		{"render_device_discovered", Request{Timestamp: at, Event: c.EventTypeRenderDeviceDiscovered, Data: c.DeviceSnapshot{
+			DeviceRef: studio("{0.0.0.00000000}.{b3f8fa53}"), UpdateDate: at, Name: "Speakers (Realtek(R) Audio)",
+			RenderVolume: 40, OperationSystemName: "Windows 11 Pro 23H2", IsDefault: true, RenderMuted: &unmuted, CaptureMuted: &unmuted,
+		}}},
+		{"capture_device_confirmed", Request{Timestamp: at, Event: c.EventTypeCaptureDeviceConfirmed, Data: c.DeviceSnapshot{
+			DeviceRef: studio("{0.0.1.00000000}.{9a1c}"), UpdateDate: at, Name: "Microphone <USB>",
+			CaptureVolume: 75, OperationSystemName: "Windows 10",
+		}}},
+		{"render_volume_changed", Request{Timestamp: at, Event: c.EventTypeRenderVolumeChanged, Data: c.VolumeChange{
+			DeviceRef: studio("{0.0.0.00000000}.{b3f8fa53}"), UpdateDate: at, Volume: 45, VolumeMin: &low, VolumeMax: &high,
+		}}},
+		{"capture_volume_changed", Request{Timestamp: at, Event: c.EventTypeCaptureVolumeChanged, Data: c.VolumeChange{
+			DeviceRef: studio("mic"), UpdateDate: at, Volume: 100,
+		}}},
+		{"render_mute_changed", Request{Timestamp: at, Event: c.EventTypeRenderMuteChanged, Data: c.MuteChange{
+			DeviceRef: studio("speakers"), UpdateDate: at, Muted: muted,
+		}}},
+		{"capture_device_detached", Request{Timestamp: at, Event: c.EventTypeCaptureDeviceDetached, Data: c.DeviceDetached{
+			DeviceRef: studio("mic"), UpdateDate: at, IsDefault: true,
+		}}},
+		{"default_render_changed", Request{Timestamp: at, Event: c.EventTypeDefaultRenderChanged, Data: c.DefaultChange{
+			DeviceRef: studio("headset"), UpdateDate: at, PreviousPnpID: "speakers",
+		}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.request.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			got := wireBody(t, tt.request)
+
+			// What the outbox stores must read back into the same body.
+			data, err := c.ParseEvent(tt.request.Event, c.Fields(tt.request.Data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			restored := tt.request
+			restored.Data = data
+			if again := wireBody(t, restored); !bytes.Equal(again, got) {
+				t.Fatalf("body changed after the outbox round trip\n got: %s\nwant: %s", again, got)
+			}
+
+			path := filepath.Join("testdata", "wire", tt.name+".json")
+			if *update {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("wire format changed\n got: %s\nwant: %s", got, want)
+			}
+		})
+	}
+}
+
+// wireBody is the flat message body: the REST payload with the transport fields.
+func wireBody(t *testing.T, request Request) []byte {
+	t.Helper()
+	rest := NewRestRequest(request)
+	rest.Payload[c.FieldHTTPRequest] = rest.Method
+	rest.Payload[c.FieldURLSuffix] = rest.URLSuffix
+	body, err := json.Marshal(rest.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(body, '\n')
+}
@@ -0,0 +1,198 @@
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/logging"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/restapi"
+)
+
+const (
+	defaultRetryDelay    = 1 * time.Second
+	defaultMaxRetryDelay = 60 * time.Second
+)
+
+// Sender performs one REST call against the device repository API; restapi.Client implements it.
+type Sender interface {
+	Send(ctx context.Context, method, urlSuffix string, body []byte) error
+}
+
+// restCall is a request message decoded into the REST call it describes.
+type restCall struct {
+	method    string
+	urlSuffix string
+	body      []byte
+}
+
+// Forwarder turns request messages produced by RabbitMqEnqueuer into REST calls.
+// Messages are acked after success, dead-lettered (nack without requeue) on permanent failures
+// and retried in place on transient ones, which keeps the queue order.
+type Forwarder struct {
+	sender        Sender
+	logger        logging.Logger
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+}
+
+func NewForwarder(sender Sender, logger logging.Logger) *Forwarder {
+	if sender == nil {
+		panic("nil sender")
+	}
+	if logger == nil {
+		panic("nil logger")
+	}
+
+	return &Forwarder{
+		sender:        sender,
+		logger:        logger,
+		retryDelay:    defaultRetryDelay,
+		maxRetryDelay: defaultMaxRetryDelay,
+	}
+}
+
+// Run forwards deliveries until the channel is closed or ctx is done.
+func (f *Forwarder) Run(ctx context.Context, deliveries <-chan amqp.Delivery) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case d, ok := <-deliveries:
+			if !ok {
+				return nil
+			}
+			f.handle(ctx, d)
+		}
+	}
+}
+
+func (f *Forwarder) handle(ctx context.Context, d amqp.Delivery) {
+	call, err := decodeMessage(d.Body)
+	if err != nil {
+		f.logf("[error, forwarder] dead-lettering malformed message deliveryTag=%d: %v", d.DeliveryTag, err)
+		f.settle(d.Nack(false, false))
+		return
+	}
+
+	delay := f.retryDelay
+	for {
+		err := f.sender.Send(ctx, call.method, call.urlSuffix, call.body)
+		if err == nil {
+			f.logf("[info, forwarder] forwarded method=%s urlSuffix=%s", call.method, call.urlSuffix)
+			f.settle(d.Ack(false))
+			return
+		}
+		if ctx.Err() != nil {
+			f.settle(d.Nack(false, true))
+			return
+		}
+		if !restapi.IsTemporary(err) {
+			f.logf("[error, forwarder] dead-lettering method=%s urlSuffix=%s: %v", call.method, call.urlSuffix, err)
+			f.settle(d.Nack(false, false))
+			return
+		}
+
+		f.logf("[warn, forwarder] method=%s urlSuffix=%s failed, retrying in %s: %v", call.method, call.urlSuffix, delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			f.settle(d.Nack(false, true))
+			return
+		case <-timer.C:
+		}
+		delay = min(delay*2, f.maxRetryDelay)
+	}
+}
+
+func (f *Forwarder) settle(err error) {
+	if err != nil {
+		f.logf("[error, forwarder] acknowledgement failed: %v", err)
+	}
+}
+
+func (f *Forwarder) logf(format string, args ...interface{}) {
+	f.logger.Printf(format, args...)
+}
+
+// decodeMessage reads the transport fields httpRequest, urlSuffix and flowType and strips the
+// first two from the body, mirroring what the RmqToRestApiForwarder sends to the REST API.
+// A v2 envelope is unwrapped to its payload, which is the flat v1 body.
+func decodeMessage(raw []byte) (restCall, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var payload map[string]any
+	if err := decoder.Decode(&payload); err != nil {
+		return restCall{}, fmt.Errorf("decode body: %w", err)
+	}
+	if payload == nil {
+		return restCall{}, errors.New("body is not a JSON object")
+	}
+	if version, ok := payload[contract.FieldSchemaVersion]; ok {
+		inner, err := envelopePayload(version, payload[contract.FieldPayload])
+		if err != nil {
+			return restCall{}, err
+		}
+		payload = inner
+	}
+
+	method, _ := payload[contract.FieldHTTPRequest].(string)
+	method = strings.ToUpper(strings.TrimSpace(method))
+	switch method {
+	case "POST", "PUT":
+	default:
+		return restCall{}, fmt.Errorf("unsupported %s %q", contract.FieldHTTPRequest, method)
+	}
+
+	urlSuffix, _ := payload[contract.FieldURLSuffix].(string)
+	urlSuffix = strings.TrimSpace(urlSuffix)
+	if urlSuffix != "" && !strings.HasPrefix(urlSuffix, "/") {
+		return restCall{}, fmt.Errorf("%s %q must start with /", contract.FieldURLSuffix, urlSuffix)
+	}
+	if method == "PUT" && urlSuffix == "" {
+		return restCall{}, fmt.Errorf("PUT requires %s", contract.FieldURLSuffix)
+	}
+
+	if v, ok := payload[contract.FieldFlowType]; ok {
+		n, isNumber := v.(json.Number)
+		if !isNumber {
+			return restCall{}, fmt.Errorf("invalid %s %v", contract.FieldFlowType, v)
+		}
+		switch n.String() {
+		case "1", "2":
+		default:
+			return restCall{}, fmt.Errorf("invalid %s %s", contract.FieldFlowType, n)
+		}
+	}
+
+	delete(payload, contract.FieldHTTPRequest)
+	delete(payload, contract.FieldURLSuffix)
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return restCall{}, fmt.Errorf("encode body: %w", err)
+	}
+	return restCall{method: method, urlSuffix: urlSuffix, body: body}, nil
+}
+
+func envelopePayload(version, payload any) (map[string]any, error) {
+	n, _ := version.(json.Number)
+	if n.String() != strconv.Itoa(contract.SchemaVersionEnvelope) {
+		return nil, fmt.Errorf("unsupported %s %v", contract.FieldSchemaVersion, version)
+	}
+	inner, ok := payload.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("envelope %s is not a JSON object", contract.FieldPayload)
+	}
+	return inner, nil
+}
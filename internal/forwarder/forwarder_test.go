@@ -0,0 +1,172 @@
+package forwarder
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/restapi"
+)
+
+type settlement struct {
+	tag     uint64
+	ack     bool
+	requeue bool
+}
+
+type fakeAcknowledger struct {
+	mu      sync.Mutex
+	settled []settlement
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, _ bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.settled = append(a.settled, settlement{tag: tag, ack: true})
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(tag uint64, _ bool, requeue bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.settled = append(a.settled, settlement{tag: tag, requeue: requeue})
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+type receivedCall struct {
+	method string
+	path   string
+	body   map[string]any
+}
+
+func runForwarder(t *testing.T, handler http.HandlerFunc, bodies ...string) ([]settlement, []receivedCall) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var calls []receivedCall
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		calls = append(calls, receivedCall{method: r.Method, path: r.URL.EscapedPath(), body: body})
+		mu.Unlock()
+		handler(w, r)
+	}))
+	defer server.Close()
+
+	logger := log.New(io.Discard, "", 0)
+	client := restapi.NewClient(restapi.Config{BaseURL: server.URL, MaxAttempts: 1}, logger)
+	f := NewForwarder(client, logger)
+	f.retryDelay = time.Millisecond
+
+	ack := &fakeAcknowledger{}
+	deliveries := make(chan amqp.Delivery, len(bodies))
+	for i, body := range bodies {
+		deliveries <- amqp.Delivery{Acknowledger: ack, DeliveryTag: uint64(i + 1), Body: []byte(body)}
+	}
+	close(deliveries)
+
+	if err := f.Run(context.Background(), deliveries); err != nil {
+		t.Fatal(err)
+	}
+	return ack.settled, calls
+}
+
+func TestForwarder_PostAndPutAreAcked(t *testing.T) {
+	settled, calls := runForwarder(t,
+		func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) },
+		`{"httpRequest":"POST","urlSuffix":"","flowType":1,"name":"Speakers","renderVolume":40}`,
+		`{"httpRequest":"PUT","urlSuffix":"/pnp-1/host-1","volume":70,"deviceMessageType":3}`,
+	)
+
+	if len(settled) != 2 || !settled[0].ack || !settled[1].ack {
+		t.Fatalf("expected both deliveries acked, got %+v", settled)
+	}
+	if calls[0].method != http.MethodPost || calls[0].path != "/" {
+		t.Fatalf("unexpected first call %s %s", calls[0].method, calls[0].path)
+	}
+	if calls[1].method != http.MethodPut || calls[1].path != "/pnp-1/host-1" {
+		t.Fatalf("unexpected second call %s %s", calls[1].method, calls[1].path)
+	}
+	if _, ok := calls[0].body["httpRequest"]; ok {
+		t.Fatalf("transport field forwarded in body %v", calls[0].body)
+	}
+	if calls[0].body["flowType"] != float64(1) || calls[1].body["volume"] != float64(70) {
+		t.Fatalf("unexpected bodies %v %v", calls[0].body, calls[1].body)
+	}
+}
+
+func TestForwarder_EnvelopesAreUnwrapped(t *testing.T) {
+	settled, calls := runForwarder(t,
+		func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) },
+		`{"schemaVersion":2,"eventId":"e1","eventType":"RenderVolumeChanged","payload":{"httpRequest":"PUT","urlSuffix":"/pnp-1/host-1","volume":70}}`,
+		`{"schemaVersion":2,"eventId":"e2","payload":{"httpRequest":"POST","urlSuffix":"","name":"Mic"},"httpRequest":"POST","urlSuffix":"","name":"Mic"}`,
+		`{"schemaVersion":3,"payload":{"httpRequest":"POST"}}`,
+	)
+
+	if len(settled) != 3 || !settled[0].ack || !settled[1].ack || settled[2].ack || settled[2].requeue {
+		t.Fatalf("expected two acks and one dead-lettered message, got %+v", settled)
+	}
+	if calls[0].method != http.MethodPut || calls[0].path != "/pnp-1/host-1" || calls[0].body["volume"] != float64(70) {
+		t.Fatalf("unexpected first call %s %s %v", calls[0].method, calls[0].path, calls[0].body)
+	}
+	if _, ok := calls[1].body["eventId"]; ok || calls[1].body["name"] != "Mic" {
+		t.Fatalf("expected only the payload to be forwarded, got %v", calls[1].body)
+	}
+}
+
+func TestForwarder_PermanentFailuresAreDeadLettered(t *testing.T) {
+	settled, calls := runForwarder(t,
+		func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusBadRequest) },
+		`not json`,
+		`{"httpRequest":"DELETE","urlSuffix":"/x/y"}`,
+		`{"httpRequest":"POST","flowType":7}`,
+		`{"httpRequest":"POST","flowType":2,"name":"Mic"}`,
+	)
+
+	if len(calls) != 1 {
+		t.Fatalf("expected only the valid message to reach the API, got %d calls", len(calls))
+	}
+	for _, s := range settled {
+		if s.ack || s.requeue {
+			t.Fatalf("expected nack without requeue, got %+v", settled)
+		}
+	}
+	if len(settled) != 4 {
+		t.Fatalf("expected 4 settlements, got %+v", settled)
+	}
+}
+
+func TestForwarder_TransientFailuresAreRetried(t *testing.T) {
+	var attempts atomic.Int32
+	settled, calls := runForwarder(t,
+		func(w http.ResponseWriter, r *http.Request) {
+			if attempts.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		},
+		`{"httpRequest":"PUT","urlSuffix":"/pnp-1/host-1","volume":10}`,
+	)
+
+	if len(calls) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(calls))
+	}
+	if len(settled) != 1 || !settled[0].ack {
+		t.Fatalf("expected a single ack, got %+v", settled)
+	}
+}
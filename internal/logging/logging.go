@@ -3,9 +3,6 @@ package logging
 import (
 	"log"
 	"os"
-	"strings"
-
-	"github.com/collect-sound-devices/sound-win-scanner/v4/pkg/soundlibwrap"
 )
 
 // Logger is the minimal interface needed for logging in this project.
@@ -30,26 +27,3 @@ func PrintInfo(logger Logger, format string, v ...interface{}) {
 func PrintError(logger Logger, format string, v ...interface{}) {
 	logger.Printf("[error] "+format, v...)
 }
-
-// AttachSoundlibwrapBridge forwards soundlibwrap log messages into the provided logger.
-// The logger should typically have no flags/prefix so the embedded timestamp is preserved.
-func AttachSoundlibwrapBridge(logger Logger, prefix string) {
-	if prefix == "" {
-		prefix = "cpp backend"
-	}
-
-	soundlibwrap.SetLogHandler(func(timestamp, level, content string) {
-		lvl := strings.ToLower(level)
-		levelTag := "info"
-		switch lvl {
-		case "trace", "debug":
-			levelTag = "debug"
-		case "warn", "warning":
-			levelTag = "warn"
-		case "error", "critical":
-			levelTag = "error"
-		}
-
-		logger.Printf("%s [%s %s] %s", timestamp, prefix, levelTag, content)
-	})
-}
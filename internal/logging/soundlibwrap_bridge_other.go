@@ -0,0 +1,6 @@
+//go:build !windows || !cgo
+
+package logging
+
+// AttachSoundlibwrapBridge is a no-op where the native sound library is not available.
+func AttachSoundlibwrapBridge(_ Logger, _ string) {}
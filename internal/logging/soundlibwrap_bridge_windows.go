@@ -0,0 +1,32 @@
+//go:build windows && cgo
+
+package logging
+
+import (
+	"strings"
+
+	"github.com/collect-sound-devices/sound-win-scanner/v4/pkg/soundlibwrap"
+)
+
+// AttachSoundlibwrapBridge forwards soundlibwrap log messages into the provided logger.
+// The logger should typically have no flags/prefix so the embedded timestamp is preserved.
+func AttachSoundlibwrapBridge(logger Logger, prefix string) {
+	if prefix == "" {
+		prefix = "cpp backend"
+	}
+
+	soundlibwrap.SetLogHandler(func(timestamp, level, content string) {
+		lvl := strings.ToLower(level)
+		levelTag := "info"
+		switch lvl {
+		case "trace", "debug":
+			levelTag = "debug"
+		case "warn", "warning":
+			levelTag = "warn"
+		case "error", "critical":
+			levelTag = "error"
+		}
+
+		logger.Printf("%s [%s %s] %s", timestamp, prefix, levelTag, content)
+	})
+}
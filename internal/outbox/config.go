@@ -0,0 +1,139 @@
+package outbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDirName          = "outbox"
+	defaultServiceDirName   = "WinSoundScanner"
+	defaultMaxBytes         = 64 << 20
+	defaultMaxSegmentBytes  = 1 << 20
+	defaultMaxAge           = 7 * 24 * time.Hour
+	defaultInitialRetryWait = 1 * time.Second
+	defaultMaxRetryWait     = 60 * time.Second
+)
+
+// Config defines where the outbox stores its segments and how much it may keep.
+type Config struct {
+	Enabled          bool
+	Dir              string
+	MaxBytes         int64
+	MaxSegmentBytes  int64
+	MaxAge           time.Duration
+	InitialRetryWait time.Duration
+	MaxRetryWait     time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Enabled:          true,
+		MaxBytes:         defaultMaxBytes,
+		MaxSegmentBytes:  defaultMaxSegmentBytes,
+		MaxAge:           defaultMaxAge,
+		InitialRetryWait: defaultInitialRetryWait,
+		MaxRetryWait:     defaultMaxRetryWait,
+	}
+}
+
+func (c Config) withDefaults() Config {
+	d := DefaultConfig()
+
+	if c.MaxBytes <= 0 {
+		c.MaxBytes = d.MaxBytes
+	}
+	if c.MaxSegmentBytes <= 0 {
+		c.MaxSegmentBytes = d.MaxSegmentBytes
+	}
+	if c.MaxSegmentBytes > c.MaxBytes {
+		c.MaxSegmentBytes = c.MaxBytes
+	}
+	if c.MaxAge <= 0 {
+		c.MaxAge = d.MaxAge
+	}
+	if c.InitialRetryWait <= 0 {
+		c.InitialRetryWait = d.InitialRetryWait
+	}
+	if c.MaxRetryWait <= 0 {
+		c.MaxRetryWait = d.MaxRetryWait
+	}
+	if c.MaxRetryWait < c.InitialRetryWait {
+		c.MaxRetryWait = c.InitialRetryWait
+	}
+
+	return c
+}
+
+// LoadConfigFromEnv loads outbox configuration from environment variables.
+// Empty values are replaced by defaults; the directory defaults to %ProgramData%\WinSoundScanner\outbox,
+// or below the user cache directory where there is no ProgramData, e.g. simulated runs off Windows.
+func LoadConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
+
+	if v := strings.ToLower(strings.TrimSpace(os.Getenv("WIN_SOUND_OUTBOX"))); v != "" {
+		switch v {
+		case "on", "true", "1":
+			cfg.Enabled = true
+		case "off", "false", "0":
+			cfg.Enabled = false
+		default:
+			return Config{}, fmt.Errorf("invalid WIN_SOUND_OUTBOX %q (supported: on, off)", v)
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("WIN_SOUND_OUTBOX_DIR")); v != "" {
+		cfg.Dir = v
+	}
+	if v := strings.TrimSpace(os.Getenv("WIN_SOUND_OUTBOX_MAX_MB")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid WIN_SOUND_OUTBOX_MAX_MB %q: %w", v, err)
+		}
+		if n < 0 {
+			return Config{}, fmt.Errorf("WIN_SOUND_OUTBOX_MAX_MB can not be negative %q", v)
+		}
+		cfg.MaxBytes = int64(n) << 20
+	}
+	if v := strings.TrimSpace(os.Getenv("WIN_SOUND_OUTBOX_MAX_AGE_HOURS")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid WIN_SOUND_OUTBOX_MAX_AGE_HOURS %q: %w", v, err)
+		}
+		if n < 0 {
+			return Config{}, fmt.Errorf("WIN_SOUND_OUTBOX_MAX_AGE_HOURS can not be negative %q", v)
+		}
+		cfg.MaxAge = time.Duration(n) * time.Hour
+	}
+
+	if cfg.Enabled && cfg.Dir == "" {
+		cfg.Dir = filepath.Join(defaultBaseDir(), defaultServiceDirName, defaultDirName)
+	}
+
+	return cfg.withDefaults(), nil
+}
+
+// defaultBaseDir returns ProgramData, else the user cache directory, else the temp directory.
+func defaultBaseDir() string {
+	if dir, err := programDataDir(); err == nil {
+		return dir
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		return dir
+	}
+	return os.TempDir()
+}
+
+func programDataDir() (string, error) {
+	if v, ok := os.LookupEnv("ProgramData"); ok && strings.TrimSpace(v) != "" {
+		return v, nil
+	}
+	if v, ok := os.LookupEnv("ALLUSERSPROFILE"); ok && strings.TrimSpace(v) != "" {
+		return v, nil
+	}
+	return "", errors.New("ProgramData is not available in environment")
+}
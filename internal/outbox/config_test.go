@@ -0,0 +1,26 @@
+package outbox
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigFromEnv_DirWithoutProgramData(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("ProgramData", "")
+	t.Setenv("ALLUSERSPROFILE", "")
+	t.Setenv("XDG_CACHE_HOME", cache)
+	t.Setenv("HOME", cache)
+	t.Setenv("LocalAppData", cache)
+	t.Setenv("WIN_SOUND_OUTBOX_DIR", "")
+
+	cfg, err := LoadConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(cache, defaultServiceDirName, defaultDirName)
+	if !cfg.Enabled || !strings.HasSuffix(cfg.Dir, want[len(cache):]) || !strings.HasPrefix(cfg.Dir, cache) {
+		t.Fatalf("expected the outbox enabled below the user cache directory %s, got %+v", cache, cfg)
+	}
+}
@@ -0,0 +1,771 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/enqueuer"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/logging"
+)
+
+const (
+	segmentFileExt  = ".seg"
+	cursorFileName  = "cursor.json"
+	recordHeaderLen = 8
+	maxRecordBytes  = 1 << 20
+)
+
+var errClosed = errors.New("outbox is closed")
+
+// storedRequest is the on-disk form of an enqueuer.Request.
+type storedRequest struct {
+	Timestamp time.Time          `json:"timestamp"`
+	Event     contract.EventType `json:"event"`
+	Fields    map[string]string  `json:"fields,omitempty"`
+}
+
+// position addresses a record inside the segment files.
+type position struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+type segment struct {
+	id   uint64
+	size int64
+}
+
+// Outbox is a durable enqueuer: requests are appended to segment files and acknowledged
+// immediately, then delivered in order to the wrapped enqueuer by a background goroutine.
+// Delivery is at-least-once; a crash between delivery and the cursor update repeats the last request.
+type Outbox struct {
+	cfg    Config
+	next   enqueuer.EnqueueRequest
+	logger logging.Logger
+	now    func() time.Time
+	// onDrop is called when undelivered requests are dropped; see SetDropHandler.
+	onDrop atomic.Pointer[func()]
+
+	mu       sync.Mutex
+	segments []segment // ordered by id, the last one is the active segment
+	active   *os.File
+	cursor   position
+	closed   bool
+
+	wake   chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewOutbox(ctx context.Context, cfg Config, next enqueuer.EnqueueRequest, logger logging.Logger) (*Outbox, error) {
+	if ctx == nil {
+		panic("nil context")
+	}
+	if next == nil {
+		panic("nil next enqueuer")
+	}
+	if logger == nil {
+		panic("nil logger")
+	}
+
+	o := newOutbox(cfg, next, logger, time.Now)
+	if err := o.open(); err != nil {
+		if o.active != nil {
+			_ = o.active.Close()
+		}
+		return nil, err
+	}
+
+	drainCtx, cancel := context.WithCancel(ctx)
+	o.cancel = cancel
+	go o.drainLoop(drainCtx)
+
+	return o, nil
+}
+
+func newOutbox(cfg Config, next enqueuer.EnqueueRequest, logger logging.Logger, now func() time.Time) *Outbox {
+	return &Outbox{
+		cfg:    cfg.withDefaults(),
+		next:   next,
+		logger: logger,
+		now:    now,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+// EnqueueRequest persists the request and returns; delivery happens asynchronously.
+func (o *Outbox) EnqueueRequest(request enqueuer.Request) error {
+	payload, err := json.Marshal(storedRequest{
+		Timestamp: request.Timestamp,
+		Event:     request.Event,
+		Fields:    contract.Fields(request.Data),
+	})
+	if err != nil {
+		return fmt.Errorf("marshal outbox record: %w", err)
+	}
+	if len(payload) > maxRecordBytes {
+		return fmt.Errorf("outbox record too large: %d bytes", len(payload))
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.closed {
+		return errClosed
+	}
+	if err := o.appendLocked(encodeRecord(payload)); err != nil {
+		return err
+	}
+	o.enforceSizeCapLocked()
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// SetDropHandler registers h to be called when requests are dropped undelivered: older than MaxAge,
+// above the size cap, or unreadable. Requests the receiver rejected are not reported, sending them again
+// would fail as well. h may be called with the outbox locked and must not block.
+func (o *Outbox) SetDropHandler(h func()) {
+	o.onDrop.Store(&h)
+}
+
+func (o *Outbox) notifyDrop() {
+	if h := o.onDrop.Load(); h != nil && *h != nil {
+		(*h)()
+	}
+}
+
+// PendingBytes reports the size of the records not yet delivered.
+func (o *Outbox) PendingBytes() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.pendingBytesLocked()
+}
+
+// Close stops the drain goroutine and closes the active segment. Undelivered requests stay on disk.
+func (o *Outbox) Close() error {
+	if o.cancel != nil {
+		o.cancel()
+		<-o.done
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.closed {
+		return nil
+	}
+	o.closed = true
+	if o.active == nil {
+		return nil
+	}
+	err := errors.Join(o.active.Sync(), o.active.Close())
+	o.active = nil
+	return err
+}
+
+func (o *Outbox) open() error {
+	if strings.TrimSpace(o.cfg.Dir) == "" {
+		return errors.New("outbox directory is not configured")
+	}
+	if err := os.MkdirAll(o.cfg.Dir, 0o755); err != nil {
+		return fmt.Errorf("create outbox directory: %w", err)
+	}
+
+	ids, err := o.listSegmentIDs()
+	if err != nil {
+		return err
+	}
+	cursor, err := o.readCursor()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if id < cursor.Segment {
+			if err := os.Remove(o.segmentPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("remove delivered outbox segment: %w", err)
+			}
+			continue
+		}
+		size, err := o.recoverSegment(id)
+		if err != nil {
+			return err
+		}
+		o.segments = append(o.segments, segment{id: id, size: size})
+	}
+
+	if len(o.segments) == 0 {
+		id := cursor.Segment
+		if id == 0 {
+			id = 1
+		}
+		if err := o.createSegmentLocked(id); err != nil {
+			return err
+		}
+		cursor = position{Segment: id}
+	} else {
+		last := o.segments[len(o.segments)-1]
+		f, err := os.OpenFile(o.segmentPath(last.id), os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("open outbox segment: %w", err)
+		}
+		o.active = f
+
+		if cursor.Segment < o.segments[0].id {
+			cursor = position{Segment: o.segments[0].id}
+		}
+		if first := o.segments[0]; cursor.Segment == first.id && cursor.Offset > first.size {
+			cursor.Offset = first.size
+		}
+	}
+
+	o.cursor = cursor
+	if err := o.persistCursorLocked(); err != nil {
+		return err
+	}
+
+	if pending := o.pendingBytesLocked(); pending > 0 {
+		o.logf("[info, outbox] resuming with %d pending bytes in %s", pending, o.cfg.Dir)
+	}
+	return nil
+}
+
+func (o *Outbox) pendingBytesLocked() int64 {
+	var pending int64
+	for _, s := range o.segments {
+		if s.id == o.cursor.Segment {
+			pending += s.size - o.cursor.Offset
+		} else if s.id > o.cursor.Segment {
+			pending += s.size
+		}
+	}
+	return pending
+}
+
+// recoverSegment validates every record of a segment and truncates a torn or corrupt tail.
+func (o *Outbox) recoverSegment(id uint64) (int64, error) {
+	path := o.segmentPath(id)
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("open outbox segment: %w", err)
+	}
+
+	var valid int64
+	r := bufio.NewReader(f)
+	for {
+		_, n, err := readRecord(r)
+		if err == nil {
+			valid += n
+			continue
+		}
+		if !errors.Is(err, io.EOF) {
+			o.logf("[warn, outbox] segment %s is damaged at offset %d, truncating: %v", filepath.Base(path), valid, err)
+		}
+		break
+	}
+
+	info, statErr := f.Stat()
+	_ = f.Close()
+	if statErr != nil {
+		return 0, fmt.Errorf("stat outbox segment: %w", statErr)
+	}
+	if info.Size() != valid {
+		if err := os.Truncate(path, valid); err != nil {
+			return 0, fmt.Errorf("truncate outbox segment: %w", err)
+		}
+	}
+	return valid, nil
+}
+
+func (o *Outbox) appendLocked(frame []byte) error {
+	if o.active == nil {
+		return errClosed
+	}
+
+	last := &o.segments[len(o.segments)-1]
+	if last.size > 0 && last.size+int64(len(frame)) > o.cfg.MaxSegmentBytes {
+		if err := o.rotateLocked(); err != nil {
+			return err
+		}
+		last = &o.segments[len(o.segments)-1]
+	}
+
+	if _, err := o.active.Write(frame); err != nil {
+		_ = o.active.Truncate(last.size) // drop a partial frame so later appends stay readable
+		return fmt.Errorf("write outbox record: %w", err)
+	}
+	if err := o.active.Sync(); err != nil {
+		return fmt.Errorf("sync outbox segment: %w", err)
+	}
+	last.size += int64(len(frame))
+	return nil
+}
+
+func (o *Outbox) rotateLocked() error {
+	nextID := o.segments[len(o.segments)-1].id + 1
+	if err := o.active.Close(); err != nil {
+		return fmt.Errorf("close outbox segment: %w", err)
+	}
+	o.active = nil
+	return o.createSegmentLocked(nextID)
+}
+
+func (o *Outbox) createSegmentLocked(id uint64) error {
+	f, err := os.OpenFile(o.segmentPath(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("create outbox segment: %w", err)
+	}
+	o.active = f
+	o.segments = append(o.segments, segment{id: id})
+	return nil
+}
+
+// enforceSizeCapLocked drops the oldest segments while the outbox is above its size cap.
+// The active segment is never dropped, so the cap may be exceeded by at most one segment.
+func (o *Outbox) enforceSizeCapLocked() {
+	for len(o.segments) > 1 && o.totalBytesLocked() > o.cfg.MaxBytes {
+		oldest := o.segments[0]
+		undelivered := oldest.id >= o.cursor.Segment
+		if err := os.Remove(o.segmentPath(oldest.id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			o.logf("[error, outbox] can not remove segment %d: %v", oldest.id, err)
+			return
+		}
+		o.segments = o.segments[1:]
+
+		if undelivered {
+			o.logf("[warn, outbox] size cap %d bytes reached, dropped %d undelivered bytes", o.cfg.MaxBytes, oldest.size-o.cursorOffsetIn(oldest.id))
+			o.notifyDrop()
+			o.cursor = position{Segment: o.segments[0].id}
+			if err := o.persistCursorLocked(); err != nil {
+				o.logf("[error, outbox] %v", err)
+			}
+		}
+	}
+}
+
+func (o *Outbox) cursorOffsetIn(id uint64) int64 {
+	if o.cursor.Segment == id {
+		return o.cursor.Offset
+	}
+	return 0
+}
+
+func (o *Outbox) totalBytesLocked() int64 {
+	var total int64
+	for _, s := range o.segments {
+		total += s.size
+	}
+	return total
+}
+
+// entry is a record read at or ahead of the cursor; delivering it moves the cursor from from to to.
+type entry struct {
+	request  enqueuer.Request
+	from, to position
+	// skip marks a record that is committed without delivery, e.g. an unreadable one.
+	skip bool
+}
+
+// sentEntry is an entry handed to the next enqueuer, whose delivery is not settled yet.
+type sentEntry struct {
+	entry
+	wait func() error
+}
+
+// drainLoop delivers the records in order. With a pipelined next enqueuer up to its MaxInFlight records
+// are sent before the oldest is waited for; the cursor still only moves over records delivered in order.
+// After a failure the records sent behind the failed one are sent again, so the receiver may see them twice.
+func (o *Outbox) drainLoop(ctx context.Context) {
+	defer close(o.done)
+
+	maxInFlight := enqueuer.MaxInFlight(o.next)
+	var window []sentEntry
+	var ahead position
+	wait := o.cfg.InitialRetryWait
+	for {
+		if ctx.Err() != nil {
+			o.settle(window)
+			return
+		}
+		if len(window) == 0 {
+			ahead = o.currentCursor()
+		}
+
+		if len(window) < maxInFlight {
+			e, ok, err := o.read(ahead)
+			if err != nil {
+				o.logf("[error, outbox] read failed: %v", err)
+				o.abandon(window)
+				window = nil
+				if !sleepCtx(ctx, wait) {
+					return
+				}
+				continue
+			}
+			if ok {
+				ahead = e.to
+				window = append(window, o.send(e))
+				continue
+			}
+			if len(window) == 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-o.wake:
+				}
+				continue
+			}
+		}
+
+		head := window[0]
+		window = window[1:]
+		if err := head.wait(); err != nil {
+			if ctx.Err() != nil {
+				o.abandon(window)
+				return
+			}
+			if enqueuer.IsPermanent(err) {
+				o.logf("[error, outbox] dropping event=%d rejected by the receiver: %v", head.request.Event, err)
+			} else {
+				o.logf("[warn, outbox] delivery of event=%d failed, retrying in %s: %v", head.request.Event, wait, err)
+				o.abandon(window)
+				window = nil
+				if !sleepCtx(ctx, wait) {
+					return
+				}
+				wait = minDuration(wait*2, o.cfg.MaxRetryWait)
+				continue
+			}
+		} else if !head.skip {
+			wait = o.cfg.InitialRetryWait
+		}
+
+		if !o.commit(head.from, head.to) {
+			// The size cap moved the cursor; the entries behind are stale.
+			o.abandon(window)
+			window = nil
+		}
+	}
+}
+
+// send hands the entry to the next enqueuer, or settles it right away if it is skipped or too old.
+func (o *Outbox) send(e entry) sentEntry {
+	if e.skip {
+		return sentEntry{entry: e, wait: func() error { return nil }}
+	}
+	if age := o.now().Sub(e.request.Timestamp); !e.request.Timestamp.IsZero() && age > o.cfg.MaxAge {
+		o.logf("[warn, outbox] dropping event=%d older than %s", e.request.Event, o.cfg.MaxAge)
+		o.notifyDrop()
+		e.skip = true
+		return sentEntry{entry: e, wait: func() error { return nil }}
+	}
+	return sentEntry{entry: e, wait: enqueuer.Send(o.next, e.request)}
+}
+
+// settle commits the sent entries delivered in order before the first failure and abandons the rest.
+func (o *Outbox) settle(window []sentEntry) {
+	for i, e := range window {
+		if err := e.wait(); err != nil || !o.commit(e.from, e.to) {
+			o.abandon(window[i+1:])
+			return
+		}
+	}
+}
+
+// abandon waits for the sent entries without committing them; they are sent again from the cursor.
+func (o *Outbox) abandon(window []sentEntry) {
+	for _, e := range window {
+		_ = e.wait()
+	}
+}
+
+func (o *Outbox) currentCursor() position {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.cursor
+}
+
+// read returns the record at pos without consuming it. A record that can not be read is returned
+// as a skipped entry, so the cursor moves over it once the entries before it are delivered.
+func (o *Outbox) read(pos position) (entry, bool, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if pos == o.cursor {
+		if err := o.advanceCursorLocked(); err != nil {
+			return entry{}, false, err
+		}
+		pos = o.cursor
+	}
+
+	at := pos
+	for {
+		if o.closed || len(o.segments) == 0 {
+			return entry{}, false, nil
+		}
+
+		idx := o.segmentIndexLocked(at.Segment)
+		if idx < 0 {
+			at = position{Segment: o.segments[0].id}
+			continue
+		}
+		seg := o.segments[idx]
+
+		if at.Offset >= seg.size {
+			if idx == len(o.segments)-1 {
+				return entry{}, false, nil
+			}
+			at = position{Segment: o.segments[idx+1].id}
+			continue
+		}
+
+		stored, n, err := o.readAt(seg.id, at.Offset)
+		if err != nil {
+			o.logf("[error, outbox] skipping rest of segment %d after offset %d: %v", seg.id, at.Offset, err)
+			o.notifyDrop()
+			return entry{from: pos, to: position{Segment: seg.id, Offset: seg.size}, skip: true}, true, nil
+		}
+
+		to := position{Segment: seg.id, Offset: at.Offset + n}
+		data, err := contract.ParseEvent(stored.Event, stored.Fields)
+		if err != nil {
+			o.logf("[error, outbox] dropping unreadable request in segment %d at offset %d: %v", seg.id, at.Offset, err)
+			o.notifyDrop()
+			return entry{from: pos, to: to, skip: true}, true, nil
+		}
+		request := enqueuer.Request{
+			Timestamp: stored.Timestamp,
+			Event:     stored.Event,
+			Data:      data,
+		}
+		return entry{request: request, from: pos, to: to}, true, nil
+	}
+}
+
+// commit advances the cursor unless it was moved meanwhile, e.g. by the size cap, and reports whether it did.
+func (o *Outbox) commit(from, to position) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.cursor != from {
+		return false
+	}
+	o.cursor = to
+	if err := o.persistCursorLocked(); err != nil {
+		o.logf("[error, outbox] %v", err)
+	}
+	if err := o.removeDeliveredLocked(); err != nil {
+		o.logf("[error, outbox] %v", err)
+	}
+	return true
+}
+
+// advanceCursorLocked moves a cursor at the end of a segment to the start of the next one, and a cursor
+// in a removed segment to the oldest segment, then removes the delivered segments.
+func (o *Outbox) advanceCursorLocked() error {
+	moved := false
+	for len(o.segments) > 0 {
+		idx := o.segmentIndexLocked(o.cursor.Segment)
+		switch {
+		case idx < 0:
+			o.cursor = position{Segment: o.segments[0].id}
+		case o.cursor.Offset >= o.segments[idx].size && idx < len(o.segments)-1:
+			o.cursor = position{Segment: o.segments[idx+1].id}
+		default:
+			if moved {
+				if err := o.persistCursorLocked(); err != nil {
+					return err
+				}
+			}
+			return o.removeDeliveredLocked()
+		}
+		moved = true
+	}
+	return nil
+}
+
+// removeDeliveredLocked removes the segments before the one of the cursor.
+func (o *Outbox) removeDeliveredLocked() error {
+	for len(o.segments) > 1 && o.segments[0].id < o.cursor.Segment {
+		if err := os.Remove(o.segmentPath(o.segments[0].id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove delivered outbox segment: %w", err)
+		}
+		o.segments = o.segments[1:]
+	}
+	return nil
+}
+
+func (o *Outbox) segmentIndexLocked(id uint64) int {
+	for i, s := range o.segments {
+		if s.id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// readAt opens the segment for each read, so no handle blocks segment removal on Windows.
+func (o *Outbox) readAt(id uint64, offset int64) (storedRequest, int64, error) {
+	f, err := os.Open(o.segmentPath(id))
+	if err != nil {
+		return storedRequest{}, 0, err
+	}
+	defer f.Close()
+
+	payload, n, err := readRecord(io.NewSectionReader(f, offset, maxRecordBytes+recordHeaderLen))
+	if err != nil {
+		return storedRequest{}, 0, err
+	}
+
+	var stored storedRequest
+	if err := json.Unmarshal(payload, &stored); err != nil {
+		return storedRequest{}, 0, fmt.Errorf("decode outbox record: %w", err)
+	}
+	return stored, n, nil
+}
+
+func (o *Outbox) readCursor() (position, error) {
+	data, err := os.ReadFile(filepath.Join(o.cfg.Dir, cursorFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return position{}, nil
+	}
+	if err != nil {
+		return position{}, fmt.Errorf("read outbox cursor: %w", err)
+	}
+
+	var cursor position
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		o.logf("[warn, outbox] cursor file is damaged, restarting from the oldest segment: %v", err)
+		return position{}, nil
+	}
+	return cursor, nil
+}
+
+// persistCursorLocked replaces the cursor file atomically via a temporary file.
+func (o *Outbox) persistCursorLocked() error {
+	data, err := json.Marshal(o.cursor)
+	if err != nil {
+		return fmt.Errorf("marshal outbox cursor: %w", err)
+	}
+
+	path := filepath.Join(o.cfg.Dir, cursorFileName)
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("write outbox cursor: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("write outbox cursor: %w", err)
+	}
+	if err := errors.Join(f.Sync(), f.Close()); err != nil {
+		return fmt.Errorf("write outbox cursor: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("replace outbox cursor: %w", err)
+	}
+	return nil
+}
+
+func (o *Outbox) listSegmentIDs() ([]uint64, error) {
+	entries, err := os.ReadDir(o.cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("list outbox directory: %w", err)
+	}
+
+	var ids []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentFileExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentFileExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+func (o *Outbox) segmentPath(id uint64) string {
+	return filepath.Join(o.cfg.Dir, fmt.Sprintf("%020d%s", id, segmentFileExt))
+}
+
+func (o *Outbox) logf(format string, args ...interface{}) {
+	o.logger.Printf(format, args...)
+}
+
+// encodeRecord frames a payload as [length uint32][crc32 uint32][payload].
+func encodeRecord(payload []byte) []byte {
+	frame := make([]byte, recordHeaderLen+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload))
+	copy(frame[recordHeaderLen:], payload)
+	return frame
+}
+
+// readRecord reads one framed record. io.EOF means a clean end; any other error marks a damaged tail.
+func readRecord(r io.Reader) ([]byte, int64, error) {
+	var header [recordHeaderLen]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, fmt.Errorf("incomplete record header: %w", err)
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length > maxRecordBytes {
+		return nil, 0, fmt.Errorf("record length %d exceeds limit", length)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, 0, fmt.Errorf("incomplete record payload: %w", io.ErrUnexpectedEOF)
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, 0, errors.New("record checksum mismatch")
+	}
+	return payload, int64(recordHeaderLen) + int64(length), nil
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,548 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/enqueuer"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/restapi"
+)
+
+const crashHelperEnv = "WIN_SOUND_OUTBOX_CRASH_HELPER_DIR"
+
+type recordingEnqueuer struct {
+	mu        sync.Mutex
+	failLeft  int
+	failAll   bool
+	delivered []enqueuer.Request
+}
+
+func (r *recordingEnqueuer) EnqueueRequest(request enqueuer.Request) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failAll {
+		return errors.New("broker unavailable")
+	}
+	if r.failLeft > 0 {
+		r.failLeft--
+		return errors.New("broker unavailable")
+	}
+	r.delivered = append(r.delivered, request)
+	return nil
+}
+
+func (r *recordingEnqueuer) sequence() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seq := make([]int, 0, len(r.delivered))
+	for _, request := range r.delivered {
+		n, _ := strconv.Atoi(request.Data.Ref().PnpID)
+		seq = append(seq, n)
+	}
+	return seq
+}
+
+func testConfig(dir string) Config {
+	return Config{
+		Enabled:          true,
+		Dir:              dir,
+		InitialRetryWait: time.Millisecond,
+		MaxRetryWait:     5 * time.Millisecond,
+	}
+}
+
+func discardLogger() *log.Logger {
+	return log.New(io.Discard, "", 0)
+}
+
+func seqRequest(n int) enqueuer.Request {
+	return enqueuer.Request{
+		Timestamp: time.Now(),
+		Event:     contract.EventTypeRenderVolumeChanged,
+		Data:      contract.VolumeChange{DeviceRef: contract.DeviceRef{HostName: "host-1", PnpID: strconv.Itoa(n)}, Volume: 50},
+	}
+}
+
+func waitDrained(t *testing.T, o *Outbox) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for o.PendingBytes() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("outbox not drained, %d bytes pending", o.PendingBytes())
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func assertSequence(t *testing.T, got []int, n int) {
+	t.Helper()
+	if len(got) != n {
+		t.Fatalf("expected %d delivered requests, got %d (%v)", n, len(got), got)
+	}
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("expected in-order delivery, got %v", got)
+		}
+	}
+}
+
+func TestOutbox_DeliversInOrderWithRetry(t *testing.T) {
+	next := &recordingEnqueuer{failLeft: 3}
+	o, err := NewOutbox(context.Background(), testConfig(t.TempDir()), next, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+
+	for i := 0; i < 20; i++ {
+		if err := o.EnqueueRequest(seqRequest(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitDrained(t, o)
+	assertSequence(t, next.sequence(), 20)
+}
+
+func TestOutbox_KeepsPendingAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig(dir)
+	cfg.MaxSegmentBytes = 256
+
+	offline := &recordingEnqueuer{failAll: true}
+	o, err := NewOutbox(context.Background(), cfg, offline, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		if err := o.EnqueueRequest(seqRequest(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	online := &recordingEnqueuer{}
+	o, err = NewOutbox(context.Background(), cfg, online, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+
+	waitDrained(t, o)
+	assertSequence(t, online.sequence(), 30)
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentFileExt))
+	if len(segments) != 1 {
+		t.Fatalf("expected delivered segments to be compacted, %d left", len(segments))
+	}
+}
+
+func TestOutbox_TruncatesTornTail(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig(dir)
+
+	o, err := NewOutbox(context.Background(), cfg, &recordingEnqueuer{failAll: true}, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := o.EnqueueRequest(seqRequest(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = o.Close()
+
+	// Simulate a write interrupted after the header and part of the payload.
+	torn := encodeRecord([]byte(`{"event":5,"fields":{"seq":"3"}}`))[:12]
+	f, err := os.OpenFile(o.segmentPath(1), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write(torn)
+	_ = f.Close()
+
+	next := &recordingEnqueuer{}
+	o, err = NewOutbox(context.Background(), cfg, next, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+
+	if err := o.EnqueueRequest(seqRequest(3)); err != nil {
+		t.Fatal(err)
+	}
+	waitDrained(t, o)
+	assertSequence(t, next.sequence(), 4)
+}
+
+func TestOutbox_DropsExpiredRequests(t *testing.T) {
+	next := &recordingEnqueuer{}
+	o := newOutbox(testConfig(t.TempDir()), next, discardLogger(), time.Now)
+	o.cfg.MaxAge = time.Hour
+	var drops atomic.Int32
+	o.SetDropHandler(func() { drops.Add(1) })
+	if err := o.open(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	o.cancel = cancel
+	go o.drainLoop(ctx)
+	defer o.Close()
+
+	old := seqRequest(0)
+	old.Timestamp = time.Now().Add(-2 * time.Hour)
+	_ = o.EnqueueRequest(old)
+	_ = o.EnqueueRequest(seqRequest(0))
+
+	waitDrained(t, o)
+	assertSequence(t, next.sequence(), 1)
+	if drops.Load() != 1 {
+		t.Fatalf("expected the expired request to be reported as dropped, got %d drops", drops.Load())
+	}
+}
+
+func TestOutbox_DeliversVolumesOfTheNativeScale(t *testing.T) {
+	next := &recordingEnqueuer{}
+	o, err := NewOutbox(context.Background(), testConfig(t.TempDir()), next, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+
+	request := seqRequest(0)
+	request.Data = contract.VolumeChange{DeviceRef: contract.DeviceRef{HostName: "host-1", PnpID: "0"}, Volume: 750}
+	if err := o.EnqueueRequest(request); err != nil {
+		t.Fatal(err)
+	}
+
+	waitDrained(t, o)
+	assertSequence(t, next.sequence(), 1)
+	if got := next.delivered[0].Data.(contract.VolumeChange).Volume; got != 750 {
+		t.Fatalf("expected volume 750, got %d", got)
+	}
+}
+
+func TestOutbox_DeliversRequestsStoredWithoutIsDefault(t *testing.T) {
+	dir := t.TempDir()
+	o, err := NewOutbox(context.Background(), testConfig(dir), &recordingEnqueuer{failAll: true}, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Records written before the isDefault field existed.
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentFileExt))
+	if len(segments) != 1 {
+		t.Fatalf("expected one segment, got %d", len(segments))
+	}
+	f, err := os.OpenFile(segments[0], os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, payload := range []string{
+		`{"timestamp":"` + now + `","event":1,"fields":{"hostName":"host-1","pnpId":"0","name":"Speakers","renderVolume":"400","captureVolume":"0","operationSystemName":"Windows 11","updateDate":"` + now + `"}}`,
+		`{"timestamp":"` + now + `","event":7,"fields":{"hostName":"host-1","pnpId":"1","updateDate":"` + now + `"}}`,
+	} {
+		if _, err := f.Write(encodeRecord([]byte(payload))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	next := &recordingEnqueuer{}
+	o, err = NewOutbox(context.Background(), testConfig(dir), next, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+
+	waitDrained(t, o)
+	assertSequence(t, next.sequence(), 2)
+	if snapshot := next.delivered[0].Data.(contract.DeviceSnapshot); snapshot.IsDefault || snapshot.Name != "Speakers" {
+		t.Fatalf("expected a non-default Speakers snapshot, got %+v", snapshot)
+	}
+	if detached := next.delivered[1].Data.(contract.DeviceDetached); detached.IsDefault {
+		t.Fatalf("expected a non-default detached event, got %+v", detached)
+	}
+}
+
+// countingEnqueuer counts the delivery attempts it forwards to next.
+type countingEnqueuer struct {
+	next  enqueuer.EnqueueRequest
+	calls atomic.Int32
+}
+
+func (c *countingEnqueuer) EnqueueRequest(request enqueuer.Request) error {
+	c.calls.Add(1)
+	return c.next.EnqueueRequest(request)
+}
+
+func TestOutbox_RetriesWhileTheReceiverIsDown(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseURL := "http://" + listener.Addr().String()
+	_ = listener.Close()
+
+	rest := restapi.NewRestApiEnqueuerWithContext(context.Background(), restapi.Config{BaseURL: baseURL, MaxAttempts: 1}, discardLogger())
+	next := &countingEnqueuer{next: rest}
+	o, err := NewOutbox(context.Background(), testConfig(t.TempDir()), next, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+
+	if err := o.EnqueueRequest(seqRequest(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for next.calls.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected repeated delivery attempts, got %d", next.calls.Load())
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	if o.PendingBytes() == 0 {
+		t.Fatal("expected the request to stay in the outbox while the receiver is down")
+	}
+}
+
+func TestOutbox_DropsRequestsTheReceiverRejects(t *testing.T) {
+	next := &rejectingEnqueuer{err: &restapi.StatusError{StatusCode: 404}}
+	o, err := NewOutbox(context.Background(), testConfig(t.TempDir()), next, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	var drops atomic.Int32
+	o.SetDropHandler(func() { drops.Add(1) })
+
+	if err := o.EnqueueRequest(seqRequest(0)); err != nil {
+		t.Fatal(err)
+	}
+	waitDrained(t, o)
+	if next.calls.Load() != 1 {
+		t.Fatalf("expected a single attempt, got %d", next.calls.Load())
+	}
+	// Confirming the device again would only be rejected again.
+	if drops.Load() != 0 {
+		t.Fatalf("a rejected request must not be reported as dropped, got %d drops", drops.Load())
+	}
+}
+
+type rejectingEnqueuer struct {
+	err   error
+	calls atomic.Int32
+}
+
+func (r *rejectingEnqueuer) EnqueueRequest(enqueuer.Request) error {
+	r.calls.Add(1)
+	return r.err
+}
+
+// pipelinedEnqueuer acknowledges a sent request only when it is waited for, and records
+// how many sent requests were unwaited at most. The requests in failOnce fail their first wait.
+type pipelinedEnqueuer struct {
+	recordingEnqueuer
+	maxInFlight int
+
+	pipeMu   sync.Mutex
+	unwaited int
+	peak     int
+	failOnce map[string]bool
+}
+
+func (p *pipelinedEnqueuer) SendRequest(request enqueuer.Request) func() error {
+	p.pipeMu.Lock()
+	p.unwaited++
+	if p.unwaited > p.peak {
+		p.peak = p.unwaited
+	}
+	p.pipeMu.Unlock()
+
+	return func() error {
+		p.pipeMu.Lock()
+		p.unwaited--
+		id := request.Data.Ref().PnpID
+		fail := p.failOnce[id]
+		delete(p.failOnce, id)
+		p.pipeMu.Unlock()
+
+		if fail {
+			return errors.New("confirm timed out")
+		}
+		return p.EnqueueRequest(request)
+	}
+}
+
+func (p *pipelinedEnqueuer) MaxInFlight() int {
+	return p.maxInFlight
+}
+
+// startWithPending opens an outbox holding n requests and only then starts draining it.
+func startWithPending(t *testing.T, next enqueuer.EnqueueRequest, n int) *Outbox {
+	t.Helper()
+	o := newOutbox(testConfig(t.TempDir()), next, discardLogger(), time.Now)
+	if err := o.open(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if err := o.EnqueueRequest(seqRequest(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	o.cancel = cancel
+	go o.drainLoop(ctx)
+	return o
+}
+
+func TestOutbox_KeepsPipelinedRequestsInFlight(t *testing.T) {
+	next := &pipelinedEnqueuer{maxInFlight: 8}
+	o := startWithPending(t, next, 50)
+	defer o.Close()
+
+	waitDrained(t, o)
+	assertSequence(t, next.sequence(), 50)
+	if next.peak != 8 {
+		t.Fatalf("expected 8 requests in flight, at most %d were", next.peak)
+	}
+}
+
+func TestOutbox_ResendsFromTheFailedPipelinedRequest(t *testing.T) {
+	next := &pipelinedEnqueuer{maxInFlight: 8, failOnce: map[string]bool{"5": true}}
+	o := startWithPending(t, next, 50)
+	defer o.Close()
+
+	waitDrained(t, o)
+
+	// The requests sent behind the failed one may arrive twice, but from the retry on all arrive in order.
+	seq := next.sequence()
+	retry := -1
+	for i, n := range seq {
+		if n == 5 {
+			retry = i
+		}
+	}
+	if retry < 0 {
+		t.Fatalf("request 5 was never delivered: %v", seq)
+	}
+	for i, n := range seq[retry:] {
+		if n != 5+i {
+			t.Fatalf("expected in-order delivery from the retry on, got %v", seq)
+		}
+	}
+	if len(seq[retry:]) != 45 {
+		t.Fatalf("expected requests 5 to 49 after the retry, got %v", seq[retry:])
+	}
+}
+
+func TestOutbox_SizeCapDropsOldestSegments(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig(dir)
+	cfg.MaxBytes = 1024
+	cfg.MaxSegmentBytes = 256
+
+	o, err := NewOutbox(context.Background(), cfg, &recordingEnqueuer{failAll: true}, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+
+	for i := 0; i < 200; i++ {
+		if err := o.EnqueueRequest(seqRequest(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if pending := o.PendingBytes(); pending > cfg.MaxBytes+cfg.MaxSegmentBytes {
+		t.Fatalf("expected pending bytes to stay near the cap, got %d", pending)
+	}
+}
+
+// TestOutbox_SurvivesKilledWriter kills a process that appends continuously and checks that
+// every record persisted before the kill is delivered, in order, after reopening.
+func TestOutbox_SurvivesKilledWriter(t *testing.T) {
+	if testing.Short() {
+		t.Skip("spawns a helper process")
+	}
+
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestOutbox_CrashHelper$")
+	cmd.Env = append(os.Environ(), crashHelperEnv+"="+dir)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if info, err := os.Stat(filepath.Join(dir, "00000000000000000002"+segmentFileExt)); err == nil && info.Size() > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			_ = cmd.Process.Kill()
+			t.Fatal("helper process did not write records")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	_ = cmd.Process.Kill()
+	_ = cmd.Wait()
+
+	cfg := testConfig(dir)
+	cfg.MaxSegmentBytes = 4096
+	next := &recordingEnqueuer{}
+	o, err := NewOutbox(context.Background(), cfg, next, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+
+	waitDrained(t, o)
+	got := next.sequence()
+	if len(got) == 0 {
+		t.Fatal("expected records written before the kill to be delivered")
+	}
+	assertSequence(t, got, len(got))
+}
+
+func TestOutbox_CrashHelper(t *testing.T) {
+	dir := os.Getenv(crashHelperEnv)
+	if dir == "" {
+		t.Skip("helper process only")
+	}
+
+	cfg := testConfig(dir)
+	cfg.MaxSegmentBytes = 4096
+	o, err := NewOutbox(context.Background(), cfg, &recordingEnqueuer{failAll: true}, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		if err := o.EnqueueRequest(seqRequest(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// OverflowBlock makes the caller wait for free space, as the synchronous enqueue did.
+	OverflowBlock = "block"
+	// OverflowDropOldest discards the oldest queued event.
+	OverflowDropOldest = "drop-oldest"
+	// OverflowDropVolume discards the oldest queued volume change first, then the oldest event.
+	OverflowDropVolume = "drop-volume"
+)
+
+const (
+	defaultCapacity     = 1024
+	defaultOverflow     = OverflowDropVolume
+	defaultDrainTimeout = 5 * time.Second
+)
+
+// Config defines the size of the in-memory queue, what happens when it is full and how long shutdown may drain it.
+type Config struct {
+	Capacity     int
+	Overflow     string
+	DrainTimeout time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Capacity:     defaultCapacity,
+		Overflow:     defaultOverflow,
+		DrainTimeout: defaultDrainTimeout,
+	}
+}
+
+func (c Config) withDefaults() Config {
+	d := DefaultConfig()
+
+	if c.Capacity <= 0 {
+		c.Capacity = d.Capacity
+	}
+	c.Overflow = strings.ToLower(strings.TrimSpace(c.Overflow))
+	if c.Overflow == "" {
+		c.Overflow = d.Overflow
+	}
+	if c.DrainTimeout <= 0 {
+		c.DrainTimeout = d.DrainTimeout
+	}
+
+	return c
+}
+
+func (c Config) validate() error {
+	switch c.Overflow {
+	case OverflowBlock, OverflowDropOldest, OverflowDropVolume:
+		return nil
+	default:
+		return fmt.Errorf("unsupported WIN_SOUND_QUEUE_OVERFLOW %q (supported: %s, %s, %s)", c.Overflow, OverflowBlock, OverflowDropOldest, OverflowDropVolume)
+	}
+}
+
+// LoadConfigFromEnv loads queue configuration from environment variables.
+// Empty values are replaced by defaults.
+func LoadConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
+
+	if v := strings.TrimSpace(os.Getenv("WIN_SOUND_QUEUE_CAPACITY")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid WIN_SOUND_QUEUE_CAPACITY %q: %w", v, err)
+		}
+		if n < 0 {
+			return Config{}, fmt.Errorf("WIN_SOUND_QUEUE_CAPACITY can not be negative %q", v)
+		}
+		cfg.Capacity = n
+	}
+	if v := strings.TrimSpace(os.Getenv("WIN_SOUND_QUEUE_OVERFLOW")); v != "" {
+		cfg.Overflow = v
+	}
+	if v := strings.TrimSpace(os.Getenv("WIN_SOUND_QUEUE_DRAIN_TIMEOUT_MS")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid WIN_SOUND_QUEUE_DRAIN_TIMEOUT_MS %q: %w", v, err)
+		}
+		if n < 0 {
+			return Config{}, fmt.Errorf("WIN_SOUND_QUEUE_DRAIN_TIMEOUT_MS can not be negative %q", v)
+		}
+		cfg.DrainTimeout = time.Duration(n) * time.Millisecond
+	}
+
+	cfg = cfg.withDefaults()
+	if err := cfg.validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
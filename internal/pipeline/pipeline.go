@@ -0,0 +1,264 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/enqueuer"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/logging"
+)
+
+var (
+	// ErrClosed is returned for requests enqueued after Close.
+	ErrClosed = errors.New("pipeline is closed")
+	// ErrDropped is returned when the queue is full and the overflow policy discarded the request itself.
+	ErrDropped = errors.New("pipeline queue is full, request dropped")
+)
+
+// Pipeline decouples the device notification callbacks from the transport: EnqueueRequest only
+// queues the request in memory and a dispatcher goroutine forwards it, in order, to the wrapped enqueuer.
+type Pipeline struct {
+	cfg    Config
+	next   enqueuer.EnqueueRequest
+	logger logging.Logger
+
+	mu             sync.Mutex
+	changed        *sync.Cond // signalled when requests are queued, dequeued or the pipeline closes
+	queue          []enqueuer.Request
+	closed         bool
+	dropped        uint64
+	droppedInBurst uint64 // drops since the queue last became full, reported once it drains
+	highWater      bool
+	onDrop         func()
+
+	done chan struct{}
+}
+
+func NewPipeline(cfg Config, next enqueuer.EnqueueRequest, logger logging.Logger) (*Pipeline, error) {
+	if next == nil {
+		panic("nil next enqueuer")
+	}
+	if logger == nil {
+		panic("nil logger")
+	}
+
+	cfg = cfg.withDefaults()
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	p := &Pipeline{
+		cfg:    cfg,
+		next:   next,
+		logger: logger,
+		queue:  make([]enqueuer.Request, 0, cfg.Capacity),
+		done:   make(chan struct{}),
+	}
+	p.changed = sync.NewCond(&p.mu)
+	go p.dispatch()
+
+	return p, nil
+}
+
+// EnqueueRequest queues the request and returns without waiting for the transport,
+// unless the queue is full and the overflow policy is OverflowBlock.
+func (p *Pipeline) EnqueueRequest(request enqueuer.Request) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cfg.Overflow == OverflowBlock {
+		for len(p.queue) >= p.cfg.Capacity && !p.closed {
+			p.changed.Wait()
+		}
+	}
+	if p.closed {
+		return ErrClosed
+	}
+
+	if len(p.queue) >= p.cfg.Capacity {
+		victim := p.victimLocked(request)
+		p.dropLocked(victim, request)
+		if victim < 0 {
+			return ErrDropped
+		}
+	}
+
+	p.queue = append(p.queue, request)
+	p.reportDepthLocked()
+	p.changed.Broadcast()
+	return nil
+}
+
+// SetDropHandler registers h to be called when a request is lost: discarded by the overflow policy, or failed
+// in the wrapped enqueuer for a reason other than a permanent rejection. h must not block or enqueue.
+func (p *Pipeline) SetDropHandler(h func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onDrop = h
+}
+
+// Depth reports the number of queued requests not yet handed to the transport.
+func (p *Pipeline) Depth() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.queue)
+}
+
+// Dropped reports the number of requests discarded because the queue was full.
+func (p *Pipeline) Dropped() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dropped
+}
+
+// Close stops accepting requests and waits up to DrainTimeout for the queued ones to be forwarded.
+// Requests still queued after the deadline are discarded and reported in the returned error. Close returns
+// only after the dispatcher exited, so the wrapped enqueuer is not used anymore once it can be closed;
+// a send in flight at the deadline is still waited for, bounded by the enqueuer's own timeouts.
+func (p *Pipeline) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.changed.Broadcast()
+	p.mu.Unlock()
+
+	timer := time.NewTimer(p.cfg.DrainTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-p.done:
+		return nil
+	case <-timer.C:
+	}
+
+	p.mu.Lock()
+	remaining := len(p.queue)
+	p.queue = nil
+	p.mu.Unlock()
+
+	// With the queue empty the dispatcher only settles what it already sent, then exits.
+	<-p.done
+
+	return fmt.Errorf("pipeline drain timed out after %s, %d requests discarded", p.cfg.DrainTimeout, remaining)
+}
+
+// dispatch forwards the queued requests in order. With a pipelined next enqueuer up to its MaxInFlight
+// requests are sent before the oldest is waited for.
+func (p *Pipeline) dispatch() {
+	defer close(p.done)
+
+	type sent struct {
+		request enqueuer.Request
+		wait    func() error
+	}
+	maxInFlight := enqueuer.MaxInFlight(p.next)
+	var window []sent
+	settleOldest := func() {
+		if err := window[0].wait(); err != nil {
+			p.logf("[error, pipeline] enqueue failed: event=%d: %v", window[0].request.Event, err)
+			if !enqueuer.IsPermanent(err) {
+				p.mu.Lock()
+				p.notifyDropLocked()
+				p.mu.Unlock()
+			}
+		}
+		window = window[1:]
+	}
+
+	for {
+		p.mu.Lock()
+		for len(p.queue) == 0 && !p.closed && len(window) == 0 {
+			p.changed.Wait()
+		}
+		if len(p.queue) == 0 {
+			p.mu.Unlock()
+			if len(window) == 0 {
+				return
+			}
+			settleOldest()
+			continue
+		}
+		request := p.queue[0]
+		p.queue[0] = enqueuer.Request{}
+		p.queue = p.queue[1:]
+		p.reportDepthLocked()
+		p.changed.Broadcast()
+		p.mu.Unlock()
+
+		if len(window) == maxInFlight {
+			settleOldest()
+		}
+		window = append(window, sent{request: request, wait: enqueuer.Send(p.next, request)})
+	}
+}
+
+// victimLocked picks the queued request to discard for the incoming one, or -1 to discard the incoming one.
+func (p *Pipeline) victimLocked(incoming enqueuer.Request) int {
+	if p.cfg.Overflow == OverflowDropVolume {
+		for i, queued := range p.queue {
+			if isVolumeEvent(queued.Event) {
+				return i
+			}
+		}
+		if isVolumeEvent(incoming.Event) {
+			return -1
+		}
+	}
+	return 0
+}
+
+func (p *Pipeline) dropLocked(victim int, incoming enqueuer.Request) {
+	dropped := incoming
+	if victim >= 0 {
+		dropped = p.queue[victim]
+		p.queue = append(p.queue[:victim], p.queue[victim+1:]...)
+	}
+
+	p.dropped++
+	p.droppedInBurst++
+	p.notifyDropLocked()
+	if p.droppedInBurst == 1 {
+		p.logf("[warn, pipeline] queue full (capacity %d, overflow %s), dropping event=%d", p.cfg.Capacity, p.cfg.Overflow, dropped.Event)
+	}
+}
+
+func (p *Pipeline) notifyDropLocked() {
+	if p.onDrop != nil {
+		p.onDrop()
+	}
+}
+
+// reportDepthLocked logs when the queue crosses its high watermark and when it is empty again.
+func (p *Pipeline) reportDepthLocked() {
+	depth := len(p.queue)
+	switch {
+	case !p.highWater && depth >= highWatermark(p.cfg.Capacity):
+		p.highWater = true
+		p.logf("[warn, pipeline] queue depth %d of %d, the transport is falling behind", depth, p.cfg.Capacity)
+	case p.highWater && depth == 0:
+		p.highWater = false
+		p.logf("[info, pipeline] queue drained, %d requests dropped while it was full", p.droppedInBurst)
+		p.droppedInBurst = 0
+	}
+}
+
+func (p *Pipeline) logf(format string, args ...interface{}) {
+	p.logger.Printf(format, args...)
+}
+
+func highWatermark(capacity int) int {
+	if mark := capacity * 3 / 4; mark > 0 {
+		return mark
+	}
+	return 1
+}
+
+func isVolumeEvent(event contract.EventType) bool {
+	return event == contract.EventTypeRenderVolumeChanged || event == contract.EventTypeCaptureVolumeChanged
+}
@@ -0,0 +1,278 @@
+package pipeline
+
+import (
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/enqueuer"
+)
+
+// gatedEnqueuer records requests and blocks each call until the gate is opened.
+type gatedEnqueuer struct {
+	gate chan struct{}
+
+	mu       sync.Mutex
+	requests []enqueuer.Request
+	started  chan struct{}
+}
+
+func newGatedEnqueuer() *gatedEnqueuer {
+	return &gatedEnqueuer{gate: make(chan struct{}), started: make(chan struct{}, 1)}
+}
+
+func (g *gatedEnqueuer) EnqueueRequest(request enqueuer.Request) error {
+	select {
+	case g.started <- struct{}{}:
+	default:
+	}
+	<-g.gate
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.requests = append(g.requests, request)
+	return nil
+}
+
+func (g *gatedEnqueuer) events() []contract.EventType {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	events := make([]contract.EventType, 0, len(g.requests))
+	for _, r := range g.requests {
+		events = append(events, r.Event)
+	}
+	return events
+}
+
+func newTestPipeline(t *testing.T, cfg Config, next enqueuer.EnqueueRequest) *Pipeline {
+	t.Helper()
+	p, err := NewPipeline(cfg, next, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// fill stalls the dispatcher on a first request and then fills the queue.
+func fill(t *testing.T, p *Pipeline, next *gatedEnqueuer, events ...contract.EventType) {
+	t.Helper()
+	if err := p.EnqueueRequest(enqueuer.Request{Event: contract.EventTypeRenderDeviceConfirmed}); err != nil {
+		t.Fatal(err)
+	}
+	<-next.started
+	for _, ev := range events {
+		if err := p.EnqueueRequest(enqueuer.Request{Event: ev}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPipeline_ForwardsInOrderAndDrainsOnClose(t *testing.T) {
+	next := newGatedEnqueuer()
+	close(next.gate)
+	p := newTestPipeline(t, Config{Capacity: 4}, next)
+
+	want := []contract.EventType{contract.EventTypeRenderDeviceConfirmed, contract.EventTypeCaptureDeviceConfirmed, contract.EventTypeRenderVolumeChanged}
+	for _, ev := range want {
+		if err := p.EnqueueRequest(enqueuer.Request{Event: ev}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := next.events()
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+	if err := p.EnqueueRequest(enqueuer.Request{}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed after Close, got %v", err)
+	}
+}
+
+func TestPipeline_DropVolumeEvictsVolumeEventsFirst(t *testing.T) {
+	next := newGatedEnqueuer()
+	p := newTestPipeline(t, Config{Capacity: 2, Overflow: OverflowDropVolume}, next)
+	fill(t, p, next, contract.EventTypeRenderVolumeChanged, contract.EventTypeCaptureDeviceDiscovered)
+
+	if err := p.EnqueueRequest(enqueuer.Request{Event: contract.EventTypeRenderDeviceDetached}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.EnqueueRequest(enqueuer.Request{Event: contract.EventTypeCaptureVolumeChanged}); !errors.Is(err, ErrDropped) {
+		t.Fatalf("expected the incoming volume event to be dropped, got %v", err)
+	}
+	if p.Dropped() != 2 || p.Depth() != 2 {
+		t.Fatalf("unexpected dropped=%d depth=%d", p.Dropped(), p.Depth())
+	}
+
+	close(next.gate)
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got := next.events()
+	want := []contract.EventType{contract.EventTypeRenderDeviceConfirmed, contract.EventTypeCaptureDeviceDiscovered, contract.EventTypeRenderDeviceDetached}
+	if len(got) != len(want) || got[1] != want[1] || got[2] != want[2] {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestPipeline_DropOldest(t *testing.T) {
+	next := newGatedEnqueuer()
+	p := newTestPipeline(t, Config{Capacity: 2, Overflow: OverflowDropOldest}, next)
+	drops := 0
+	p.SetDropHandler(func() { drops++ })
+	fill(t, p, next, contract.EventTypeCaptureDeviceDiscovered, contract.EventTypeRenderVolumeChanged)
+
+	if err := p.EnqueueRequest(enqueuer.Request{Event: contract.EventTypeRenderDeviceDetached}); err != nil {
+		t.Fatal(err)
+	}
+
+	close(next.gate)
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got := next.events()
+	want := []contract.EventType{contract.EventTypeRenderDeviceConfirmed, contract.EventTypeRenderVolumeChanged, contract.EventTypeRenderDeviceDetached}
+	if len(got) != len(want) || got[1] != want[1] || got[2] != want[2] {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if drops != 1 {
+		t.Fatalf("expected the drop to be reported once, got %d", drops)
+	}
+}
+
+func TestPipeline_BlockWaitsForSpace(t *testing.T) {
+	next := newGatedEnqueuer()
+	p := newTestPipeline(t, Config{Capacity: 1, Overflow: OverflowBlock}, next)
+	fill(t, p, next, contract.EventTypeCaptureDeviceDiscovered)
+
+	enqueued := make(chan error, 1)
+	go func() { enqueued <- p.EnqueueRequest(enqueuer.Request{Event: contract.EventTypeRenderDeviceDetached}) }()
+
+	select {
+	case err := <-enqueued:
+		t.Fatalf("expected EnqueueRequest to block on a full queue, got %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(next.gate)
+	if err := <-enqueued; err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := next.events(); len(got) != 3 || p.Dropped() != 0 {
+		t.Fatalf("expected 3 forwarded and none dropped, got %v dropped=%d", got, p.Dropped())
+	}
+}
+
+func TestPipeline_CloseGivesUpAfterDrainTimeout(t *testing.T) {
+	next := newGatedEnqueuer()
+	p := newTestPipeline(t, Config{Capacity: 4, DrainTimeout: 10 * time.Millisecond}, next)
+	fill(t, p, next, contract.EventTypeCaptureDeviceDiscovered)
+
+	closed := make(chan error, 1)
+	go func() { closed <- p.Close() }()
+
+	// Past the drain timeout the first request is still in the enqueuer, Close must wait for it.
+	select {
+	case err := <-closed:
+		t.Fatalf("Close returned while a request was in flight: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if p.Depth() != 0 {
+		t.Fatalf("expected remaining requests to be discarded, depth=%d", p.Depth())
+	}
+
+	close(next.gate)
+	if err := <-closed; err == nil {
+		t.Fatal("expected a drain timeout error")
+	}
+	if got := next.events(); len(got) != 1 || got[0] != contract.EventTypeRenderDeviceConfirmed {
+		t.Fatalf("expected only the request in flight to be forwarded, got %v", got)
+	}
+}
+
+// pipelinedEnqueuer holds every confirm back until the gate opens and records how many sent
+// requests wait for their confirm at most.
+type pipelinedEnqueuer struct {
+	gate chan struct{}
+
+	mu       sync.Mutex
+	unwaited int
+	peak     int
+	sent     []contract.EventType
+}
+
+func (e *pipelinedEnqueuer) EnqueueRequest(request enqueuer.Request) error {
+	return e.SendRequest(request)()
+}
+
+func (e *pipelinedEnqueuer) SendRequest(request enqueuer.Request) func() error {
+	e.mu.Lock()
+	e.unwaited++
+	e.peak = max(e.peak, e.unwaited)
+	e.sent = append(e.sent, request.Event)
+	e.mu.Unlock()
+
+	return func() error {
+		<-e.gate
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.unwaited--
+		return nil
+	}
+}
+
+func (e *pipelinedEnqueuer) MaxInFlight() int { return 4 }
+
+func TestPipeline_KeepsPipelinedRequestsInFlight(t *testing.T) {
+	next := &pipelinedEnqueuer{gate: make(chan struct{})}
+	p := newTestPipeline(t, Config{Capacity: 16}, next)
+
+	for i := 0; i < 10; i++ {
+		if err := p.EnqueueRequest(enqueuer.Request{Event: contract.EventTypeRenderVolumeChanged}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		next.mu.Lock()
+		sent := len(next.sent)
+		next.mu.Unlock()
+		if sent == 4 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 4 requests sent before the first confirm, got %d", sent)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(next.gate)
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(next.sent) != 10 || next.peak != 4 {
+		t.Fatalf("expected 10 sent with at most 4 in flight, got %d with %d", len(next.sent), next.peak)
+	}
+}
+
+func TestLoadConfigFromEnv_RejectsUnknownOverflow(t *testing.T) {
+	t.Setenv("WIN_SOUND_QUEUE_OVERFLOW", "spill")
+	if _, err := LoadConfigFromEnv(); err == nil {
+		t.Fatal("expected an error for an unsupported overflow policy")
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 const (
@@ -23,6 +26,11 @@ const (
 	defaultInitialReconnectDelay   = 2 * time.Second
 	defaultMaxReconnectDelay       = 30 * time.Second
 	defaultPublishConfirmTimeout   = 10 * time.Second
+	defaultPrefetchCount           = 10
+	defaultPublishMaxInFlight      = 64
+
+	StartupBackground = "background"
+	StartupWait       = "wait"
 )
 
 // Config defines RabbitMQ connection, topology, and retry settings.
@@ -40,6 +48,53 @@ type Config struct {
 	InitialReconnectDelay   time.Duration
 	MaxReconnectDelay       time.Duration
 	PublishConfirmTimeout   time.Duration
+	PrefetchCount           int
+	PublishMaxInFlight      int
+	// ConnectionTimeout bounds the TCP dial; 0 keeps the amqp091 default.
+	ConnectionTimeout time.Duration
+	// ChannelMax is the channel limit to negotiate; 0 keeps the broker's.
+	ChannelMax uint16
+	// BackgroundConnect makes NewRequestPublisher return at once and connect from a goroutine
+	// with unlimited retries, instead of failing after MaxReconnectionAttempts.
+	BackgroundConnect bool
+
+	// TLSEnabled dials amqps; the port then defaults to 5671.
+	TLSEnabled            bool
+	TLSCAFile             string
+	TLSCertFile           string
+	TLSKeyFile            string
+	TLSServerName         string
+	TLSInsecureSkipVerify bool
+	// AuthMechanism is AuthPlain (user and password) or AuthExternal (client certificate).
+	AuthMechanism string
+
+	// Endpoints lists the cluster nodes; empty means the single Host and Port.
+	// Nodes without a port use Port.
+	Endpoints []Endpoint
+	// HostSelection is SelectRoundRobin or SelectPriority (list order).
+	HostSelection string
+	// HostQuarantine is how long a node that failed to connect is skipped.
+	HostQuarantine time.Duration
+
+	// RoutingKeyTemplate builds the routing key of each message, e.g. "sound.{host}.{flow}.{event}";
+	// RoutingKey is then only the binding key of the queue. Empty publishes everything with RoutingKey.
+	RoutingKeyTemplate string
+
+	// Topology is TopologyDeclare, or TopologyPassive to only check that the exchange and queue exist.
+	Topology     string
+	ExchangeType string
+	// QueueType is QueueClassic, QueueQuorum or QueueStream.
+	QueueType            string
+	MessageTTL           time.Duration
+	MaxLength            int
+	QueueOverflow        string
+	DeadLetterExchange   string
+	DeadLetterRoutingKey string
+	// AlternateExchange receives the messages the exchange can not route, instead of returning them.
+	AlternateExchange string
+
+	// BodyFormat is BodyFlat, BodyEnvelope, or BodyBoth for the envelope with the flat fields alongside.
+	BodyFormat string
 }
 
 func DefaultConfig() Config {
@@ -57,6 +112,16 @@ func DefaultConfig() Config {
 		InitialReconnectDelay:   defaultInitialReconnectDelay,
 		MaxReconnectDelay:       defaultMaxReconnectDelay,
 		PublishConfirmTimeout:   defaultPublishConfirmTimeout,
+		PrefetchCount:           defaultPrefetchCount,
+		PublishMaxInFlight:      defaultPublishMaxInFlight,
+		BackgroundConnect:       true,
+		AuthMechanism:           AuthPlain,
+		HostSelection:           SelectRoundRobin,
+		HostQuarantine:          defaultHostQuarantine,
+		Topology:                TopologyDeclare,
+		ExchangeType:            amqp.ExchangeDirect,
+		QueueType:               QueueClassic,
+		BodyFormat:              BodyFlat,
 	}
 }
 
@@ -75,6 +140,9 @@ func (c Config) withDefaults() Config {
 	}
 	if c.Port <= 0 {
 		c.Port = d.Port
+		if c.TLSEnabled {
+			c.Port = defaultTLSPort
+		}
 	}
 	if c.VHost == "" {
 		c.VHost = d.VHost
@@ -109,6 +177,52 @@ func (c Config) withDefaults() Config {
 	if c.PublishConfirmTimeout <= 0 {
 		c.PublishConfirmTimeout = d.PublishConfirmTimeout
 	}
+	if c.PrefetchCount <= 0 {
+		c.PrefetchCount = d.PrefetchCount
+	}
+	if c.PublishMaxInFlight <= 0 {
+		c.PublishMaxInFlight = d.PublishMaxInFlight
+	}
+	c.AuthMechanism = strings.ToLower(strings.TrimSpace(c.AuthMechanism))
+	if c.AuthMechanism == "" {
+		c.AuthMechanism = d.AuthMechanism
+	}
+	c.HostSelection = strings.ToLower(strings.TrimSpace(c.HostSelection))
+	if c.HostSelection == "" {
+		c.HostSelection = d.HostSelection
+	}
+	if c.HostQuarantine <= 0 {
+		c.HostQuarantine = d.HostQuarantine
+	}
+	c.Topology = strings.ToLower(strings.TrimSpace(c.Topology))
+	if c.Topology == "" {
+		c.Topology = d.Topology
+	}
+	c.ExchangeType = strings.ToLower(strings.TrimSpace(c.ExchangeType))
+	if c.ExchangeType == "" {
+		c.ExchangeType = d.ExchangeType
+	}
+	c.QueueType = strings.ToLower(strings.TrimSpace(c.QueueType))
+	if c.QueueType == "" {
+		c.QueueType = d.QueueType
+	}
+	c.QueueOverflow = strings.ToLower(strings.TrimSpace(c.QueueOverflow))
+	c.BodyFormat = strings.ToLower(strings.TrimSpace(c.BodyFormat))
+	if c.BodyFormat == "" {
+		c.BodyFormat = d.BodyFormat
+	}
+	if len(c.Endpoints) == 0 {
+		c.Endpoints = []Endpoint{{Host: c.Host, Port: c.Port}}
+	} else {
+		endpoints := make([]Endpoint, len(c.Endpoints))
+		for i, e := range c.Endpoints {
+			if e.Port <= 0 {
+				e.Port = c.Port
+			}
+			endpoints[i] = e
+		}
+		c.Endpoints = endpoints
+	}
 	if c.MaxReconnectDelay < c.InitialReconnectDelay {
 		c.MaxReconnectDelay = c.InitialReconnectDelay
 	}
@@ -116,10 +230,47 @@ func (c Config) withDefaults() Config {
 	return c
 }
 
+func (c Config) validate() error {
+	switch c.HostSelection {
+	case SelectRoundRobin, SelectPriority:
+	default:
+		return fmt.Errorf("invalid WIN_SOUND_RABBITMQ_HOST_SELECTION %q (supported: %s, %s)", c.HostSelection, SelectRoundRobin, SelectPriority)
+	}
+	for _, e := range c.Endpoints {
+		if strings.TrimSpace(e.Host) == "" {
+			return fmt.Errorf("invalid WIN_SOUND_RABBITMQ_HOSTS entry %q: empty host", e)
+		}
+	}
+	if err := c.validateTopology(); err != nil {
+		return err
+	}
+	if !slices.Contains(bodyFormats, c.BodyFormat) {
+		return fmt.Errorf("invalid WIN_SOUND_RABBITMQ_BODY_FORMAT %q (supported: %s)", c.BodyFormat, strings.Join(bodyFormats, ", "))
+	}
+	if _, err := NewRoutingKeys(c); err != nil {
+		return err
+	}
+	if err := c.validateRoutingKeyTemplate(); err != nil {
+		return err
+	}
+	return c.validateTLS()
+}
+
 // LoadConfigFromEnv loads rabbit configuration from environment variables.
-// Empty values are replaced by defaults.
+// WIN_SOUND_RABBITMQ_URL, if set, is the base; the separate variables take precedence over it.
+// Empty values are replaced by defaults; TLS files are checked here already.
 func LoadConfigFromEnv() (Config, error) {
 	cfg := DefaultConfig()
+	// The port default depends on TLS, so it is applied by withDefaults.
+	cfg.Port = 0
+
+	if v := strings.TrimSpace(os.Getenv("WIN_SOUND_RABBITMQ_URL")); v != "" {
+		withURL, err := cfg.withURL(v)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg = withURL
+	}
 
 	if v := strings.TrimSpace(os.Getenv("WIN_SOUND_RABBITMQ_HOST")); v != "" {
 		cfg.Host = v
@@ -193,8 +344,143 @@ func LoadConfigFromEnv() (Config, error) {
 		}
 		cfg.PublishConfirmTimeout = time.Duration(n) * time.Millisecond
 	}
+	if v := strings.TrimSpace(os.Getenv("WIN_SOUND_RABBITMQ_PREFETCH")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid WIN_SOUND_RABBITMQ_PREFETCH %q: %w", v, err)
+		}
+		if n < 0 {
+			return Config{}, fmt.Errorf("WIN_SOUND_RABBITMQ_PREFETCH can not be negative %q", v)
+		}
+		cfg.PrefetchCount = n
+	}
+	if v := strings.TrimSpace(os.Getenv("WIN_SOUND_RABBITMQ_MAX_IN_FLIGHT")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid WIN_SOUND_RABBITMQ_MAX_IN_FLIGHT %q: %w", v, err)
+		}
+		if n < 0 {
+			return Config{}, fmt.Errorf("WIN_SOUND_RABBITMQ_MAX_IN_FLIGHT can not be negative %q", v)
+		}
+		cfg.PublishMaxInFlight = n
+	}
+	if v := strings.TrimSpace(os.Getenv("WIN_SOUND_RABBITMQ_STARTUP")); v != "" {
+		switch strings.ToLower(v) {
+		case StartupBackground:
+			cfg.BackgroundConnect = true
+		case StartupWait:
+			cfg.BackgroundConnect = false
+		default:
+			return Config{}, fmt.Errorf("invalid WIN_SOUND_RABBITMQ_STARTUP %q: expected %q or %q", v, StartupBackground, StartupWait)
+		}
+	}
 
-	return cfg.withDefaults(), nil
+	if v := os.Getenv("WIN_SOUND_RABBITMQ_TLS"); v != "" {
+		enabled, err := parseOnOff("WIN_SOUND_RABBITMQ_TLS", v)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.TLSEnabled = enabled
+	}
+	if v := strings.TrimSpace(os.Getenv("WIN_SOUND_RABBITMQ_TLS_CA_FILE")); v != "" {
+		cfg.TLSCAFile = v
+	}
+	if v := strings.TrimSpace(os.Getenv("WIN_SOUND_RABBITMQ_TLS_CERT_FILE")); v != "" {
+		cfg.TLSCertFile = v
+	}
+	if v := strings.TrimSpace(os.Getenv("WIN_SOUND_RABBITMQ_TLS_KEY_FILE")); v != "" {
+		cfg.TLSKeyFile = v
+	}
+	if v := strings.TrimSpace(os.Getenv("WIN_SOUND_RABBITMQ_TLS_SERVER_NAME")); v != "" {
+		cfg.TLSServerName = v
+	}
+	if v := os.Getenv("WIN_SOUND_RABBITMQ_TLS_INSECURE_SKIP_VERIFY"); v != "" {
+		skip, err := parseOnOff("WIN_SOUND_RABBITMQ_TLS_INSECURE_SKIP_VERIFY", v)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.TLSInsecureSkipVerify = skip
+	}
+	if v := os.Getenv("WIN_SOUND_RABBITMQ_AUTH"); v != "" {
+		cfg.AuthMechanism = v
+	}
+	if v := strings.TrimSpace(os.Getenv("WIN_SOUND_RABBITMQ_HOSTS")); v != "" {
+		endpoints, err := parseEndpoints(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid WIN_SOUND_RABBITMQ_HOSTS: %w", err)
+		}
+		cfg.Endpoints = endpoints
+	}
+	if v := os.Getenv("WIN_SOUND_RABBITMQ_HOST_SELECTION"); v != "" {
+		cfg.HostSelection = v
+	}
+	if v := strings.TrimSpace(os.Getenv("WIN_SOUND_RABBITMQ_ROUTING_KEY_TEMPLATE")); v != "" {
+		cfg.RoutingKeyTemplate = v
+		// Without an explicit binding key, bind the queue to every key the template produces.
+		if os.Getenv("WIN_SOUND_RABBITMQ_ROUTING_KEY") == "" {
+			cfg.RoutingKey = bindingKeyFor(v)
+		}
+	}
+	if v := os.Getenv("WIN_SOUND_RABBITMQ_BODY_FORMAT"); v != "" {
+		cfg.BodyFormat = v
+	}
+	if v := os.Getenv("WIN_SOUND_RABBITMQ_TOPOLOGY"); v != "" {
+		cfg.Topology = v
+	}
+	if v := os.Getenv("WIN_SOUND_RABBITMQ_EXCHANGE_TYPE"); v != "" {
+		cfg.ExchangeType = v
+	}
+	if v := os.Getenv("WIN_SOUND_RABBITMQ_QUEUE_TYPE"); v != "" {
+		cfg.QueueType = v
+	}
+	if v := strings.TrimSpace(os.Getenv("WIN_SOUND_RABBITMQ_MESSAGE_TTL_MS")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid WIN_SOUND_RABBITMQ_MESSAGE_TTL_MS %q: %w", v, err)
+		}
+		if n < 0 {
+			return Config{}, fmt.Errorf("WIN_SOUND_RABBITMQ_MESSAGE_TTL_MS can not be negative %q", v)
+		}
+		cfg.MessageTTL = time.Duration(n) * time.Millisecond
+	}
+	if v := strings.TrimSpace(os.Getenv("WIN_SOUND_RABBITMQ_QUEUE_MAX_LENGTH")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid WIN_SOUND_RABBITMQ_QUEUE_MAX_LENGTH %q: %w", v, err)
+		}
+		if n < 0 {
+			return Config{}, fmt.Errorf("WIN_SOUND_RABBITMQ_QUEUE_MAX_LENGTH can not be negative %q", v)
+		}
+		cfg.MaxLength = n
+	}
+	if v := os.Getenv("WIN_SOUND_RABBITMQ_QUEUE_OVERFLOW"); v != "" {
+		cfg.QueueOverflow = v
+	}
+	if v := os.Getenv("WIN_SOUND_RABBITMQ_DLX"); v != "" {
+		cfg.DeadLetterExchange = v
+	}
+	if v := os.Getenv("WIN_SOUND_RABBITMQ_DLX_ROUTING_KEY"); v != "" {
+		cfg.DeadLetterRoutingKey = v
+	}
+	if v := os.Getenv("WIN_SOUND_RABBITMQ_ALTERNATE_EXCHANGE"); v != "" {
+		cfg.AlternateExchange = v
+	}
+	if v := strings.TrimSpace(os.Getenv("WIN_SOUND_RABBITMQ_HOST_QUARANTINE_SEC")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid WIN_SOUND_RABBITMQ_HOST_QUARANTINE_SEC %q: %w", v, err)
+		}
+		if n < 0 {
+			return Config{}, fmt.Errorf("WIN_SOUND_RABBITMQ_HOST_QUARANTINE_SEC can not be negative %q", v)
+		}
+		cfg.HostQuarantine = time.Duration(n) * time.Second
+	}
+
+	cfg = cfg.withDefaults()
+	if err := cfg.validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
 }
 
 func splitHostPort(raw string) (string, int, bool) {
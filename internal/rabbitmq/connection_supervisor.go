@@ -0,0 +1,230 @@
+package rabbitmq
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ConnectionState is the publisher connection state, as reported by State and the state handler.
+type ConnectionState int
+
+const (
+	// StateConnecting means there is no usable channel and the supervisor is (re)connecting.
+	StateConnecting ConnectionState = iota
+	// StateReady means publishes go out immediately.
+	StateReady
+	// StateBlocked means the broker raised a resource alarm; publishes wait until it clears.
+	StateBlocked
+	// StateClosed means the publisher was closed and publishes fail.
+	StateClosed
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateReady:
+		return "ready"
+	case StateBlocked:
+		return "blocked"
+	case StateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// connectionEvents are the notifications the supervisor watches for one connection and its channel.
+type connectionEvents struct {
+	connClosed <-chan *amqp.Error
+	chanClosed <-chan *amqp.Error
+	blocked    <-chan amqp.Blocking
+}
+
+func subscribeConnectionEvents(conn publishConnection, ch publishChannel) connectionEvents {
+	// Buffered, as amqp091 blocks its reader goroutine on notifications nobody takes.
+	return connectionEvents{
+		connClosed: conn.NotifyClose(make(chan *amqp.Error, 1)),
+		chanClosed: ch.NotifyClose(make(chan *amqp.Error, 1)),
+		blocked:    conn.NotifyBlocked(make(chan amqp.Blocking, 4)),
+	}
+}
+
+// State reports the current connection state.
+func (p *RequestPublisher) State() ConnectionState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state
+}
+
+// SetStateHandler registers h to be called on every connection state change.
+// h is called with the publisher locked and must not block or publish.
+func (p *RequestPublisher) SetStateHandler(h func(ConnectionState)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onStateChange = h
+}
+
+// startSupervisor starts the goroutine that watches the connection and reconnects it when it is lost.
+func (p *RequestPublisher) startSupervisor(ctx context.Context) {
+	loopCtx, cancel := context.WithCancel(ctx)
+	p.stopLoop = cancel
+	p.loopDone = make(chan struct{})
+
+	go p.supervise(loopCtx)
+}
+
+func (p *RequestPublisher) supervise(ctx context.Context) {
+	defer close(p.loopDone)
+
+	for {
+		p.mu.Lock()
+		session, events := p.session, p.events
+		p.mu.Unlock()
+
+		if session == nil {
+			if !p.connectWithBackoff(ctx) {
+				return
+			}
+			continue
+		}
+		if !p.watch(ctx, session, events) {
+			return
+		}
+	}
+}
+
+// watch follows one session until its connection or channel goes away. It returns false when the supervisor stops.
+func (p *RequestPublisher) watch(ctx context.Context, session *confirmSession, events connectionEvents) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case b, ok := <-events.blocked:
+			if !ok {
+				// Closed together with the connection, which connClosed reports.
+				events.blocked = nil
+				continue
+			}
+			p.setBlocked(session, b)
+		case err := <-events.connClosed:
+			p.lost(session, "connection", err)
+			return true
+		case err := <-events.chanClosed:
+			p.lost(session, "channel", err)
+			return true
+		}
+	}
+}
+
+func (p *RequestPublisher) setBlocked(session *confirmSession, b amqp.Blocking) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.session != session {
+		return
+	}
+	if b.Active {
+		p.logf("[warn] RabbitMQ broker blocked publishing: %s", b.Reason)
+		p.setStateLocked(StateBlocked)
+	} else {
+		p.logf("[info] RabbitMQ broker unblocked publishing")
+		p.setStateLocked(StateReady)
+	}
+}
+
+// lost drops the session after its connection or channel closed, unless the publisher already replaced it.
+func (p *RequestPublisher) lost(session *confirmSession, what string, err *amqp.Error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.session != session {
+		return
+	}
+	p.logf("[warn] RabbitMQ %s closed (%v), reconnecting in the background", what, err)
+	_ = p.closeLocked()
+	p.setStateLocked(StateConnecting)
+}
+
+// connectWithBackoff retries without limit, with jittered exponential backoff between attempts.
+// It returns false when the supervisor stops first.
+func (p *RequestPublisher) connectWithBackoff(ctx context.Context) bool {
+	delay := p.cfg.InitialReconnectDelay
+	started := time.Now()
+
+	for attempt := 1; ; attempt++ {
+		if p.connectInBackground(attempt, time.Since(started)) {
+			return true
+		}
+		if !sleepCtx(ctx, jitter(delay)) {
+			return false
+		}
+		delay = minDuration(delay*2, p.cfg.MaxReconnectDelay)
+	}
+}
+
+// connectInBackground dials without holding the publisher lock, so publishes are not held up meanwhile.
+func (p *RequestPublisher) connectInBackground(attempt int, disconnectedFor time.Duration) bool {
+	conn, session, events, err := p.open()
+	if err != nil {
+		p.logf("[warn] RabbitMQ producer disconnected for %s, connect attempt %d failed: %v", disconnectedFor.Round(time.Second), attempt, err)
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.session != nil || p.state == StateClosed {
+		_ = session.close()
+		_ = conn.Close()
+		return true
+	}
+	p.installLocked(conn, session, events)
+	p.logf("[info] RabbitMQ producer connected on attempt %d", attempt)
+	return true
+}
+
+// setStateLocked records s and wakes the publishes waiting for the publisher to become ready or closed.
+func (p *RequestPublisher) setStateLocked(s ConnectionState) {
+	previous := p.state
+	if previous == s {
+		return
+	}
+	p.state = s
+
+	wasSettled := previous == StateReady || previous == StateClosed
+	settled := s == StateReady || s == StateClosed
+	switch {
+	case settled && !wasSettled:
+		close(p.ready)
+	case !settled && wasSettled:
+		p.ready = make(chan struct{})
+	}
+
+	if p.onStateChange != nil {
+		p.onStateChange(s)
+	}
+}
+
+// jitter spreads reconnects of many scanners over [d/2, d), so they do not hit a recovering broker at once.
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	half := d / 2
+	return half + rand.N(d-half)
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,125 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHostQuarantine = 30 * time.Second
+
+	SelectRoundRobin = "round-robin"
+	SelectPriority   = "priority"
+)
+
+// Endpoint is one broker node.
+type Endpoint struct {
+	Host string
+	Port int
+}
+
+func (e Endpoint) String() string {
+	return net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+}
+
+// parseEndpoints parses a comma-separated host[:port] list; a missing port is left 0 for withDefaults.
+func parseEndpoints(raw string) ([]Endpoint, error) {
+	var endpoints []Endpoint
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if host, port, ok := splitHostPort(entry); ok {
+			endpoints = append(endpoints, Endpoint{Host: host, Port: port})
+			continue
+		}
+		host := strings.Trim(entry, "[]")
+		if strings.Contains(entry, ":") && net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("invalid host:port %q", entry)
+		}
+		endpoints = append(endpoints, Endpoint{Host: host})
+	}
+	return endpoints, nil
+}
+
+func endpointList(endpoints []Endpoint) string {
+	names := make([]string, len(endpoints))
+	for i, e := range endpoints {
+		names[i] = e.String()
+	}
+	return strings.Join(names, ",")
+}
+
+// nodeSelector picks the broker node for each connect attempt and remembers failed nodes
+// for the quarantine period, so dead nodes are skipped while a healthy one is left.
+type nodeSelector struct {
+	nodes      []Endpoint
+	priority   bool
+	quarantine time.Duration
+	now        func() time.Time
+
+	mu        sync.Mutex
+	next      int
+	deadUntil []time.Time
+}
+
+func newNodeSelector(cfg Config) *nodeSelector {
+	return &nodeSelector{
+		nodes:      cfg.Endpoints,
+		priority:   cfg.HostSelection == SelectPriority,
+		quarantine: cfg.HostQuarantine,
+		now:        time.Now,
+		deadUntil:  make([]time.Time, len(cfg.Endpoints)),
+	}
+}
+
+// pick returns the first healthy node in list order (priority) or after the last pick (round-robin).
+// When every node is quarantined, the one whose quarantine ends first is tried anyway.
+func (s *nodeSelector) pick() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start := s.next
+	if s.priority {
+		start = 0
+	}
+
+	now := s.now()
+	chosen := -1
+	for n := 0; n < len(s.nodes); n++ {
+		i := (start + n) % len(s.nodes)
+		if !now.Before(s.deadUntil[i]) {
+			chosen = i
+			break
+		}
+		if chosen < 0 || s.deadUntil[i].Before(s.deadUntil[chosen]) {
+			chosen = i
+		}
+	}
+
+	s.next = (chosen + 1) % len(s.nodes)
+	return chosen
+}
+
+// report records the outcome of a connect attempt to node i.
+func (s *nodeSelector) report(i int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		s.deadUntil[i] = s.now().Add(s.quarantine)
+	} else {
+		s.deadUntil[i] = time.Time{}
+	}
+}
+
+// config returns cfg pointed at node i.
+func (s *nodeSelector) config(cfg Config, i int) Config {
+	cfg.Host, cfg.Port = s.nodes[i].Host, s.nodes[i].Port
+	return cfg
+}
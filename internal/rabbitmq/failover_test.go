@@ -0,0 +1,88 @@
+package rabbitmq
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestSelector(selection string) (*nodeSelector, *time.Time) {
+	cfg := Config{
+		Endpoints:     []Endpoint{{Host: "a"}, {Host: "b"}, {Host: "c", Port: 5671}},
+		HostSelection: selection,
+	}.withDefaults()
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	s := newNodeSelector(cfg)
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestNodeSelector_RoundRobinRotatesAndSkipsDeadNodes(t *testing.T) {
+	s, _ := newTestSelector(SelectRoundRobin)
+
+	if got := []int{s.pick(), s.pick(), s.pick(), s.pick()}; got[0] != 0 || got[1] != 1 || got[2] != 2 || got[3] != 0 {
+		t.Fatalf("expected rotation 0,1,2,0, got %v", got)
+	}
+
+	s.report(1, errors.New("connection refused"))
+	if got := []int{s.pick(), s.pick()}; got[0] != 2 || got[1] != 0 {
+		t.Fatalf("expected the dead node 1 to be skipped, got %v", got)
+	}
+}
+
+func TestNodeSelector_PriorityPrefersTheFirstHealthyNode(t *testing.T) {
+	s, now := newTestSelector(SelectPriority)
+
+	s.report(0, errors.New("connection refused"))
+	if got := s.pick(); got != 1 {
+		t.Fatalf("expected node 1 while node 0 is quarantined, got %d", got)
+	}
+	if got := s.pick(); got != 1 {
+		t.Fatalf("expected node 1 again, got %d", got)
+	}
+
+	*now = now.Add(defaultHostQuarantine)
+	if got := s.pick(); got != 0 {
+		t.Fatalf("expected node 0 back after the quarantine, got %d", got)
+	}
+}
+
+func TestNodeSelector_AllDeadTriesTheEarliestRecovery(t *testing.T) {
+	s, now := newTestSelector(SelectPriority)
+
+	s.report(1, errors.New("down"))
+	*now = now.Add(time.Second)
+	s.report(0, errors.New("down"))
+	s.report(2, errors.New("down"))
+
+	if got := s.pick(); got != 1 {
+		t.Fatalf("expected node 1, whose quarantine ends first, got %d", got)
+	}
+}
+
+func TestLoadConfigFromEnv_Hosts(t *testing.T) {
+	t.Setenv("WIN_SOUND_RABBITMQ_HOSTS", "a:5672, b ,c:5671")
+	t.Setenv("WIN_SOUND_RABBITMQ_HOST_SELECTION", "priority")
+
+	cfg, err := LoadConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Endpoint{{"a", 5672}, {"b", 5672}, {"c", 5671}}
+	if len(cfg.Endpoints) != len(want) {
+		t.Fatalf("expected %v, got %v", want, cfg.Endpoints)
+	}
+	for i := range want {
+		if cfg.Endpoints[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, cfg.Endpoints)
+		}
+	}
+	if cfg.HostSelection != SelectPriority {
+		t.Fatalf("expected priority selection, got %q", cfg.HostSelection)
+	}
+
+	t.Setenv("WIN_SOUND_RABBITMQ_HOSTS", "a:notaport")
+	if _, err := LoadConfigFromEnv(); err == nil {
+		t.Fatal("expected an error for an invalid port")
+	}
+}
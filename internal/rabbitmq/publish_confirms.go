@@ -0,0 +1,228 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var errChannelClosed = errors.New("rabbitmq channel closed before the publish was confirmed")
+
+// UnroutableError fails a mandatory publish that the broker returned because no queue is bound for its routing key.
+type UnroutableError struct {
+	Exchange   string
+	RoutingKey string
+	MessageID  string
+	ReplyCode  uint16
+	ReplyText  string
+}
+
+func (e *UnroutableError) Error() string {
+	return fmt.Sprintf("message %q returned as unroutable: exchange %q routes routing key %q to no queue (%d %s)",
+		e.MessageID, e.Exchange, e.RoutingKey, e.ReplyCode, e.ReplyText)
+}
+
+// Temporary reports true: once a queue is bound for the routing key, publishing the message again succeeds.
+// It is not permanent, so the outbox keeps the message rather than losing it to a wrong binding.
+func (e *UnroutableError) Temporary() bool {
+	return true
+}
+
+// publishChannel is the part of *amqp.Channel the publisher needs; tests and benchmarks use a fake.
+type publishChannel interface {
+	Confirm(noWait bool) error
+	NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation
+	NotifyReturn(c chan amqp.Return) chan amqp.Return
+	GetNextPublishSeqNo() uint64
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	NotifyClose(c chan *amqp.Error) chan *amqp.Error
+	Close() error
+}
+
+// publishConnection is the part of *amqp.Connection the connection supervisor needs.
+type publishConnection interface {
+	NotifyClose(c chan *amqp.Error) chan *amqp.Error
+	NotifyBlocked(c chan amqp.Blocking) chan amqp.Blocking
+	Close() error
+}
+
+// publishDialer opens a connection and a declared channel for publishing.
+type publishDialer func(cfg Config) (publishConnection, publishChannel, error)
+
+func dialPublishChannel(cfg Config) (publishConnection, publishChannel, error) {
+	conn, ch, err := dialAndDeclare(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, ch, nil
+}
+
+// confirmSession correlates the publisher confirms of one channel with the publishes waiting for them.
+// Confirms are matched by delivery tag, so a late confirm can never be taken for another message's.
+// Messages are published mandatory; a message the broker returns fails with *UnroutableError.
+type confirmSession struct {
+	ch publishChannel
+
+	mu      sync.Mutex
+	pending map[uint64]*pendingPublish
+	closed  bool
+
+	done chan struct{}
+}
+
+// pendingPublish is a publish waiting for its confirm.
+type pendingPublish struct {
+	result     chan error
+	exchange   string
+	routingKey string
+	messageID  string
+	// returned is set when the broker returned the message; its confirm follows.
+	returned *amqp.Return
+}
+
+func newConfirmSession(ch publishChannel, capacity int) (*confirmSession, error) {
+	if err := ch.Confirm(false); err != nil {
+		return nil, fmt.Errorf("confirm mode failed: %w", err)
+	}
+
+	s := &confirmSession{
+		ch:      ch,
+		pending: make(map[uint64]*pendingPublish),
+		done:    make(chan struct{}),
+	}
+	go s.run(ch.NotifyPublish(make(chan amqp.Confirmation, capacity)), ch.NotifyReturn(make(chan amqp.Return, capacity)))
+	return s, nil
+}
+
+// publish sends one message and returns its delivery tag and the channel its result arrives on.
+// Publishes on a channel must be serialized by the caller, so the tag read before the publish is the one it gets.
+func (s *confirmSession) publish(ctx context.Context, exchange, key string, msg amqp.Publishing) (uint64, <-chan error, error) {
+	tag := s.ch.GetNextPublishSeqNo()
+	result := make(chan error, 1)
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return 0, nil, errChannelClosed
+	}
+	s.pending[tag] = &pendingPublish{result: result, exchange: exchange, routingKey: key, messageID: msg.MessageId}
+	s.mu.Unlock()
+
+	if err := s.ch.PublishWithContext(ctx, exchange, key, true, false, msg); err != nil {
+		s.forget(tag)
+		return 0, nil, fmt.Errorf("publish call failed: %w", err)
+	}
+	return tag, result, nil
+}
+
+// forget drops a publish that is no longer waited for; its confirm, if any, is then ignored.
+func (s *confirmSession) forget(tag uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, tag)
+}
+
+func (s *confirmSession) outstanding() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+// run resolves confirms until the channel closes, then fails everything still in flight.
+func (s *confirmSession) run(confirms <-chan amqp.Confirmation, returns <-chan amqp.Return) {
+	defer close(s.done)
+
+	for confirms != nil {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			s.markReturned(r)
+		case c, ok := <-confirms:
+			if !ok {
+				confirms = nil
+				continue
+			}
+			// The broker sends a return before the confirm of the same message; take it first.
+			s.drainReturns(returns)
+			s.resolve(c)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for tag, p := range s.pending {
+		p.result <- errChannelClosed
+		delete(s.pending, tag)
+	}
+}
+
+func (s *confirmSession) resolve(c amqp.Confirmation) {
+	s.mu.Lock()
+	p, ok := s.pending[c.DeliveryTag]
+	delete(s.pending, c.DeliveryTag)
+	s.mu.Unlock()
+
+	switch {
+	case !ok:
+	case !c.Ack:
+		p.result <- fmt.Errorf("message NOT ACKed (deliveryTag=%d)", c.DeliveryTag)
+	case p.returned != nil:
+		p.result <- &UnroutableError{
+			Exchange:   p.exchange,
+			RoutingKey: p.routingKey,
+			MessageID:  p.messageID,
+			ReplyCode:  p.returned.ReplyCode,
+			ReplyText:  p.returned.ReplyText,
+		}
+	default:
+		p.result <- nil
+	}
+}
+
+func (s *confirmSession) drainReturns(returns <-chan amqp.Return) {
+	for {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				return
+			}
+			s.markReturned(r)
+		default:
+			return
+		}
+	}
+}
+
+// markReturned attributes a returned message to the oldest pending publish with the same exchange,
+// routing key and message ID; the broker returns messages in publish order.
+func (s *confirmSession) markReturned(r amqp.Return) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var oldest uint64
+	for tag, p := range s.pending {
+		if p.returned != nil || p.exchange != r.Exchange || p.routingKey != r.RoutingKey || p.messageID != r.MessageId {
+			continue
+		}
+		if oldest == 0 || tag < oldest {
+			oldest = tag
+		}
+	}
+	if oldest != 0 {
+		s.pending[oldest].returned = &r
+	}
+}
+
+// close closes the channel and waits until every in-flight publish has been resolved.
+func (s *confirmSession) close() error {
+	err := s.ch.Close()
+	<-s.done
+	return err
+}
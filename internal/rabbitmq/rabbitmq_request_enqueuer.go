@@ -4,30 +4,79 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
 	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/enqueuer"
 	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/logging"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/pkg/appinfo"
+	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+// HeaderSchemaVersion is the message header carrying the schema version of the body.
+const HeaderSchemaVersion = contract.FieldSchemaVersion
+
+const (
+	// BodyFlat publishes the flat v1 body.
+	BodyFlat = "v1"
+	// BodyEnvelope publishes the v2 contract.Envelope.
+	BodyEnvelope = "v2"
+	// BodyBoth publishes the v2 envelope with the flat v1 fields alongside, for consumers in migration.
+	BodyBoth = "both"
+)
+
+var bodyFormats = []string{BodyFlat, BodyEnvelope, BodyBoth}
+
+// Message is a request ready to publish: the routing key, the body and the AMQP properties
+// consumers use to deduplicate and route without parsing the body.
+type Message struct {
+	RoutingKey string
+	// MessageID is the same for every retry of a request, so consumers can drop duplicates.
+	MessageID string
+	// Type is the event name, e.g. "RenderVolumeChanged".
+	Type    string
+	Headers amqp.Table
+	Body    []byte
+}
+
+// publishing returns msg as an AMQP message published by this application.
+func (msg Message) publishing() amqp.Publishing {
+	return amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    time.Now().UTC(),
+		MessageId:    msg.MessageID,
+		Type:         msg.Type,
+		AppId:        appinfo.AppName + "/" + appinfo.Version,
+		Headers:      msg.Headers,
+		Body:         msg.Body,
+	}
+}
+
 // RabbitMessagePublisher is the publish contract expected from a RabbitMQ publisher.
 type RabbitMessagePublisher interface {
-	Publish(ctx context.Context, body []byte) error
+	Publish(ctx context.Context, msg Message) error
 	Close() error
 }
 
+// pipelinedPublisher is implemented by publishers that can publish without waiting for the confirm, like RequestPublisher.
+type pipelinedPublisher interface {
+	PublishAsync(ctx context.Context, msg Message) (wait func() error)
+	MaxInFlight() int
+}
+
 // RabbitMqEnqueuer writes requests to RabbitMQ using the same message-shaping
 type RabbitMqEnqueuer struct {
 	baseCtx        context.Context
 	publisher      RabbitMessagePublisher
+	routingKeys    RoutingKeys
+	bodyFormat     string
 	logger         logging.Logger
 	publishTimeout time.Duration
+	now            func() time.Time
 }
 
-func NewRabbitMqEnqueuerWithContext(baseCtx context.Context, publisher RabbitMessagePublisher, logger logging.Logger) *RabbitMqEnqueuer {
+func NewRabbitMqEnqueuerWithContext(baseCtx context.Context, publisher RabbitMessagePublisher, routingKeys RoutingKeys, bodyFormat string, logger logging.Logger) *RabbitMqEnqueuer {
 	if baseCtx == nil {
 		panic("nil context")
 	}
@@ -41,6 +90,8 @@ func NewRabbitMqEnqueuerWithContext(baseCtx context.Context, publisher RabbitMes
 	return newRabbitMqEnqueuer(
 		baseCtx,
 		publisher,
+		routingKeys,
+		bodyFormat,
 		logger,
 		10*time.Second,
 	)
@@ -49,137 +100,136 @@ func NewRabbitMqEnqueuerWithContext(baseCtx context.Context, publisher RabbitMes
 func newRabbitMqEnqueuer(
 	baseCtx context.Context,
 	publisher RabbitMessagePublisher,
+	routingKeys RoutingKeys,
+	bodyFormat string,
 	logger logging.Logger,
 	publishTimeout time.Duration,
 ) *RabbitMqEnqueuer {
 	if publishTimeout <= 0 {
 		publishTimeout = 10 * time.Second
 	}
+	if bodyFormat == "" {
+		bodyFormat = BodyFlat
+	}
 
 	return &RabbitMqEnqueuer{
 		baseCtx:        baseCtx,
 		publisher:      publisher,
+		routingKeys:    routingKeys,
+		bodyFormat:     bodyFormat,
 		logger:         logger,
 		publishTimeout: publishTimeout,
+		now:            time.Now,
 	}
 }
 
 func (e *RabbitMqEnqueuer) EnqueueRequest(request enqueuer.Request) error {
-	payload := make(map[string]any, len(request.Fields)+4)
-	for key, value := range request.Fields {
-		payload[key] = normalizeValue(key, value)
-	}
-
-	flowType, messageType := calculateFlowAndMessageType(request.Event)
-	payload[contract.FieldDeviceMessageType] = messageType
-
-	httpRequest, urlSuffix := e.resolveHttpRequest(request, payload)
-	payload[contract.FieldHTTPRequest] = httpRequest
-	payload[contract.FieldURLSuffix] = urlSuffix
-
-	if httpRequest == "POST" {
-		if flowType != 0 {
-			payload[contract.FieldFlowType] = flowType
-		}
-	}
-	if _, ok := payload[contract.FieldUpdateDate]; !ok && !request.Timestamp.IsZero() {
-		payload[contract.FieldUpdateDate] = request.Timestamp.UTC().Format(time.RFC3339)
-	}
+	return e.SendRequest(request)()
+}
 
-	body, err := json.Marshal(payload)
+// SendRequest publishes the request and returns without waiting for the confirm if the publisher
+// supports it; wait returns what EnqueueRequest would.
+func (e *RabbitMqEnqueuer) SendRequest(request enqueuer.Request) (wait func() error) {
+	msg, err := e.message(request)
 	if err != nil {
-		return fmt.Errorf("marshal rabbitmq payload: %w", err)
+		return func() error { return err }
 	}
 
-	e.logf("[info, rabbitmq enqueuer] publishing method=%s urlSuffix=%s", httpRequest, urlSuffix)
-
 	ctx, cancel := context.WithTimeout(e.baseCtx, e.publishTimeout)
-	defer cancel()
-	if err := e.publisher.Publish(ctx, body); err != nil {
-		return fmt.Errorf("publish request: %w", err)
+	publish := func() error { return e.publisher.Publish(ctx, msg) }
+	if pipelined, ok := e.publisher.(pipelinedPublisher); ok {
+		publish = pipelined.PublishAsync(ctx, msg)
+	}
+	return func() error {
+		defer cancel()
+		if err := publish(); err != nil {
+			return fmt.Errorf("publish request: %w", err)
+		}
+		return nil
 	}
-
-	return nil
 }
 
-func (e *RabbitMqEnqueuer) Close() error {
-	return e.publisher.Close()
+// MaxInFlight returns how many requests may wait for their confirms at the same time, 1 if the publisher
+// waits for every confirm.
+func (e *RabbitMqEnqueuer) MaxInFlight() int {
+	if pipelined, ok := e.publisher.(pipelinedPublisher); ok {
+		return pipelined.MaxInFlight()
+	}
+	return 1
 }
 
-func (e *RabbitMqEnqueuer) resolveHttpRequest(request enqueuer.Request, payload map[string]any) (string, string) {
-	var httpRequest string
-
-	switch request.Event {
-	case contract.EventTypeRenderDeviceDiscovered,
-		contract.EventTypeCaptureDeviceDiscovered,
-		contract.EventTypeRenderDeviceConfirmed,
-		contract.EventTypeCaptureDeviceConfirmed:
-		httpRequest = "POST"
-	default:
-		httpRequest = "PUT"
-	}
+// message shapes the request into the message to publish.
+func (e *RabbitMqEnqueuer) message(request enqueuer.Request) (Message, error) {
+	restRequest := enqueuer.NewRestRequest(request)
+	httpRequest, urlSuffix := restRequest.Method, restRequest.URLSuffix
 
-	urlSuffix := readStringField(payload, contract.FieldURLSuffix)
-	if urlSuffix == "" && httpRequest == "PUT" {
-		pnpID := readStringField(payload, contract.FieldPnpID)
-		hostName := readStringField(payload, contract.FieldHostName)
+	payload := restRequest.Payload
+	payload[contract.FieldHTTPRequest] = httpRequest
+	payload[contract.FieldURLSuffix] = urlSuffix
 
-		urlSuffix = fmt.Sprintf("/%s/%s", pnpID, hostName)
-		delete(payload, contract.FieldHostName) // contract.FieldHostName is only used for building the URL suffix, so we must remove it from the payload
+	body, schemaVersion := e.body(request, payload)
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return Message{}, fmt.Errorf("marshal rabbitmq payload: %w", err)
 	}
 
-	return httpRequest, urlSuffix
-}
-
-func readStringField(payload map[string]any, key string) string {
-	if v, ok := payload[key]; ok {
-		s, okString := v.(string)
-		if okString {
-			return strings.TrimSpace(s)
-		}
+	msg := Message{
+		RoutingKey: e.routingKeys.Key(request, restRequest),
+		MessageID:  request.ID(),
+		Type:       request.Event.String(),
+		Headers:    messageHeaders(request, restRequest, schemaVersion),
+		Body:       raw,
 	}
-	return ""
+	e.logf("[info, rabbitmq enqueuer] publishing method=%s urlSuffix=%s routingKey=%s messageId=%s", httpRequest, urlSuffix, msg.RoutingKey, msg.MessageID)
+	return msg, nil
 }
 
-func calculateFlowAndMessageType(event contract.EventType) (contract.FlowType, contract.MessageType) {
-
-	var flow contract.FlowType
-	var message contract.MessageType
-
-	switch event {
-	case contract.EventTypeRenderDeviceConfirmed, contract.EventTypeRenderDeviceDiscovered, contract.EventTypeRenderVolumeChanged:
-		flow = contract.FlowTypeRender
-	case contract.EventTypeCaptureDeviceConfirmed, contract.EventTypeCaptureDeviceDiscovered, contract.EventTypeCaptureVolumeChanged:
-		flow = contract.FlowTypeCapture
-	default:
-		flow = 0
+// body returns the message body in the configured format and its schema version.
+func (e *RabbitMqEnqueuer) body(request enqueuer.Request, payload map[string]any) (any, int) {
+	if e.bodyFormat == BodyFlat {
+		return payload, contract.SchemaVersionFlat
 	}
 
-	switch event {
-	case contract.EventTypeRenderDeviceConfirmed, contract.EventTypeCaptureDeviceConfirmed:
-		message = contract.MessageTypeConfirmed
-	case contract.EventTypeRenderDeviceDiscovered, contract.EventTypeCaptureDeviceDiscovered:
-		message = contract.MessageTypeDiscovered
-	case contract.EventTypeRenderVolumeChanged:
-		message = contract.MessageTypeVolumeRenderChanged
-	case contract.EventTypeCaptureVolumeChanged:
-		message = contract.MessageTypeVolumeCaptureChanged
-	default:
-		message = 0
+	envelope := contract.Envelope{
+		SchemaVersion: contract.SchemaVersionEnvelope,
+		EventID:       request.ID(),
+		EventType:     request.Event.String(),
+		OccurredAt:    request.Timestamp.UTC(),
+		PublishedAt:   e.now().UTC(),
+		Source: contract.Source{
+			Host:    request.Data.Ref().HostName,
+			App:     appinfo.AppName,
+			Version: appinfo.Version,
+		},
+		Payload: payload,
+	}
+	if e.bodyFormat == BodyEnvelope {
+		return envelope, contract.SchemaVersionEnvelope
 	}
 
-	return flow, message
+	both := envelope.Fields()
+	for key, value := range payload {
+		both[key] = value
+	}
+	return both, contract.SchemaVersionEnvelope
 }
 
-func normalizeValue(key string, value string) any {
-	trimmed := strings.TrimSpace(value)
-	switch key {
-	case contract.FieldRenderVolume, contract.FieldCaptureVolume, contract.FieldVolume:
-		if n, err := strconv.Atoi(trimmed); err == nil {
-			return n
-		}
+// messageHeaders returns the host, flow type, message type and schema version of the request.
+// The host is taken from the request, as PUT payloads leave it out.
+func messageHeaders(request enqueuer.Request, rest enqueuer.RestRequest, schemaVersion int) amqp.Table {
+	headers := amqp.Table{
+		contract.FieldFlowType:          int32(rest.FlowType),
+		contract.FieldDeviceMessageType: int32(rest.MessageType),
+		HeaderSchemaVersion:             int32(schemaVersion),
 	}
-	return value
+	if host := request.Data.Ref().HostName; host != "" {
+		headers[contract.FieldHostName] = host
+	}
+	return headers
+}
+
+func (e *RabbitMqEnqueuer) Close() error {
+	return e.publisher.Close()
 }
 
 func (e *RabbitMqEnqueuer) logf(format string, args ...interface{}) {
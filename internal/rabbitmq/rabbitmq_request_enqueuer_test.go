@@ -0,0 +1,106 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"reflect"
+	"testing"
+	"time"
+
+	c "github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/enqueuer"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestEnqueueRequest_SetsMessageProperties(t *testing.T) {
+	publisher := &recordingPublisher{}
+	e := NewRabbitMqEnqueuerWithContext(context.Background(), publisher, RoutingKeys{fixed: "sdr_bind"}, BodyFlat, log.New(io.Discard, "", 0))
+
+	request := enqueuer.Request{
+		Timestamp: time.Date(2026, 10, 16, 8, 30, 0, 0, time.UTC),
+		Event:     c.EventTypeCaptureVolumeChanged,
+		Data:      c.VolumeChange{DeviceRef: c.DeviceRef{HostName: "studio-pc", PnpID: "mic"}, Volume: 40},
+	}
+	// The retry of a failed publish must carry the same message ID.
+	for i := 0; i < 2; i++ {
+		if err := e.EnqueueRequest(request); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first, retry := publisher.messages[0], publisher.messages[1]
+	if first.MessageID == "" || first.MessageID != retry.MessageID {
+		t.Fatalf("expected a stable message ID, got %q and %q", first.MessageID, retry.MessageID)
+	}
+	if first.Type != "CaptureVolumeChanged" {
+		t.Fatalf("expected type CaptureVolumeChanged, got %q", first.Type)
+	}
+	wantHeaders := amqp.Table{
+		c.FieldHostName:          "studio-pc",
+		c.FieldFlowType:          int32(c.FlowTypeCapture),
+		c.FieldDeviceMessageType: int32(c.MessageTypeVolumeCaptureChanged),
+		HeaderSchemaVersion:      int32(c.SchemaVersionFlat),
+	}
+	if !reflect.DeepEqual(first.Headers, wantHeaders) {
+		t.Fatalf("expected headers %v, got %v", wantHeaders, first.Headers)
+	}
+	if err := first.Headers.Validate(); err != nil {
+		t.Fatalf("headers are not a valid AMQP table: %v", err)
+	}
+}
+
+func TestEnqueueRequest_BodyFormats(t *testing.T) {
+	request := enqueuer.Request{
+		Timestamp: time.Date(2026, 10, 16, 8, 30, 0, 0, time.UTC),
+		Event:     c.EventTypeRenderMuteChanged,
+		Data:      c.MuteChange{DeviceRef: c.DeviceRef{HostName: "studio-pc", PnpID: "spk"}, Muted: true},
+	}
+	publishedAt := time.Date(2026, 10, 16, 8, 30, 5, 0, time.UTC)
+
+	for _, format := range []string{BodyFlat, BodyEnvelope, BodyBoth} {
+		t.Run(format, func(t *testing.T) {
+			publisher := &recordingPublisher{}
+			e := newRabbitMqEnqueuer(context.Background(), publisher, RoutingKeys{fixed: "sdr_bind"}, format, log.New(io.Discard, "", 0), time.Second)
+			e.now = func() time.Time { return publishedAt }
+			if err := e.EnqueueRequest(request); err != nil {
+				t.Fatal(err)
+			}
+
+			msg := publisher.messages[0]
+			var body map[string]any
+			if err := json.Unmarshal(msg.Body, &body); err != nil {
+				t.Fatal(err)
+			}
+			flat := body
+			if format != BodyFlat {
+				if body[c.FieldSchemaVersion] != float64(2) || body[c.FieldEventID] != msg.MessageID || body[c.FieldEventType] != "RenderMuteChanged" {
+					t.Fatalf("unexpected envelope %v", body)
+				}
+				if body[c.FieldOccurredAt] != "2026-10-16T08:30:00Z" || body[c.FieldPublishedAt] != "2026-10-16T08:30:05Z" {
+					t.Fatalf("unexpected envelope times %v", body)
+				}
+				if source, _ := body[c.FieldSource].(map[string]any); source["host"] != "studio-pc" || source["app"] != "win-sound-scanner" {
+					t.Fatalf("unexpected envelope source %v", body[c.FieldSource])
+				}
+				flat, _ = body[c.FieldPayload].(map[string]any)
+			}
+			if flat[c.FieldHTTPRequest] != "PUT" || flat[c.FieldMuted] != true {
+				t.Fatalf("unexpected flat body %v", flat)
+			}
+
+			_, hasFlatFields := body[c.FieldHTTPRequest]
+			if hasFlatFields != (format != BodyEnvelope) {
+				t.Fatalf("%s: unexpected top-level fields %v", format, body)
+			}
+			wantVersion := int32(c.SchemaVersionEnvelope)
+			if format == BodyFlat {
+				wantVersion = c.SchemaVersionFlat
+			}
+			if msg.Headers[HeaderSchemaVersion] != wantVersion {
+				t.Fatalf("expected schema version header %d, got %v", wantVersion, msg.Headers[HeaderSchemaVersion])
+			}
+		})
+	}
+}
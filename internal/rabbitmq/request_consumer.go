@@ -0,0 +1,123 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// RequestConsumer consumes request messages with manual acknowledgements and reconnects when the channel closes.
+type RequestConsumer struct {
+	cfg    Config
+	logger Logger
+	nodes  *nodeSelector
+
+	conn *amqp.Connection
+	ch   *amqp.Channel
+
+	// subscribe connects and starts consuming the queue; tests replace it.
+	subscribe func() (<-chan amqp.Delivery, error)
+}
+
+func NewRequestConsumer(cfg Config, logger Logger) *RequestConsumer {
+	if logger == nil {
+		panic("nil logger")
+	}
+
+	cfg = cfg.withDefaults()
+	c := &RequestConsumer{
+		cfg:    cfg,
+		logger: logger,
+		nodes:  newNodeSelector(cfg),
+	}
+	c.subscribe = c.subscribeOnce
+	return c
+}
+
+// Consume passes the delivery channel of each session to handle until ctx is done.
+// handle must ack or nack every delivery and return when the channel is closed.
+// Like the producer supervisor, it reconnects without limit, with jittered exponential backoff;
+// only an error of handle ends it early.
+func (c *RequestConsumer) Consume(ctx context.Context, handle func(ctx context.Context, deliveries <-chan amqp.Delivery) error) error {
+	if ctx == nil {
+		panic("nil context")
+	}
+	defer func() { _ = c.close() }()
+
+	delay := c.cfg.InitialReconnectDelay
+	for attempt := 1; ; attempt++ {
+		deliveries, err := c.subscribe()
+		if err != nil {
+			c.logf("[warn] RabbitMQ consumer connect attempt %d failed: %v. Retrying in %s...", attempt, err, delay)
+			if !sleepCtx(ctx, jitter(delay)) {
+				return nil
+			}
+			delay = minDuration(delay*2, c.cfg.MaxReconnectDelay)
+			continue
+		}
+		c.logf("[info] Consuming queue=%s prefetch=%d", c.cfg.QueueName, c.cfg.PrefetchCount)
+		attempt, delay = 0, c.cfg.InitialReconnectDelay
+
+		if err := handle(ctx, deliveries); err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		c.logf("[warn] RabbitMQ consumer channel closed, reconnecting")
+	}
+}
+
+func (c *RequestConsumer) subscribeOnce() (<-chan amqp.Delivery, error) {
+	if err := c.connectOnce(); err != nil {
+		return nil, err
+	}
+	deliveries, err := c.ch.Consume(c.cfg.QueueName, "", false, false, false, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("consume %s failed: %w", c.cfg.QueueName, err)
+	}
+	return deliveries, nil
+}
+
+func (c *RequestConsumer) connectOnce() error {
+	_ = c.close()
+
+	node := c.nodes.pick()
+	nodeCfg := c.nodes.config(c.cfg, node)
+	conn, ch, err := dialAndDeclare(nodeCfg)
+	c.nodes.report(node, err)
+	if err != nil {
+		return fmt.Errorf("node %s: %w", c.nodes.nodes[node], err)
+	}
+	c.logf("[info] RabbitMQ consumer connected to node %s", c.nodes.nodes[node])
+	if err := ch.Qos(c.cfg.PrefetchCount, 0, false); err != nil {
+		_ = ch.Close()
+		_ = conn.Close()
+		return fmt.Errorf("qos failed: %w", err)
+	}
+
+	c.conn = conn
+	c.ch = ch
+	return nil
+}
+
+func (c *RequestConsumer) close() error {
+	var err error
+
+	if c.ch != nil {
+		err = errors.Join(err, c.ch.Close())
+		c.ch = nil
+	}
+	if c.conn != nil {
+		err = errors.Join(err, c.conn.Close())
+		c.conn = nil
+	}
+
+	return err
+}
+
+func (c *RequestConsumer) logf(format string, v ...interface{}) {
+	c.logger.Printf(format, v...)
+}
@@ -0,0 +1,54 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestConsume_KeepsReconnectingAfterFailures(t *testing.T) {
+	cfg := Config{MaxReconnectionAttempts: 1, InitialReconnectDelay: time.Millisecond, MaxReconnectDelay: 2 * time.Millisecond}
+	c := NewRequestConsumer(cfg, log.New(io.Discard, "", 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Fail more often than MaxReconnectionAttempts, lose a session, fail again, then stay connected.
+	attempts := 0
+	c.subscribe = func() (<-chan amqp.Delivery, error) {
+		attempts++
+		deliveries := make(chan amqp.Delivery)
+		switch {
+		case attempts <= 3, attempts == 5:
+			return nil, errors.New("connection refused")
+		case attempts == 4:
+			close(deliveries)
+		}
+		return deliveries, nil
+	}
+
+	sessions := 0
+	err := c.Consume(ctx, func(ctx context.Context, deliveries <-chan amqp.Delivery) error {
+		sessions++
+		if sessions == 2 {
+			cancel()
+		}
+		select {
+		case <-deliveries:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 6 || sessions != 2 {
+		t.Fatalf("expected 6 attempts and 2 sessions, got %d and %d", attempts, sessions)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -15,15 +16,38 @@ type Logger interface {
 	Printf(format string, v ...interface{})
 }
 
+var (
+	// ErrNotConnected is returned by Publish while a background connect is still in progress.
+	ErrNotConnected = errors.New("rabbitmq publisher is not connected")
+	// ErrClosed is returned by Publish after Close.
+	ErrClosed = errors.New("rabbitmq publisher is closed")
+)
+
 // RequestPublisher manages RabbitMQ connection, topology, and message publishing.
+// Up to Config.PublishMaxInFlight publishes may wait for their confirms at the same time.
+// A supervisor goroutine reconnects as soon as the connection or channel closes.
 type RequestPublisher struct {
-	cfg    Config
-	logger Logger
-
-	mu       sync.Mutex
-	conn     *amqp.Connection
-	ch       *amqp.Channel
-	confirms <-chan amqp.Confirmation
+	cfg      Config
+	logger   Logger
+	dial     publishDialer
+	nodes    *nodeSelector
+	inFlight chan struct{} // one slot per outstanding publish
+	// unroutable counts the messages the broker returned since the start.
+	unroutable atomic.Uint64
+
+	mu            sync.Mutex
+	conn          publishConnection
+	session       *confirmSession
+	events        connectionEvents
+	state         ConnectionState
+	ready         chan struct{} // closed while the state is ready or closed
+	connected     bool          // set after the first successful connect
+	missed        bool          // a publish failed with ErrNotConnected since the last connect
+	onReconnect   func()
+	onStateChange func(ConnectionState)
+
+	stopLoop context.CancelFunc
+	loopDone chan struct{}
 }
 
 func NewRequestPublisher(ctx context.Context, cfg Config, logger Logger) (*RequestPublisher, error) {
@@ -34,80 +58,211 @@ func NewRequestPublisher(ctx context.Context, cfg Config, logger Logger) (*Reque
 		panic("nil logger")
 	}
 
+	p := newRequestPublisher(cfg, logger, dialPublishChannel)
+	if err := p.start(ctx); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func newRequestPublisher(cfg Config, logger Logger, dial publishDialer) *RequestPublisher {
 	cfg = cfg.withDefaults()
 
-	p := &RequestPublisher{
-		cfg:    cfg,
-		logger: logger,
+	return &RequestPublisher{
+		cfg:      cfg,
+		logger:   logger,
+		dial:     dial,
+		nodes:    newNodeSelector(cfg),
+		inFlight: make(chan struct{}, cfg.PublishMaxInFlight),
+		state:    StateConnecting,
+		ready:    make(chan struct{}),
 	}
+}
 
-	if err := p.connectWithRetryLocked(ctx); err != nil {
-		return nil, err
+// start connects, unless Config.BackgroundConnect leaves that to the supervisor, and starts the supervisor.
+func (p *RequestPublisher) start(ctx context.Context) error {
+	if p.cfg.BackgroundConnect {
+		// Start degraded rather than fail, e.g. when the service starts before the network is up.
+		p.logf("[info] RabbitMQ producer connecting to %s in the background", endpointList(p.cfg.Endpoints))
+	} else {
+		p.mu.Lock()
+		err := p.connectWithRetryLocked(ctx)
+		p.mu.Unlock()
+		if err != nil {
+			return err
+		}
 	}
-	return p, nil
+
+	p.startSupervisor(ctx)
+	return nil
 }
 
-func (p *RequestPublisher) Publish(ctx context.Context, body []byte) error {
-	p.mu.Lock()
-	defer p.mu.Unlock()
+// Publish sends msg and waits for the broker confirm. Concurrent calls are pipelined:
+// each waits only for its own confirm, not for the publishes before it.
+// A failed publish is retried once, on the channel the supervisor reconnects; a message the broker
+// returned as unroutable fails with *UnroutableError right away.
+func (p *RequestPublisher) Publish(ctx context.Context, msg Message) error {
+	return p.PublishAsync(ctx, msg)()
+}
 
+// PublishAsync publishes msg and returns without waiting for the broker confirm; wait waits for it
+// and returns what Publish would. Consecutive calls publish in the order of the calls.
+// Every wait must be called: while MaxInFlight publishes are unwaited, PublishAsync blocks.
+func (p *RequestPublisher) PublishAsync(ctx context.Context, msg Message) (wait func() error) {
 	if ctx == nil {
 		panic("nil context")
 	}
 
-	if p.ch == nil {
-		if err := p.connectWithRetryLocked(ctx); err != nil {
-			return err
+	select {
+	case p.inFlight <- struct{}{}:
+	case <-ctx.Done():
+		err := ctx.Err()
+		return func() error { return err }
+	}
+
+	session, tag, result, err := p.publish(ctx, msg)
+	return func() error {
+		defer func() { <-p.inFlight }()
+
+		if err == nil {
+			err = p.awaitConfirm(ctx, session, tag, result, msg)
 		}
+		return p.settle(ctx, msg, session, err)
 	}
+}
 
-	if err := p.publishLocked(ctx, body); err == nil {
+// MaxInFlight returns how many publishes may wait for their confirms at the same time.
+func (p *RequestPublisher) MaxInFlight() int {
+	return cap(p.inFlight)
+}
+
+// settle retries a failed publish once; session is the one the publish failed on, nil if it never got to publish.
+func (p *RequestPublisher) settle(ctx context.Context, msg Message, session *confirmSession, err error) error {
+	if err == nil {
 		return nil
-	} else {
-		p.logf("[warn] RabbitMQ publish failed, reconnecting once: %v", err)
-		if recErr := p.connectWithRetryLocked(ctx); recErr != nil {
-			return fmt.Errorf("rabbitmq publish failed: %w (reconnect failed: %v)", err, recErr)
-		}
-		if retryErr := p.publishLocked(ctx, body); retryErr != nil {
-			return fmt.Errorf("rabbitmq publish failed after reconnect: %w", retryErr)
+	}
+	var unroutable *UnroutableError
+	if errors.As(err, &unroutable) {
+		// The channel is fine; publishing again only gets the message returned again.
+		p.unroutable.Add(1)
+		p.logf("[error] RabbitMQ message is unroutable, later events wait behind it until a queue is bound for its routing key; check the bindings of exchange %q (%d unroutable so far): %v",
+			unroutable.Exchange, p.unroutable.Load(), err)
+		return err
+	}
+	if session == nil || ctx.Err() != nil {
+		return err
+	}
+
+	p.logf("[warn] RabbitMQ publish failed, retrying once: %v", err)
+	p.discard(session)
+	if p.cfg.BackgroundConnect {
+		// Publishes fail right away while connecting in background mode, so wait for the reconnect first.
+		if retryErr := p.awaitReconnect(ctx); retryErr != nil {
+			return fmt.Errorf("rabbitmq publish failed: %w (retry failed: %v)", err, retryErr)
 		}
 	}
+	if _, retryErr := p.publishAndWait(ctx, msg); retryErr != nil {
+		return fmt.Errorf("rabbitmq publish failed: %w (retry failed: %v)", err, retryErr)
+	}
 
 	return nil
 }
 
+// Unroutable returns how many messages the broker returned as unroutable since the start.
+func (p *RequestPublisher) Unroutable() uint64 {
+	return p.unroutable.Load()
+}
+
+// SetReconnectHandler registers h to be called after every successful reconnect, not the initial connect.
+// h is called with the publisher locked and must not block or publish.
+func (p *RequestPublisher) SetReconnectHandler(h func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onReconnect = h
+}
+
 func (p *RequestPublisher) Close() error {
+	p.stopLoop()
+	<-p.loopDone
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	p.setStateLocked(StateClosed)
 	return p.closeLocked()
 }
 
-func (p *RequestPublisher) publishLocked(ctx context.Context, body []byte) error {
-	if p.ch == nil {
-		return errors.New("rabbitmq channel is not initialized")
+// publishAndWait publishes on the current session and waits for the matching confirm.
+// It returns the session used, so a failure discards it only if nobody replaced it yet,
+// or nil if it never got to publish.
+func (p *RequestPublisher) publishAndWait(ctx context.Context, msg Message) (*confirmSession, error) {
+	session, tag, result, err := p.publish(ctx, msg)
+	if err != nil {
+		return session, err
 	}
+	return session, p.awaitConfirm(ctx, session, tag, result, msg)
+}
 
-	err := p.ch.PublishWithContext(
-		ctx,
-		p.cfg.ExchangeName,
-		p.cfg.RoutingKey,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType:  "application/json",
-			DeliveryMode: amqp.Persistent,
-			Timestamp:    time.Now().UTC(),
-			Body:         body,
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("publish call failed: %w", err)
+// publish publishes on the current session, waiting while the publisher reconnects or is blocked.
+// It returns the session used, or nil if it never got to publish, and the delivery tag and result of the confirm.
+func (p *RequestPublisher) publish(ctx context.Context, msg Message) (*confirmSession, uint64, <-chan error, error) {
+	p.mu.Lock()
+	for p.state != StateReady {
+		switch {
+		case p.state == StateClosed:
+			p.mu.Unlock()
+			return nil, 0, nil, ErrClosed
+		case p.state == StateConnecting && p.cfg.BackgroundConnect:
+			p.missed = true
+			p.mu.Unlock()
+			return nil, 0, nil, ErrNotConnected
+		}
+
+		// Reconnecting, or blocked by a broker resource alarm.
+		ready := p.ready
+		p.mu.Unlock()
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return nil, 0, nil, ctx.Err()
+		}
+		p.mu.Lock()
+	}
+	session := p.session
+	tag, result, err := session.publish(ctx, p.cfg.ExchangeName, msg.RoutingKey, msg.publishing())
+	p.mu.Unlock()
+	return session, tag, result, err
+}
+
+// awaitReconnect waits up to Config.PublishConfirmTimeout for the supervisor to make the publisher ready again.
+// It returns ErrNotConnected when the broker cannot be reached in time, as a publish would.
+func (p *RequestPublisher) awaitReconnect(ctx context.Context) error {
+	timer := time.NewTimer(p.cfg.PublishConfirmTimeout)
+	defer timer.Stop()
+
+	p.mu.Lock()
+	for p.state == StateConnecting {
+		ready := p.ready
+		p.mu.Unlock()
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return ErrNotConnected
+		}
+		p.mu.Lock()
 	}
+	p.mu.Unlock()
+	return nil
+}
 
+// awaitConfirm waits for the confirm of the publish with tag on session.
+func (p *RequestPublisher) awaitConfirm(ctx context.Context, session *confirmSession, tag uint64, result <-chan error, msg Message) error {
 	confirmTimeout := p.cfg.PublishConfirmTimeout
 	if deadline, ok := ctx.Deadline(); ok {
 		remaining := time.Until(deadline)
 		if remaining <= 0 {
+			session.forget(tag)
 			return context.DeadlineExceeded
 		}
 		if remaining < confirmTimeout {
@@ -119,36 +274,68 @@ func (p *RequestPublisher) publishLocked(ctx context.Context, body []byte) error
 	defer timer.Stop()
 
 	select {
-	case c, ok := <-p.confirms:
-		if !ok {
-			return errors.New("rabbitmq confirms channel is closed")
-		}
-		if !c.Ack {
-			return fmt.Errorf("message NOT ACKed (deliveryTag=%d)", c.DeliveryTag)
+	case err := <-result:
+		if err != nil {
+			return err
 		}
-		p.logf("[debug] Message ACKed (routingKey=%s)", p.cfg.RoutingKey)
+		p.logf("[debug] Message ACKed (deliveryTag=%d, routingKey=%s, messageId=%s)", tag, msg.RoutingKey, msg.MessageID)
 		return nil
 	case <-ctx.Done():
+		session.forget(tag)
 		return ctx.Err()
 	case <-timer.C:
-		return fmt.Errorf("timed out waiting for publish confirmation after %s", confirmTimeout)
+		session.forget(tag)
+		return fmt.Errorf("timed out waiting for publish confirmation after %s (deliveryTag=%d)", confirmTimeout, tag)
 	}
 }
 
+// discard closes the failed session so that the supervisor reconnects, unless it was replaced already.
+// A blocked session is kept: its confirms are only late, and reconnecting does not lift the alarm.
+func (p *RequestPublisher) discard(failed *confirmSession) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.session != failed || p.state == StateBlocked {
+		return
+	}
+	_ = p.closeLocked()
+	p.setStateLocked(StateConnecting)
+}
+
 func (p *RequestPublisher) connectWithRetryLocked(ctx context.Context) error {
+	return connectWithRetry(ctx, p.cfg, p.logf, "producer", p.connectOnceLocked)
+}
+
+// installLocked makes the freshly opened session the one to publish on.
+func (p *RequestPublisher) installLocked(conn publishConnection, session *confirmSession, events connectionEvents) {
+	p.conn = conn
+	p.session = session
+	p.events = events
+	p.setStateLocked(StateReady)
+
+	// Calls the reconnect handler when messages may have been lost since the last connect.
+	if (p.connected || p.missed) && p.onReconnect != nil {
+		p.onReconnect()
+	}
+	p.connected = true
+	p.missed = false
+}
+
+// connectWithRetry calls connect until it succeeds, doubling the delay between attempts.
+func connectWithRetry(ctx context.Context, cfg Config, logf func(string, ...interface{}), role string, connect func() error) error {
 	var lastErr error
-	delay := p.cfg.InitialReconnectDelay
+	delay := cfg.InitialReconnectDelay
 
-	for attempt := 1; attempt <= p.cfg.MaxReconnectionAttempts; attempt++ {
-		if err := p.connectOnceLocked(); err == nil {
-			p.logf("[info] RabbitMQ producer initialized on attempt %d", attempt)
+	for attempt := 1; attempt <= cfg.MaxReconnectionAttempts; attempt++ {
+		if err := connect(); err == nil {
+			logf("[info] RabbitMQ %s initialized on attempt %d", role, attempt)
 			return nil
 		} else {
 			lastErr = err
-			if attempt == p.cfg.MaxReconnectionAttempts {
+			if attempt == cfg.MaxReconnectionAttempts {
 				break
 			}
-			p.logf("[warn] RabbitMQ init attempt %d/%d failed: %v. Retrying in %s...", attempt, p.cfg.MaxReconnectionAttempts, err, delay)
+			logf("[warn] RabbitMQ init attempt %d/%d failed: %v. Retrying in %s...", attempt, cfg.MaxReconnectionAttempts, err, delay)
 
 			timer := time.NewTimer(delay)
 			select {
@@ -160,102 +347,86 @@ func (p *RequestPublisher) connectWithRetryLocked(ctx context.Context) error {
 			case <-timer.C:
 			}
 
-			delay = minDuration(delay*2, p.cfg.MaxReconnectDelay)
+			delay = minDuration(delay*2, cfg.MaxReconnectDelay)
 		}
 	}
 
-	return fmt.Errorf("rabbitmq initialization failed after %d attempts: %w", p.cfg.MaxReconnectionAttempts, lastErr)
+	return fmt.Errorf("rabbitmq initialization failed after %d attempts: %w", cfg.MaxReconnectionAttempts, lastErr)
 }
 
 func (p *RequestPublisher) connectOnceLocked() error {
 	_ = p.closeLocked()
 
-	conn, err := amqp.DialConfig(
-		amqp.URI{
-			Scheme:   "amqp",
-			Host:     p.cfg.Host,
-			Port:     p.cfg.Port,
-			Username: p.cfg.User,
-			Password: p.cfg.Password,
-			Vhost:    p.cfg.VHost,
-		}.String(),
-		amqp.Config{Heartbeat: p.cfg.ConnectionThreshold},
-	)
+	conn, session, events, err := p.open()
 	if err != nil {
-		return fmt.Errorf("dial failed: %w", err)
+		return err
 	}
 
-	ch, err := conn.Channel()
+	p.installLocked(conn, session, events)
+	return nil
+}
+
+// open dials the next node, subscribes to the connection events and puts the channel into confirm mode.
+// It does not touch the publisher state.
+func (p *RequestPublisher) open() (publishConnection, *confirmSession, connectionEvents, error) {
+	node := p.nodes.pick()
+	nodeCfg := p.nodes.config(p.cfg, node)
+	conn, ch, err := p.dial(nodeCfg)
+	p.nodes.report(node, err)
 	if err != nil {
-		_ = conn.Close()
-		return fmt.Errorf("channel open failed: %w", err)
+		return nil, nil, connectionEvents{}, fmt.Errorf("node %s: %w", p.nodes.nodes[node], err)
 	}
+	p.logf("[info] RabbitMQ producer connected to node %s", p.nodes.nodes[node])
 
-	if err := ch.ExchangeDeclare(
-		p.cfg.ExchangeName,
-		"direct",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	); err != nil {
+	events := subscribeConnectionEvents(conn, ch)
+	session, err := newConfirmSession(ch, p.cfg.PublishMaxInFlight)
+	if err != nil {
 		_ = ch.Close()
 		_ = conn.Close()
-		return fmt.Errorf("exchange declare failed: %w", err)
+		return nil, nil, connectionEvents{}, err
 	}
+	return conn, session, events, nil
+}
 
-	q, err := ch.QueueDeclare(
-		p.cfg.QueueName,
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
+// dialAndDeclare opens a connection and a channel and declares (or checks) the exchange, queue and binding.
+func dialAndDeclare(cfg Config) (*amqp.Connection, *amqp.Channel, error) {
+	config, err := amqpConfig(cfg)
 	if err != nil {
-		_ = ch.Close()
-		_ = conn.Close()
-		return fmt.Errorf("queue declare failed: %w", err)
+		return nil, nil, err
 	}
 
-	if err := ch.QueueBind(
-		q.Name,
-		p.cfg.RoutingKey,
-		p.cfg.ExchangeName,
-		false,
-		nil,
-	); err != nil {
-		_ = ch.Close()
+	conn, err := amqp.DialConfig(brokerURI(cfg), config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("dial failed: %w", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
 		_ = conn.Close()
-		return fmt.Errorf("queue bind failed: %w", err)
+		return nil, nil, fmt.Errorf("channel open failed: %w", err)
 	}
 
-	if err := ch.Confirm(false); err != nil {
+	if err := declareTopology(ch, cfg); err != nil {
 		_ = ch.Close()
 		_ = conn.Close()
-		return fmt.Errorf("confirm mode failed: %w", err)
+		return nil, nil, err
 	}
 
-	p.conn = conn
-	p.ch = ch
-	p.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, 1))
-
-	return nil
+	return conn, ch, nil
 }
 
+// closeLocked closes the channel, failing the publishes still waiting for confirms, and the connection.
 func (p *RequestPublisher) closeLocked() error {
 	var err error
 
-	if p.ch != nil {
-		err = errors.Join(err, p.ch.Close())
-		p.ch = nil
+	if p.session != nil {
+		err = errors.Join(err, p.session.close())
+		p.session = nil
 	}
 	if p.conn != nil {
 		err = errors.Join(err, p.conn.Close())
 		p.conn = nil
 	}
-	p.confirms = nil
 
 	return err
 }
@@ -0,0 +1,650 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	c "github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/enqueuer"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/outbox"
+)
+
+// fakeChannel confirms every publish after latency, like a broker round-trip, from its own goroutine.
+type fakeChannel struct {
+	latency time.Duration
+	// confirm decides ack (true) or nack for a tag; nil acks everything.
+	confirm func(tag uint64) bool
+	// hold keeps confirms back until closed, if set.
+	hold chan struct{}
+	// routes decides whether a routing key reaches a queue; nil routes everything.
+	routes func(key string) bool
+
+	mu             sync.Mutex
+	published      uint64
+	last           amqp.Publishing
+	listener       chan amqp.Confirmation
+	closeListeners []chan *amqp.Error
+	returnListener chan amqp.Return
+	closed         bool
+	wg             sync.WaitGroup
+}
+
+var testMessage = Message{RoutingKey: "sdr_bind", Body: []byte(`{}`)}
+
+// fakeConn stands in for the connection; block simulates broker resource alarms.
+type fakeConn struct {
+	mu               sync.Mutex
+	closeListeners   []chan *amqp.Error
+	blockedListeners []chan amqp.Blocking
+	closed           bool
+}
+
+func (f *fakeConn) NotifyClose(c chan *amqp.Error) chan *amqp.Error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closeListeners = append(f.closeListeners, c)
+	return c
+}
+
+func (f *fakeConn) NotifyBlocked(c chan amqp.Blocking) chan amqp.Blocking {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.blockedListeners = append(f.blockedListeners, c)
+	return c
+}
+
+func (f *fakeConn) block(active bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.blockedListeners {
+		c <- amqp.Blocking{Active: active, Reason: "low on memory"}
+	}
+}
+
+// drop simulates the broker closing the connection.
+func (f *fakeConn) drop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.closeListeners {
+		c <- amqp.ErrClosed
+	}
+}
+
+func (f *fakeConn) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	for _, c := range f.closeListeners {
+		close(c)
+	}
+	for _, c := range f.blockedListeners {
+		close(c)
+	}
+	return nil
+}
+
+func (f *fakeChannel) Confirm(bool) error { return nil }
+
+func (f *fakeChannel) NotifyPublish(c chan amqp.Confirmation) chan amqp.Confirmation {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.listener = c
+	return c
+}
+
+func (f *fakeChannel) NotifyReturn(c chan amqp.Return) chan amqp.Return {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.returnListener = c
+	return c
+}
+
+func (f *fakeChannel) NotifyClose(c chan *amqp.Error) chan *amqp.Error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closeListeners = append(f.closeListeners, c)
+	return c
+}
+
+func (f *fakeChannel) GetNextPublishSeqNo() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.published + 1
+}
+
+func (f *fakeChannel) PublishWithContext(_ context.Context, exchange, key string, mandatory, _ bool, msg amqp.Publishing) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return amqp.ErrClosed
+	}
+	f.published++
+	f.last = msg
+	tag := f.published
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		if f.hold != nil {
+			<-f.hold
+		}
+		if f.latency > 0 {
+			time.Sleep(f.latency)
+		}
+		ack := f.confirm == nil || f.confirm(tag)
+		returned := mandatory && f.routes != nil && !f.routes(key)
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.closed {
+			return
+		}
+		// Like the broker, return an unroutable message before confirming it.
+		if returned {
+			f.returnListener <- amqp.Return{ReplyCode: amqp.NoRoute, ReplyText: "NO_ROUTE", Exchange: exchange, RoutingKey: key, MessageId: msg.MessageId}
+		}
+		f.listener <- amqp.Confirmation{DeliveryTag: tag, Ack: ack}
+	}()
+	return nil
+}
+
+func (f *fakeChannel) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	close(f.listener)
+	close(f.returnListener)
+	for _, c := range f.closeListeners {
+		close(c)
+	}
+	f.mu.Unlock()
+	return nil
+}
+
+// newFakePublisher connects to the given channels in order, one per (re)connect.
+func newFakePublisher(cfg Config, channels ...*fakeChannel) *RequestPublisher {
+	conns := make([]*fakeConn, len(channels))
+	for i := range conns {
+		conns[i] = &fakeConn{}
+	}
+	return newFakePublisherWithConns(cfg, conns, channels)
+}
+
+func newFakePublisherWithConns(cfg Config, conns []*fakeConn, channels []*fakeChannel) *RequestPublisher {
+	var mu sync.Mutex
+	next := 0
+	dial := func(Config) (publishConnection, publishChannel, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if next >= len(channels) {
+			return nil, nil, errors.New("no more fake channels")
+		}
+		conn, ch := conns[next], channels[next]
+		next++
+		return conn, ch, nil
+	}
+
+	cfg.MaxReconnectionAttempts = 1
+	p := newRequestPublisher(cfg, log.New(io.Discard, "", 0), dial)
+	if err := p.start(context.Background()); err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func TestPublish_ConcurrentPublishesShareTheRoundTrip(t *testing.T) {
+	p := newFakePublisher(Config{PublishMaxInFlight: 8}, &fakeChannel{latency: 50 * time.Millisecond})
+	defer p.Close()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- p.Publish(context.Background(), testMessage)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Fatalf("expected pipelined confirms, 8 publishes took %s", elapsed)
+	}
+}
+
+func TestPublish_LateConfirmIsNotTakenByTheNextPublish(t *testing.T) {
+	hold := make(chan struct{})
+	ch := &fakeChannel{hold: hold, confirm: func(tag uint64) bool { return tag != 1 }}
+	p := newFakePublisher(Config{PublishConfirmTimeout: 20 * time.Millisecond}, ch, &fakeChannel{})
+	defer p.Close()
+
+	// The first publish times out, the reconnect replaces the channel and the retry succeeds there.
+	if err := p.Publish(context.Background(), testMessage); err != nil {
+		t.Fatal(err)
+	}
+	// Releasing the old nack afterwards must not affect anybody.
+	close(hold)
+	ch.wg.Wait()
+
+	if err := p.Publish(context.Background(), testMessage); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfirmSession_NackFailsOnlyTheMatchingPublish(t *testing.T) {
+	ch := &fakeChannel{confirm: func(tag uint64) bool { return tag != 2 }}
+	s, err := newConfirmSession(ch, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+
+	var results []<-chan error
+	for i := 0; i < 3; i++ {
+		_, result, err := s.publish(context.Background(), "x", "k", amqp.Publishing{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, result)
+	}
+
+	for i, result := range results {
+		err := <-result
+		if (i == 1) != (err != nil) {
+			t.Fatalf("publish %d: unexpected result %v", i+1, err)
+		}
+	}
+}
+
+func TestConfirmSession_ReturnFailsOnlyTheReturnedPublish(t *testing.T) {
+	ch := &fakeChannel{routes: func(key string) bool { return key != "lost" }}
+	s, err := newConfirmSession(ch, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+
+	var results []<-chan error
+	for _, key := range []string{"k", "lost", "k"} {
+		_, result, err := s.publish(context.Background(), "x", key, amqp.Publishing{MessageId: "id-" + key})
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, result)
+	}
+
+	for i, result := range results {
+		err := <-result
+		var unroutable *UnroutableError
+		if (i == 1) != errors.As(err, &unroutable) {
+			t.Fatalf("publish %d: unexpected result %v", i+1, err)
+		}
+		if i == 1 && (unroutable.RoutingKey != "lost" || unroutable.MessageID != "id-lost" || unroutable.ReplyCode != amqp.NoRoute) {
+			t.Fatalf("unexpected unroutable error %+v", unroutable)
+		}
+	}
+}
+
+func TestPublish_UnroutableMessageFailsWithoutReconnect(t *testing.T) {
+	ch := &fakeChannel{routes: func(key string) bool { return key == "sdr_bind" }}
+	p := newFakePublisher(Config{}, ch)
+	defer p.Close()
+
+	err := p.Publish(context.Background(), Message{RoutingKey: "unbound", MessageID: "m1", Body: []byte(`{}`)})
+	var unroutable *UnroutableError
+	if !errors.As(err, &unroutable) || !unroutable.Temporary() || enqueuer.IsPermanent(err) {
+		t.Fatalf("expected a temporary *UnroutableError, got %v", err)
+	}
+	if p.Unroutable() != 1 || p.State() != StateReady {
+		t.Fatalf("expected one unroutable message on a ready connection, got %d in state %s", p.Unroutable(), p.State())
+	}
+
+	// The channel is kept: there is no second fake channel to reconnect to.
+	if err := p.Publish(context.Background(), testMessage); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOutbox_KeepsUnroutableMessagesUntilTheBindingIsRestored(t *testing.T) {
+	keys, err := NewRoutingKeys(Config{RoutingKeyTemplate: "sound.{event}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only volume changes are bound until the binding of the mute changes is restored.
+	var restored atomic.Bool
+	ch := &fakeChannel{routes: func(key string) bool { return key == "sound.volume" || restored.Load() }}
+	p := newFakePublisher(Config{}, ch)
+	defer p.Close()
+
+	discard := log.New(io.Discard, "", 0)
+	e := NewRabbitMqEnqueuerWithContext(context.Background(), p, keys, BodyFlat, discard)
+	cfg := outbox.Config{Enabled: true, Dir: t.TempDir(), InitialRetryWait: time.Millisecond, MaxRetryWait: 5 * time.Millisecond}
+	o, err := outbox.NewOutbox(context.Background(), cfg, e, discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+
+	host := c.DeviceRef{HostName: "studio-pc", PnpID: "spk"}
+	requests := []enqueuer.Request{
+		{Event: c.EventTypeRenderMuteChanged, Data: c.MuteChange{DeviceRef: host, Muted: true}},
+		{Event: c.EventTypeRenderVolumeChanged, Data: c.VolumeChange{DeviceRef: host, Volume: 100}},
+	}
+	for _, request := range requests {
+		request.Timestamp = time.Now()
+		if err := o.EnqueueRequest(request); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Unroutable() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the unroutable message to be retried, got %d attempts", p.Unroutable())
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	if o.PendingBytes() == 0 {
+		t.Fatal("the outbox dropped the unroutable message")
+	}
+
+	restored.Store(true)
+	for o.PendingBytes() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("outbox did not deliver after the binding was restored, %d bytes pending", o.PendingBytes())
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func TestOutbox_KeepsPublishesInFlight(t *testing.T) {
+	keys, err := NewRoutingKeys(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := &fakeChannel{latency: 50 * time.Millisecond}
+	p := newFakePublisher(Config{PublishMaxInFlight: 16}, ch)
+	defer p.Close()
+
+	discard := log.New(io.Discard, "", 0)
+	e := NewRabbitMqEnqueuerWithContext(context.Background(), p, keys, BodyFlat, discard)
+	cfg := outbox.Config{Enabled: true, Dir: t.TempDir(), InitialRetryWait: time.Millisecond, MaxRetryWait: 5 * time.Millisecond}
+	o, err := outbox.NewOutbox(context.Background(), cfg, e, discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+
+	start := time.Now()
+	for volume := 0; volume < 32; volume++ {
+		request := enqueuer.Request{
+			Timestamp: time.Now(),
+			Event:     c.EventTypeRenderVolumeChanged,
+			Data:      c.VolumeChange{DeviceRef: c.DeviceRef{HostName: "studio-pc", PnpID: "spk"}, Volume: volume},
+		}
+		if err := o.EnqueueRequest(request); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for o.PendingBytes() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("outbox not drained, %d bytes pending", o.PendingBytes())
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	// One publish at a time would take 32 round-trips of 50ms.
+	if elapsed := time.Since(start); elapsed > 800*time.Millisecond {
+		t.Fatalf("expected pipelined publishes, 32 took %s", elapsed)
+	}
+	ch.mu.Lock()
+	published := ch.published
+	ch.mu.Unlock()
+	if published != 32 {
+		t.Fatalf("expected 32 publishes, got %d", published)
+	}
+}
+
+func TestConfirmSession_CloseFailsInFlightPublishes(t *testing.T) {
+	hold := make(chan struct{})
+	defer close(hold)
+	s, err := newConfirmSession(&fakeChannel{hold: hold}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var results []<-chan error
+	for i := 0; i < 3; i++ {
+		_, result, err := s.publish(context.Background(), "x", "k", amqp.Publishing{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, result)
+	}
+	if s.outstanding() != 3 {
+		t.Fatalf("expected 3 outstanding publishes, got %d", s.outstanding())
+	}
+
+	_ = s.close()
+	for i, result := range results {
+		if err := <-result; !errors.Is(err, errChannelClosed) {
+			t.Fatalf("publish %d: expected errChannelClosed, got %v", i+1, err)
+		}
+	}
+}
+
+func TestPublish_SetsTheMessageProperties(t *testing.T) {
+	ch := &fakeChannel{}
+	p := newFakePublisher(Config{}, ch)
+	defer p.Close()
+
+	msg := Message{
+		RoutingKey: "sdr_bind",
+		MessageID:  "0123456789abcdef",
+		Type:       "RenderVolumeChanged",
+		Headers:    amqp.Table{HeaderSchemaVersion: int32(1)},
+		Body:       []byte(`{}`),
+	}
+	if err := p.Publish(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	ch.mu.Lock()
+	got := ch.last
+	ch.mu.Unlock()
+	if got.MessageId != msg.MessageID || got.Type != msg.Type || got.AppId != "win-sound-scanner/dev" {
+		t.Fatalf("unexpected properties: messageId=%q type=%q appId=%q", got.MessageId, got.Type, got.AppId)
+	}
+	if got.DeliveryMode != amqp.Persistent || got.Headers[HeaderSchemaVersion] != int32(1) {
+		t.Fatalf("unexpected delivery mode %d or headers %v", got.DeliveryMode, got.Headers)
+	}
+}
+
+func TestPublish_ReconnectHandlerIsCalledOnlyOnReconnect(t *testing.T) {
+	first := &fakeChannel{}
+	p := newFakePublisher(Config{}, first, &fakeChannel{})
+	defer p.Close()
+
+	reconnects := 0
+	p.SetReconnectHandler(func() { reconnects++ })
+
+	if err := p.Publish(context.Background(), testMessage); err != nil {
+		t.Fatal(err)
+	}
+	if reconnects != 0 {
+		t.Fatalf("expected no reconnect yet, got %d", reconnects)
+	}
+
+	_ = first.Close()
+	if err := p.Publish(context.Background(), testMessage); err != nil {
+		t.Fatal(err)
+	}
+	if reconnects != 1 {
+		t.Fatalf("expected one reconnect, got %d", reconnects)
+	}
+}
+
+func TestPublish_BackgroundConnectFailsFastUntilConnected(t *testing.T) {
+	var mu sync.Mutex
+	dials := 0
+	dial := func(Config) (publishConnection, publishChannel, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		dials++
+		if dials < 3 {
+			return nil, nil, errors.New("connection refused")
+		}
+		return &fakeConn{}, &fakeChannel{}, nil
+	}
+
+	cfg := Config{BackgroundConnect: true, InitialReconnectDelay: 20 * time.Millisecond, MaxReconnectDelay: 20 * time.Millisecond}
+	p := newRequestPublisher(cfg, log.New(io.Discard, "", 0), dial)
+	reconnected := make(chan struct{}, 1)
+	p.SetReconnectHandler(func() { reconnected <- struct{}{} })
+	if err := p.start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if err := p.Publish(context.Background(), testMessage); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("expected ErrNotConnected before the broker is reachable, got %v", err)
+	}
+
+	// The failed publish above may have been lost, so connecting counts as a reconnect.
+	select {
+	case <-reconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("publisher did not connect in the background")
+	}
+	if state := p.State(); state != StateReady {
+		t.Fatalf("expected the publisher to be ready, got %s", state)
+	}
+	if err := p.Publish(context.Background(), testMessage); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPublish_BackgroundConnectRetriesOnTheReconnectedChannel(t *testing.T) {
+	nacking := &fakeChannel{confirm: func(uint64) bool { return false }}
+	p := newFakePublisher(Config{BackgroundConnect: true, InitialReconnectDelay: 20 * time.Millisecond, MaxReconnectDelay: 20 * time.Millisecond},
+		nacking, &fakeChannel{})
+	defer p.Close()
+
+	// The first channel connects in the background like any later one.
+	deadline := time.Now().Add(2 * time.Second)
+	for p.State() != StateReady {
+		if time.Now().After(deadline) {
+			t.Fatal("publisher did not connect in the background")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := p.Publish(context.Background(), testMessage); err != nil {
+		t.Fatalf("expected the retry to wait for the reconnect, got %v", err)
+	}
+}
+
+func TestSupervisor_ReconnectsWhenTheBrokerClosesTheConnection(t *testing.T) {
+	first := &fakeConn{}
+	p := newFakePublisherWithConns(Config{}, []*fakeConn{first, {}}, []*fakeChannel{{}, {}})
+	defer p.Close()
+
+	states := make(chan ConnectionState, 4)
+	p.SetStateHandler(func(s ConnectionState) { states <- s })
+
+	first.drop()
+	for _, want := range []ConnectionState{StateConnecting, StateReady} {
+		select {
+		case got := <-states:
+			if got != want {
+				t.Fatalf("expected state %s, got %s", want, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for state %s", want)
+		}
+	}
+}
+
+func TestSupervisor_BlockedBrokerPausesPublishing(t *testing.T) {
+	conn := &fakeConn{}
+	p := newFakePublisherWithConns(Config{}, []*fakeConn{conn}, []*fakeChannel{{}})
+	defer p.Close()
+
+	states := make(chan ConnectionState, 4)
+	p.SetStateHandler(func(s ConnectionState) { states <- s })
+	conn.block(true)
+	if got := <-states; got != StateBlocked {
+		t.Fatalf("expected blocked, got %s", got)
+	}
+
+	published := make(chan error, 1)
+	go func() { published <- p.Publish(context.Background(), testMessage) }()
+	select {
+	case err := <-published:
+		t.Fatalf("expected the publish to wait while blocked, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	conn.block(false)
+	if err := <-published; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// benchmarkPublish publishes b.N messages from the given number of concurrent callers
+// against a fake broker with a fixed confirm latency.
+func benchmarkPublish(b *testing.B, callers int) {
+	p := newFakePublisher(Config{PublishMaxInFlight: callers}, &fakeChannel{latency: 200 * time.Microsecond})
+	defer p.Close()
+	body := []byte(`{"deviceMessageType":3}`)
+
+	b.ResetTimer()
+	var wg sync.WaitGroup
+	work := make(chan struct{})
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range work {
+				if err := p.Publish(context.Background(), Message{RoutingKey: "sdr_bind", Body: body}); err != nil {
+					b.Error(err)
+				}
+			}
+		}()
+	}
+	for i := 0; i < b.N; i++ {
+		work <- struct{}{}
+	}
+	close(work)
+	wg.Wait()
+}
+
+// BenchmarkPublish_OneInFlight matches the old one-confirm-per-round-trip behaviour.
+func BenchmarkPublish_OneInFlight(b *testing.B) { benchmarkPublish(b, 1) }
+
+func BenchmarkPublish_SixteenInFlight(b *testing.B) { benchmarkPublish(b, 16) }
+
+func BenchmarkPublish_SixtyFourInFlight(b *testing.B) { benchmarkPublish(b, 64) }
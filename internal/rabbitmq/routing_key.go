@@ -0,0 +1,219 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/enqueuer"
+)
+
+// maxRoutingKeyLength is the AMQP limit for a short string.
+const maxRoutingKeyLength = 255
+
+// routingKeyFields are the placeholders a routing key template may use.
+var routingKeyFields = map[string]func(request enqueuer.Request, rest enqueuer.RestRequest) string{
+	"host": func(request enqueuer.Request, _ enqueuer.RestRequest) string {
+		return request.Data.Ref().HostName
+	},
+	"pnpId": func(request enqueuer.Request, _ enqueuer.RestRequest) string {
+		return request.Data.Ref().PnpID
+	},
+	"flow": func(_ enqueuer.Request, rest enqueuer.RestRequest) string {
+		switch rest.FlowType {
+		case contract.FlowTypeRender:
+			return "render"
+		case contract.FlowTypeCapture:
+			return "capture"
+		default:
+			return "none"
+		}
+	},
+	"event": func(_ enqueuer.Request, rest enqueuer.RestRequest) string {
+		return messageTypeName(rest.MessageType)
+	},
+	"type": func(_ enqueuer.Request, rest enqueuer.RestRequest) string {
+		return fmt.Sprint(rest.MessageType)
+	},
+}
+
+// RoutingKeys computes the routing key of each request: Config.RoutingKeyTemplate rendered with
+// the request fields, or the fixed Config.RoutingKey when no template is set.
+type RoutingKeys struct {
+	fixed string
+	parts []routingKeyPart
+}
+
+// routingKeyPart is literal text, or the placeholder named by field.
+type routingKeyPart struct {
+	literal string
+	field   string
+}
+
+func NewRoutingKeys(cfg Config) (RoutingKeys, error) {
+	if cfg.RoutingKeyTemplate == "" {
+		return RoutingKeys{fixed: cfg.RoutingKey}, nil
+	}
+
+	parts, err := parseRoutingKeyTemplate(cfg.RoutingKeyTemplate)
+	if err != nil {
+		return RoutingKeys{}, fmt.Errorf("invalid WIN_SOUND_RABBITMQ_ROUTING_KEY_TEMPLATE %q: %w", cfg.RoutingKeyTemplate, err)
+	}
+	return RoutingKeys{parts: parts}, nil
+}
+
+// Key returns the routing key for request. Placeholder values are reduced to letters, digits, '-' and '_',
+// so a host name or PnP ID never adds topic words or wildcards; the key is cut at 255 bytes.
+func (k RoutingKeys) Key(request enqueuer.Request, rest enqueuer.RestRequest) string {
+	if k.parts == nil {
+		return k.fixed
+	}
+
+	var b strings.Builder
+	for _, part := range k.parts {
+		if part.field == "" {
+			b.WriteString(part.literal)
+			continue
+		}
+		b.WriteString(routingKeyWord(routingKeyFields[part.field](request, rest)))
+	}
+
+	key := b.String()
+	if len(key) > maxRoutingKeyLength {
+		key = key[:maxRoutingKeyLength]
+	}
+	return key
+}
+
+func parseRoutingKeyTemplate(template string) ([]routingKeyPart, error) {
+	var parts []routingKeyPart
+	rest := template
+
+	for rest != "" {
+		open := strings.IndexAny(rest, "{}")
+		if open < 0 {
+			parts = append(parts, routingKeyPart{literal: rest})
+			break
+		}
+		if rest[open] == '}' {
+			return nil, errors.New("unmatched '}'")
+		}
+		if open > 0 {
+			parts = append(parts, routingKeyPart{literal: rest[:open]})
+		}
+
+		length := strings.IndexByte(rest[open:], '}')
+		if length < 0 {
+			return nil, errors.New("unmatched '{'")
+		}
+		field := rest[open+1 : open+length]
+		if _, ok := routingKeyFields[field]; !ok {
+			return nil, fmt.Errorf("unknown placeholder {%s} (supported: {host}, {flow}, {event}, {type}, {pnpId})", field)
+		}
+		parts = append(parts, routingKeyPart{field: field})
+		rest = rest[open+length+1:]
+	}
+
+	for _, part := range parts {
+		if strings.ContainsAny(part.literal, "*#") {
+			return nil, errors.New("wildcards '*' and '#' are only valid in binding keys")
+		}
+	}
+	return parts, nil
+}
+
+// validateRoutingKeyTemplate checks that the declared queue receives every message the template produces:
+// direct and fanout exchanges do not route by a templated key, and on a topic exchange the binding key
+// must match every key. In passive mode the binding is the administrator's and is not checked.
+func (c Config) validateRoutingKeyTemplate() error {
+	if c.RoutingKeyTemplate == "" {
+		return nil
+	}
+
+	switch c.ExchangeType {
+	case amqp.ExchangeDirect, amqp.ExchangeFanout:
+		return fmt.Errorf("WIN_SOUND_RABBITMQ_ROUTING_KEY_TEMPLATE requires WIN_SOUND_RABBITMQ_EXCHANGE_TYPE %s or %s, not %s",
+			amqp.ExchangeTopic, amqp.ExchangeHeaders, c.ExchangeType)
+	case amqp.ExchangeTopic:
+		if c.Topology == TopologyDeclare && !topicMatches(topicWords(c.RoutingKey), topicWords(c.RoutingKeyTemplate)) {
+			return fmt.Errorf("WIN_SOUND_RABBITMQ_ROUTING_KEY %q does not match every key of WIN_SOUND_RABBITMQ_ROUTING_KEY_TEMPLATE %q, "+
+				"so the queue would miss messages; bind it with e.g. %q", c.RoutingKey, c.RoutingKeyTemplate, bindingKeyFor(c.RoutingKeyTemplate))
+		}
+	}
+	// The queue is bound to a headers exchange without arguments, which routes every message to it.
+	return nil
+}
+
+// bindingKeyFor returns a topic binding key that matches every key of template:
+// its leading fixed words followed by '#', e.g. "sound.#" for "sound.{host}.{flow}.{event}".
+func bindingKeyFor(template string) string {
+	words := topicWords(template)
+	for i, word := range words {
+		if strings.ContainsAny(word, "{}") {
+			return strings.Join(append(words[:i:i], "#"), ".")
+		}
+	}
+	return template
+}
+
+func topicWords(key string) []string {
+	return strings.Split(key, ".")
+}
+
+// topicMatches reports whether the binding words match the key words the way a topic exchange does:
+// '*' matches one word and '#' zero or more. A key word with a placeholder stands for any single word,
+// so it is only matched by '*' and '#'.
+func topicMatches(binding, key []string) bool {
+	if len(binding) == 0 {
+		return len(key) == 0
+	}
+	switch binding[0] {
+	case "#":
+		for i := 0; i <= len(key); i++ {
+			if topicMatches(binding[1:], key[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(key) > 0 && topicMatches(binding[1:], key[1:])
+	default:
+		return len(key) > 0 && binding[0] == key[0] && !strings.ContainsAny(key[0], "{}") && topicMatches(binding[1:], key[1:])
+	}
+}
+
+func routingKeyWord(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, value)
+}
+
+func messageTypeName(messageType contract.MessageType) string {
+	switch messageType {
+	case contract.MessageTypeConfirmed:
+		return "confirmed"
+	case contract.MessageTypeDiscovered:
+		return "discovered"
+	case contract.MessageTypeDetached:
+		return "detached"
+	case contract.MessageTypeVolumeRenderChanged, contract.MessageTypeVolumeCaptureChanged:
+		return "volume"
+	case contract.MessageTypeDefaultRenderChanged, contract.MessageTypeDefaultCaptureChanged:
+		return "default"
+	case contract.MessageTypeMuteRenderChanged, contract.MessageTypeMuteCaptureChanged:
+		return "mute"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,151 @@
+package rabbitmq
+
+import (
+	"context"
+	"io"
+	"log"
+	"strings"
+	"testing"
+
+	c "github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/enqueuer"
+)
+
+// recordingPublisher remembers the messages it was asked to publish.
+type recordingPublisher struct {
+	messages []Message
+}
+
+func (r *recordingPublisher) Publish(_ context.Context, msg Message) error {
+	r.messages = append(r.messages, msg)
+	return nil
+}
+
+func (r *recordingPublisher) keys() []string {
+	keys := make([]string, len(r.messages))
+	for i, msg := range r.messages {
+		keys[i] = msg.RoutingKey
+	}
+	return keys
+}
+
+func (r *recordingPublisher) Close() error { return nil }
+
+func TestRoutingKeys_RendersTheTemplatePerRequest(t *testing.T) {
+	keys, err := NewRoutingKeys(Config{RoutingKeyTemplate: "sound.{host}.{flow}.{event}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publisher := &recordingPublisher{}
+	e := NewRabbitMqEnqueuerWithContext(context.Background(), publisher, keys, BodyFlat, log.New(io.Discard, "", 0))
+
+	requests := []enqueuer.Request{
+		{Event: c.EventTypeRenderVolumeChanged, Data: c.VolumeChange{DeviceRef: c.DeviceRef{HostName: "studio-pc", PnpID: "spk"}, Volume: 40}},
+		{Event: c.EventTypeCaptureDeviceConfirmed, Data: c.DeviceSnapshot{DeviceRef: c.DeviceRef{HostName: "studio-pc", PnpID: "mic"}}},
+		{Event: c.EventTypeDefaultRenderChanged, Data: c.DefaultChange{DeviceRef: c.DeviceRef{HostName: "site1.corp.example", PnpID: "spk"}, PreviousPnpID: "mic"}},
+	}
+	for _, request := range requests {
+		if err := e.EnqueueRequest(request); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"sound.studio-pc.render.volume", "sound.studio-pc.capture.confirmed", "sound.site1_corp_example.render.default"}
+	if strings.Join(publisher.keys(), " ") != strings.Join(want, " ") {
+		t.Fatalf("expected %v, got %v", want, publisher.keys())
+	}
+}
+
+func TestRoutingKeys_WithoutTemplateUsesTheFixedKey(t *testing.T) {
+	keys, err := NewRoutingKeys(Config{}.withDefaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := enqueuer.Request{Event: c.EventTypeRenderDeviceDetached, Data: c.DeviceDetached{DeviceRef: c.DeviceRef{HostName: "studio-pc", PnpID: "spk"}}}
+	if got := keys.Key(request, enqueuer.NewRestRequest(request)); got != "sdr_bind" {
+		t.Fatalf("expected sdr_bind, got %q", got)
+	}
+}
+
+func TestRoutingKeys_SanitizesAndBoundsValues(t *testing.T) {
+	keys, err := NewRoutingKeys(Config{RoutingKeyTemplate: "dev.{pnpId}.{type}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := enqueuer.Request{Event: c.EventTypeRenderMuteChanged, Data: c.MuteChange{DeviceRef: c.DeviceRef{HostName: "studio-pc", PnpID: `SWD\MMDEVAPI\{0.0.0.00000000}.#*`}}}
+	if got := keys.Key(request, enqueuer.NewRestRequest(request)); got != "dev.SWD_MMDEVAPI__0_0_0_00000000____.7" {
+		t.Fatalf("unexpected key %q", got)
+	}
+
+	request.Data = c.MuteChange{DeviceRef: c.DeviceRef{HostName: "studio-pc", PnpID: strings.Repeat("x", 300)}}
+	if got := keys.Key(request, enqueuer.NewRestRequest(request)); len(got) != maxRoutingKeyLength {
+		t.Fatalf("expected the key to be cut at %d bytes, got %d", maxRoutingKeyLength, len(got))
+	}
+}
+
+func TestRoutingKeys_RejectsInvalidTemplates(t *testing.T) {
+	for template, want := range map[string]string{
+		"sound.{hostname}": "unknown placeholder {hostname}",
+		"sound.{host":      "unmatched '{'",
+		"sound.host}":      "unmatched '}'",
+		"sound.#":          "wildcards",
+	} {
+		t.Setenv("WIN_SOUND_RABBITMQ_ROUTING_KEY_TEMPLATE", template)
+		_, err := LoadConfigFromEnv()
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("template %q: expected an error mentioning %q, got %v", template, want, err)
+		}
+	}
+}
+
+func TestValidate_RoutingKeyTemplateNeedsAMatchingBinding(t *testing.T) {
+	template := "sound.{host}.{flow}.{event}"
+	cases := []struct {
+		exchangeType, topology, bindingKey string
+		valid                              bool
+	}{
+		{exchangeType: "direct", bindingKey: "sound.#"},
+		{exchangeType: "fanout", bindingKey: "sound.#"},
+		{exchangeType: "topic", bindingKey: "sdr_bind"},
+		{exchangeType: "topic", bindingKey: "sound.*"},
+		{exchangeType: "topic", bindingKey: "sound.*.render.*"},
+		{exchangeType: "topic", bindingKey: "sound.#", valid: true},
+		{exchangeType: "topic", bindingKey: "#", valid: true},
+		{exchangeType: "topic", bindingKey: "sound.*.*.*", valid: true},
+		{exchangeType: "topic", topology: TopologyPassive, bindingKey: "sdr_bind", valid: true},
+		{exchangeType: "headers", bindingKey: "sdr_bind", valid: true},
+	}
+	for _, tc := range cases {
+		cfg := Config{RoutingKeyTemplate: template, ExchangeType: tc.exchangeType, Topology: tc.topology, RoutingKey: tc.bindingKey}.withDefaults()
+		if err := cfg.validate(); (err == nil) != tc.valid {
+			t.Fatalf("%s exchange bound with %q (%s): valid=%t, got %v", tc.exchangeType, tc.bindingKey, cfg.Topology, tc.valid, err)
+		}
+	}
+}
+
+func TestLoadConfigFromEnv_TemplatedKeysReachTheDeclaredQueue(t *testing.T) {
+	t.Setenv("WIN_SOUND_RABBITMQ_EXCHANGE_TYPE", "topic")
+	t.Setenv("WIN_SOUND_RABBITMQ_ROUTING_KEY_TEMPLATE", "sound.{host}.{flow}.{event}")
+	cfg, err := LoadConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RoutingKey != "sound.#" {
+		t.Fatalf("expected the binding key to be derived from the template, got %q", cfg.RoutingKey)
+	}
+
+	ch := &fakeTopologyChannel{}
+	if err := declareTopology(ch, cfg); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := NewRoutingKeys(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := enqueuer.Request{Event: c.EventTypeCaptureMuteChanged, Data: c.MuteChange{DeviceRef: c.DeviceRef{HostName: "site1.corp.example", PnpID: "mic"}}}
+	key := keys.Key(request, enqueuer.NewRestRequest(request))
+	if !topicMatches(topicWords(ch.bindingKey), topicWords(key)) {
+		t.Fatalf("key %q does not reach the queue bound with %q", key, ch.bindingKey)
+	}
+}
@@ -0,0 +1,132 @@
+package rabbitmq
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	defaultTLSPort = 5671
+
+	AuthPlain    = "plain"
+	AuthExternal = "external"
+)
+
+// brokerURI returns the URI to dial: amqps when TLS is enabled, otherwise plain amqp.
+func brokerURI(cfg Config) string {
+	scheme := "amqp"
+	if cfg.TLSEnabled {
+		scheme = "amqps"
+	}
+	return amqp.URI{
+		Scheme:   scheme,
+		Host:     cfg.Host,
+		Port:     cfg.Port,
+		Username: cfg.User,
+		Password: cfg.Password,
+		Vhost:    cfg.VHost,
+	}.String()
+}
+
+// amqpConfig returns the connection settings for cfg, including TLS and the SASL mechanism.
+func amqpConfig(cfg Config) (amqp.Config, error) {
+	config := amqp.Config{Heartbeat: cfg.ConnectionThreshold, ChannelMax: cfg.ChannelMax}
+	if cfg.ConnectionTimeout > 0 {
+		config.Dial = amqp.DefaultDial(cfg.ConnectionTimeout)
+	}
+
+	if cfg.TLSEnabled {
+		tlsConfig, err := buildTLSConfig(cfg)
+		if err != nil {
+			return amqp.Config{}, err
+		}
+		config.TLSClientConfig = tlsConfig
+	}
+	if cfg.AuthMechanism == AuthExternal {
+		// The broker takes the user name from the client certificate.
+		config.SASL = []amqp.Authentication{&amqp.ExternalAuth{}}
+	}
+
+	return config, nil
+}
+
+// buildTLSConfig loads the CA bundle and the client certificate named in cfg.
+func buildTLSConfig(cfg Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.Host,
+		InsecureSkipVerify: cfg.TLSInsecureSkipVerify, // lab brokers only
+	}
+	if cfg.TLSServerName != "" {
+		tlsConfig.ServerName = cfg.TLSServerName
+	}
+
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read WIN_SOUND_RABBITMQ_TLS_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("WIN_SOUND_RABBITMQ_TLS_CA_FILE %q contains no PEM certificates", cfg.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load WIN_SOUND_RABBITMQ_TLS_CERT_FILE/WIN_SOUND_RABBITMQ_TLS_KEY_FILE: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// validateTLS checks the TLS and authentication settings and loads the TLS files once.
+func (c Config) validateTLS() error {
+	switch c.AuthMechanism {
+	case AuthPlain, AuthExternal:
+	default:
+		return fmt.Errorf("invalid WIN_SOUND_RABBITMQ_AUTH %q (supported: %s, %s)", c.AuthMechanism, AuthPlain, AuthExternal)
+	}
+
+	if !c.TLSEnabled {
+		if c.TLSCAFile != "" || c.TLSCertFile != "" || c.TLSKeyFile != "" || c.TLSServerName != "" || c.TLSInsecureSkipVerify {
+			return errors.New("WIN_SOUND_RABBITMQ_TLS_* settings require WIN_SOUND_RABBITMQ_TLS=on")
+		}
+		if c.AuthMechanism == AuthExternal {
+			return errors.New("WIN_SOUND_RABBITMQ_AUTH=external requires WIN_SOUND_RABBITMQ_TLS=on and a client certificate")
+		}
+		return nil
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return errors.New("WIN_SOUND_RABBITMQ_TLS_CERT_FILE and WIN_SOUND_RABBITMQ_TLS_KEY_FILE must be set together")
+	}
+	if c.AuthMechanism == AuthExternal && c.TLSCertFile == "" {
+		return errors.New("WIN_SOUND_RABBITMQ_AUTH=external requires WIN_SOUND_RABBITMQ_TLS_CERT_FILE and WIN_SOUND_RABBITMQ_TLS_KEY_FILE")
+	}
+
+	// Fail at startup rather than on every connect attempt.
+	_, err := buildTLSConfig(c)
+	return err
+}
+
+func parseOnOff(name, value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "on", "true", "1":
+		return true, nil
+	case "off", "false", "0":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid %s %q (supported: on, off)", name, value)
+	}
+}
@@ -0,0 +1,203 @@
+package rabbitmq
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPKI is a throwaway CA with a server and a client certificate, written as PEM files.
+type testPKI struct {
+	caFile, serverCertFile, serverKeyFile, clientCertFile, clientKeyFile string
+	pool                                                                 *x509.CertPool
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	t.Helper()
+	dir := t.TempDir()
+
+	caKey := newTestKey(t)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issue := func(serial int64, cn string, usage x509.ExtKeyUsage) (string, string) {
+		key := newTestKey(t)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: cn},
+			DNSNames:     []string{cn},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certFile := writePEM(t, dir, cn+".crt", "CERTIFICATE", der)
+		keyFile := writePEM(t, dir, cn+".key", "EC PRIVATE KEY", keyDER)
+		return certFile, keyFile
+	}
+
+	pki := testPKI{caFile: writePEM(t, dir, "ca.crt", "CERTIFICATE", caDER), pool: x509.NewCertPool()}
+	pki.pool.AddCert(ca)
+	pki.serverCertFile, pki.serverKeyFile = issue(2, "broker.test", x509.ExtKeyUsageServerAuth)
+	pki.clientCertFile, pki.clientKeyFile = issue(3, "scanner-01", x509.ExtKeyUsageClientAuth)
+	return pki
+}
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigFromEnv_TLS(t *testing.T) {
+	pki := newTestPKI(t)
+	t.Setenv("WIN_SOUND_RABBITMQ_TLS", "on")
+	t.Setenv("WIN_SOUND_RABBITMQ_TLS_CA_FILE", pki.caFile)
+	t.Setenv("WIN_SOUND_RABBITMQ_TLS_CERT_FILE", pki.clientCertFile)
+	t.Setenv("WIN_SOUND_RABBITMQ_TLS_KEY_FILE", pki.clientKeyFile)
+	t.Setenv("WIN_SOUND_RABBITMQ_AUTH", "EXTERNAL")
+
+	cfg, err := LoadConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != defaultTLSPort || cfg.AuthMechanism != AuthExternal {
+		t.Fatalf("unexpected config port=%d auth=%q", cfg.Port, cfg.AuthMechanism)
+	}
+	if uri := brokerURI(cfg); !strings.HasPrefix(uri, "amqps://") {
+		t.Fatalf("expected an amqps URI, got %q", uri)
+	}
+}
+
+func TestLoadConfigFromEnv_TLSErrors(t *testing.T) {
+	pki := newTestPKI(t)
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"missing CA file", map[string]string{"WIN_SOUND_RABBITMQ_TLS": "on", "WIN_SOUND_RABBITMQ_TLS_CA_FILE": filepath.Join(t.TempDir(), "none.crt")}, "WIN_SOUND_RABBITMQ_TLS_CA_FILE"},
+		{"CA file without certificates", map[string]string{"WIN_SOUND_RABBITMQ_TLS": "on", "WIN_SOUND_RABBITMQ_TLS_CA_FILE": pki.clientKeyFile}, "no PEM certificates"},
+		{"cert without key", map[string]string{"WIN_SOUND_RABBITMQ_TLS": "on", "WIN_SOUND_RABBITMQ_TLS_CERT_FILE": pki.clientCertFile}, "must be set together"},
+		{"mismatched key", map[string]string{"WIN_SOUND_RABBITMQ_TLS": "on", "WIN_SOUND_RABBITMQ_TLS_CERT_FILE": pki.clientCertFile, "WIN_SOUND_RABBITMQ_TLS_KEY_FILE": pki.serverKeyFile}, "WIN_SOUND_RABBITMQ_TLS_KEY_FILE"},
+		{"external without certificate", map[string]string{"WIN_SOUND_RABBITMQ_TLS": "on", "WIN_SOUND_RABBITMQ_AUTH": "external"}, "requires WIN_SOUND_RABBITMQ_TLS_CERT_FILE"},
+		{"TLS settings with TLS off", map[string]string{"WIN_SOUND_RABBITMQ_TLS_CA_FILE": pki.caFile}, "require WIN_SOUND_RABBITMQ_TLS=on"},
+		{"unknown auth", map[string]string{"WIN_SOUND_RABBITMQ_AUTH": "kerberos"}, "invalid WIN_SOUND_RABBITMQ_AUTH"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			_, err := LoadConfigFromEnv()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected an error mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+// TestDial_PresentsClientCertificateOverTLS dials a local TLS listener that requires a client certificate.
+// There is no broker behind it, so only the TLS handshake is checked.
+func TestDial_PresentsClientCertificateOverTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	serverCert, err := tls.LoadX509KeyPair(pki.serverCertFile, pki.serverKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pki.pool,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	peer := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			peer <- ""
+			return
+		}
+		defer conn.Close()
+		tlsConn := conn.(*tls.Conn)
+		if err := tlsConn.Handshake(); err != nil {
+			peer <- "handshake failed: " + err.Error()
+			return
+		}
+		peer <- tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	cfg := Config{
+		Host:          "127.0.0.1",
+		Port:          port,
+		TLSEnabled:    true,
+		TLSCAFile:     pki.caFile,
+		TLSCertFile:   pki.clientCertFile,
+		TLSKeyFile:    pki.clientKeyFile,
+		TLSServerName: "broker.test",
+		AuthMechanism: AuthExternal,
+	}.withDefaults()
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := dialAndDeclare(cfg); err == nil {
+		t.Fatal("expected the dial to fail without a broker behind the listener")
+	}
+	if got := <-peer; got != "scanner-01" {
+		t.Fatalf("expected the client certificate scanner-01, got %q", got)
+	}
+}
@@ -0,0 +1,158 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	TopologyDeclare = "declare"
+	TopologyPassive = "passive"
+
+	QueueClassic = "classic"
+	QueueQuorum  = "quorum"
+	QueueStream  = "stream"
+)
+
+var (
+	exchangeTypes = []string{amqp.ExchangeDirect, amqp.ExchangeTopic, amqp.ExchangeFanout, amqp.ExchangeHeaders}
+	queueTypes    = []string{QueueClassic, QueueQuorum, QueueStream}
+	overflowModes = []string{"drop-head", "reject-publish", "reject-publish-dlx"}
+	topologyModes = []string{TopologyDeclare, TopologyPassive}
+)
+
+// topologyChannel is the part of *amqp.Channel needed to declare or check the topology.
+type topologyChannel interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	ExchangeDeclarePassive(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+}
+
+// declareTopology declares the exchange, queue and binding, or in passive mode only checks
+// that the exchange and queue exist; the binding is then left to the broker administrator.
+func declareTopology(ch topologyChannel, cfg Config) error {
+	args := queueArgs(cfg)
+
+	if cfg.Topology == TopologyPassive {
+		if err := ch.ExchangeDeclarePassive(cfg.ExchangeName, cfg.ExchangeType, true, false, false, false, nil); err != nil {
+			return explainTopologyError("exchange", cfg.ExchangeName, err)
+		}
+		if _, err := ch.QueueDeclarePassive(cfg.QueueName, true, false, false, false, nil); err != nil {
+			return explainTopologyError("queue", cfg.QueueName, err)
+		}
+		return nil
+	}
+
+	if err := ch.ExchangeDeclare(cfg.ExchangeName, cfg.ExchangeType, true, false, false, false, exchangeArgs(cfg)); err != nil {
+		return explainTopologyError("exchange", cfg.ExchangeName, err)
+	}
+	q, err := ch.QueueDeclare(cfg.QueueName, true, false, false, false, args)
+	if err != nil {
+		return explainTopologyError("queue", cfg.QueueName, err)
+	}
+	if err := ch.QueueBind(q.Name, cfg.RoutingKey, cfg.ExchangeName, false, nil); err != nil {
+		return fmt.Errorf("queue bind failed: %w", err)
+	}
+	return nil
+}
+
+// exchangeArgs returns the arguments of the exchange; nil without an alternate exchange,
+// so that exchanges declared by earlier versions still match.
+func exchangeArgs(cfg Config) amqp.Table {
+	if cfg.AlternateExchange == "" {
+		return nil
+	}
+	return amqp.Table{"alternate-exchange": cfg.AlternateExchange}
+}
+
+// queueArgs returns the x-arguments of the queue; a classic queue without limits has none,
+// so that queues declared by earlier versions still match.
+func queueArgs(cfg Config) amqp.Table {
+	args := amqp.Table{}
+	if cfg.QueueType != QueueClassic {
+		args[amqp.QueueTypeArg] = cfg.QueueType
+	}
+	if cfg.MessageTTL > 0 {
+		args[amqp.QueueMessageTTLArg] = cfg.MessageTTL.Milliseconds()
+	}
+	if cfg.MaxLength > 0 {
+		args[amqp.QueueMaxLenArg] = int64(cfg.MaxLength)
+	}
+	if cfg.QueueOverflow != "" {
+		args[amqp.QueueOverflowArg] = cfg.QueueOverflow
+	}
+	if cfg.DeadLetterExchange != "" {
+		args["x-dead-letter-exchange"] = cfg.DeadLetterExchange
+	}
+	if cfg.DeadLetterRoutingKey != "" {
+		args["x-dead-letter-routing-key"] = cfg.DeadLetterRoutingKey
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return args
+}
+
+// explainTopologyError turns the broker's channel errors into advice on what to change.
+func explainTopologyError(kind, name string, err error) error {
+	var amqpErr *amqp.Error
+	if !errors.As(err, &amqpErr) {
+		return fmt.Errorf("%s %q declare failed: %w", kind, name, err)
+	}
+
+	switch amqpErr.Code {
+	case amqp.PreconditionFailed:
+		return fmt.Errorf("%s %q already exists with different settings (%s); align the WIN_SOUND_RABBITMQ_* topology settings with it, "+
+			"delete it, or set WIN_SOUND_RABBITMQ_TOPOLOGY=passive: %w", kind, name, amqpErr.Reason, err)
+	case amqp.NotFound:
+		return fmt.Errorf("%s %q does not exist; it must be created by the broker administrator when WIN_SOUND_RABBITMQ_TOPOLOGY=passive: %w", kind, name, err)
+	case amqp.AccessRefused:
+		return fmt.Errorf("not allowed to declare %s %q; let the broker administrator create the topology and set WIN_SOUND_RABBITMQ_TOPOLOGY=passive: %w", kind, name, err)
+	default:
+		return fmt.Errorf("%s %q declare failed: %w", kind, name, err)
+	}
+}
+
+func (c Config) validateTopology() error {
+	if !slices.Contains(topologyModes, c.Topology) {
+		return fmt.Errorf("invalid WIN_SOUND_RABBITMQ_TOPOLOGY %q (supported: %s)", c.Topology, strings.Join(topologyModes, ", "))
+	}
+	if !slices.Contains(exchangeTypes, c.ExchangeType) {
+		return fmt.Errorf("invalid WIN_SOUND_RABBITMQ_EXCHANGE_TYPE %q (supported: %s)", c.ExchangeType, strings.Join(exchangeTypes, ", "))
+	}
+	if !slices.Contains(queueTypes, c.QueueType) {
+		return fmt.Errorf("invalid WIN_SOUND_RABBITMQ_QUEUE_TYPE %q (supported: %s)", c.QueueType, strings.Join(queueTypes, ", "))
+	}
+	if c.QueueOverflow != "" {
+		if !slices.Contains(overflowModes, c.QueueOverflow) {
+			return fmt.Errorf("invalid WIN_SOUND_RABBITMQ_QUEUE_OVERFLOW %q (supported: %s)", c.QueueOverflow, strings.Join(overflowModes, ", "))
+		}
+		if c.MaxLength <= 0 {
+			return errors.New("WIN_SOUND_RABBITMQ_QUEUE_OVERFLOW requires WIN_SOUND_RABBITMQ_QUEUE_MAX_LENGTH")
+		}
+	}
+	if c.AlternateExchange != "" && c.AlternateExchange == c.ExchangeName {
+		return errors.New("WIN_SOUND_RABBITMQ_ALTERNATE_EXCHANGE must differ from WIN_SOUND_RABBITMQ_EXCHANGE")
+	}
+	if c.DeadLetterRoutingKey != "" && c.DeadLetterExchange == "" {
+		return errors.New("WIN_SOUND_RABBITMQ_DLX_ROUTING_KEY requires WIN_SOUND_RABBITMQ_DLX")
+	}
+
+	switch c.QueueType {
+	case QueueQuorum:
+		if c.QueueOverflow == "reject-publish-dlx" {
+			return errors.New("WIN_SOUND_RABBITMQ_QUEUE_OVERFLOW=reject-publish-dlx is not supported for quorum queues")
+		}
+	case QueueStream:
+		if c.MessageTTL > 0 || c.QueueOverflow != "" || c.DeadLetterExchange != "" {
+			return errors.New("message TTL, overflow and dead-lettering are not supported for stream queues")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package rabbitmq
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// fakeTopologyChannel records the declarations and fails the queue declaration with queueErr.
+type fakeTopologyChannel struct {
+	calls        []string
+	exchangeArgs amqp.Table
+	queueArgs    amqp.Table
+	queueErr     error
+	bindingKey   string
+}
+
+func (f *fakeTopologyChannel) ExchangeDeclare(name, kind string, _, _, _, _ bool, args amqp.Table) error {
+	f.calls = append(f.calls, "exchange "+name+" "+kind)
+	f.exchangeArgs = args
+	return nil
+}
+
+func (f *fakeTopologyChannel) ExchangeDeclarePassive(name, kind string, _, _, _, _ bool, _ amqp.Table) error {
+	f.calls = append(f.calls, "exchange? "+name+" "+kind)
+	return nil
+}
+
+func (f *fakeTopologyChannel) QueueDeclare(name string, _, _, _, _ bool, args amqp.Table) (amqp.Queue, error) {
+	f.calls = append(f.calls, "queue "+name)
+	f.queueArgs = args
+	return amqp.Queue{Name: name}, f.queueErr
+}
+
+func (f *fakeTopologyChannel) QueueDeclarePassive(name string, _, _, _, _ bool, _ amqp.Table) (amqp.Queue, error) {
+	f.calls = append(f.calls, "queue? "+name)
+	return amqp.Queue{Name: name}, f.queueErr
+}
+
+func (f *fakeTopologyChannel) QueueBind(name, key, exchange string, _ bool, _ amqp.Table) error {
+	f.calls = append(f.calls, "bind "+name+" "+key+" "+exchange)
+	f.bindingKey = key
+	return nil
+}
+
+func TestDeclareTopology_QueueArguments(t *testing.T) {
+	cfg := Config{
+		ExchangeType:         "topic",
+		QueueType:            QueueQuorum,
+		MessageTTL:           time.Hour,
+		MaxLength:            10000,
+		QueueOverflow:        "reject-publish",
+		DeadLetterExchange:   "sdr_dlx",
+		DeadLetterRoutingKey: "dead",
+	}.withDefaults()
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := &fakeTopologyChannel{}
+	if err := declareTopology(ch, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	wantCalls := []string{"exchange sdr_exchange topic", "queue sdr_queue", "bind sdr_queue sdr_bind sdr_exchange"}
+	if !reflect.DeepEqual(ch.calls, wantCalls) {
+		t.Fatalf("expected %v, got %v", wantCalls, ch.calls)
+	}
+	wantArgs := amqp.Table{
+		"x-queue-type":              "quorum",
+		"x-message-ttl":             int64(3600000),
+		"x-max-length":              int64(10000),
+		"x-overflow":                "reject-publish",
+		"x-dead-letter-exchange":    "sdr_dlx",
+		"x-dead-letter-routing-key": "dead",
+	}
+	if !reflect.DeepEqual(ch.queueArgs, wantArgs) {
+		t.Fatalf("expected %v, got %v", wantArgs, ch.queueArgs)
+	}
+}
+
+func TestDeclareTopology_DefaultClassicQueueHasNoArguments(t *testing.T) {
+	ch := &fakeTopologyChannel{}
+	if err := declareTopology(ch, Config{}.withDefaults()); err != nil {
+		t.Fatal(err)
+	}
+	if ch.queueArgs != nil || ch.exchangeArgs != nil {
+		t.Fatalf("expected no arguments, got %v and %v", ch.exchangeArgs, ch.queueArgs)
+	}
+}
+
+func TestDeclareTopology_AlternateExchange(t *testing.T) {
+	ch := &fakeTopologyChannel{}
+	if err := declareTopology(ch, Config{AlternateExchange: "sdr_unrouted"}.withDefaults()); err != nil {
+		t.Fatal(err)
+	}
+	if want := (amqp.Table{"alternate-exchange": "sdr_unrouted"}); !reflect.DeepEqual(ch.exchangeArgs, want) {
+		t.Fatalf("expected %v, got %v", want, ch.exchangeArgs)
+	}
+}
+
+func TestDeclareTopology_PassiveOnlyChecks(t *testing.T) {
+	ch := &fakeTopologyChannel{}
+	if err := declareTopology(ch, Config{Topology: TopologyPassive}.withDefaults()); err != nil {
+		t.Fatal(err)
+	}
+
+	wantCalls := []string{"exchange? sdr_exchange direct", "queue? sdr_queue"}
+	if !reflect.DeepEqual(ch.calls, wantCalls) {
+		t.Fatalf("expected %v, got %v", wantCalls, ch.calls)
+	}
+}
+
+func TestDeclareTopology_ExplainsMismatchedQueue(t *testing.T) {
+	brokerErr := &amqp.Error{Code: amqp.PreconditionFailed, Reason: "PRECONDITION_FAILED - inequivalent arg 'x-queue-type' for queue 'sdr_queue'"}
+	ch := &fakeTopologyChannel{queueErr: brokerErr}
+
+	err := declareTopology(ch, Config{QueueType: QueueQuorum}.withDefaults())
+	if !errors.Is(err, brokerErr) {
+		t.Fatalf("expected the broker error to be wrapped, got %v", err)
+	}
+	for _, want := range []string{`queue "sdr_queue" already exists with different settings`, "inequivalent arg 'x-queue-type'", "WIN_SOUND_RABBITMQ_TOPOLOGY=passive"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in %v", want, err)
+		}
+	}
+}
+
+func TestValidateTopology(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"exchange type", Config{ExchangeType: "x-delayed"}, "WIN_SOUND_RABBITMQ_EXCHANGE_TYPE"},
+		{"queue type", Config{QueueType: "lazy"}, "WIN_SOUND_RABBITMQ_QUEUE_TYPE"},
+		{"overflow without max length", Config{QueueOverflow: "drop-head"}, "requires WIN_SOUND_RABBITMQ_QUEUE_MAX_LENGTH"},
+		{"alternate exchange is the exchange", Config{AlternateExchange: "sdr_exchange"}, "must differ"},
+		{"dead letter key without exchange", Config{DeadLetterRoutingKey: "dead"}, "requires WIN_SOUND_RABBITMQ_DLX"},
+		{"stream with TTL", Config{QueueType: QueueStream, MessageTTL: time.Minute}, "stream queues"},
+		{"quorum with reject-publish-dlx", Config{QueueType: QueueQuorum, MaxLength: 1, QueueOverflow: "reject-publish-dlx"}, "quorum queues"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.withDefaults().validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected an error mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// withURL returns c with the connection settings of an amqp:// or amqps:// URL, including the
+// heartbeat, connection_timeout, channel_max, auth_mechanism and TLS file query parameters.
+// Errors never contain the password.
+func (c Config) withURL(raw string) (Config, error) {
+	uri, err := amqp.ParseURI(raw)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid WIN_SOUND_RABBITMQ_URL %s: %s", redactURL(raw), describeURIError(err))
+	}
+	// ParseURI does not expose the heartbeat, so the query is read again.
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid WIN_SOUND_RABBITMQ_URL %s: malformed URL", redactURL(raw))
+	}
+	params := u.Query()
+
+	c.Host, c.Port = uri.Host, uri.Port
+	c.User, c.Password = uri.Username, uri.Password
+	c.VHost = uri.Vhost
+	c.TLSEnabled = uri.Scheme == "amqps"
+	c.TLSCAFile, c.TLSCertFile, c.TLSKeyFile = uri.CACertFile, uri.CertFile, uri.KeyFile
+	c.TLSServerName = uri.ServerName
+
+	for _, mechanism := range uri.AuthMechanism {
+		switch m := strings.ToLower(mechanism); m {
+		case AuthPlain, AuthExternal:
+			c.AuthMechanism = m
+		default:
+			return Config{}, fmt.Errorf("invalid WIN_SOUND_RABBITMQ_URL %s: unsupported auth_mechanism %q (supported: %s, %s)", redactURL(raw), mechanism, AuthPlain, AuthExternal)
+		}
+	}
+	if params.Has("heartbeat") {
+		// Already validated by ParseURI.
+		seconds, _ := strconv.Atoi(params.Get("heartbeat"))
+		c.ConnectionThreshold = time.Duration(seconds) * time.Second
+	}
+	if uri.ConnectionTimeout != 0 {
+		c.ConnectionTimeout = time.Duration(uri.ConnectionTimeout) * time.Millisecond
+	}
+	if uri.ChannelMax != 0 {
+		c.ChannelMax = uri.ChannelMax
+	}
+
+	return c, nil
+}
+
+// url returns the connection settings of c as a URL, the inverse of withURL.
+func (c Config) url() string {
+	u, err := url.Parse(brokerURI(c))
+	if err != nil {
+		return ""
+	}
+
+	params := url.Values{}
+	if c.TLSCAFile != "" {
+		params.Set("cacertfile", c.TLSCAFile)
+	}
+	if c.TLSCertFile != "" {
+		params.Set("certfile", c.TLSCertFile)
+	}
+	if c.TLSKeyFile != "" {
+		params.Set("keyfile", c.TLSKeyFile)
+	}
+	if c.TLSServerName != "" {
+		params.Set("server_name_indication", c.TLSServerName)
+	}
+	if c.AuthMechanism != "" && c.AuthMechanism != AuthPlain {
+		params.Set("auth_mechanism", c.AuthMechanism)
+	}
+	if c.ConnectionThreshold > 0 {
+		params.Set("heartbeat", strconv.Itoa(int(c.ConnectionThreshold/time.Second)))
+	}
+	if c.ConnectionTimeout > 0 {
+		params.Set("connection_timeout", strconv.Itoa(int(c.ConnectionTimeout/time.Millisecond)))
+	}
+	if c.ChannelMax > 0 {
+		params.Set("channel_max", strconv.Itoa(int(c.ChannelMax)))
+	}
+	u.RawQuery = params.Encode()
+	return u.String()
+}
+
+// redactURL returns raw with the password masked, or a placeholder if it can not be parsed safely.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "(unparsable URL)"
+	}
+	return strconv.Quote(u.Redacted())
+}
+
+// describeURIError drops the URL that net/url errors repeat, as it may contain the password.
+func describeURIError(err error) string {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err.Error()
+	}
+	return err.Error()
+}
@@ -0,0 +1,206 @@
+package restapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/logging"
+)
+
+const maxErrorBodyBytes = 512
+
+// StatusError reports a non-2xx response of the device repository API.
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("%s %s: unexpected status %d", e.Method, e.URL, e.StatusCode)
+	}
+	return fmt.Sprintf("%s %s: unexpected status %d: %s", e.Method, e.URL, e.StatusCode, e.Body)
+}
+
+// Temporary reports whether repeating the request may succeed.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// Permanent reports whether the API rejected the request itself, so repeating it can not succeed:
+// a 4xx response other than 408 and 429.
+func (e *StatusError) Permanent() bool {
+	return e.StatusCode >= 400 && e.StatusCode < 500 && !e.Temporary()
+}
+
+// RequestError reports a request that can not be built or encoded, e.g. for an invalid URL;
+// sending it again fails the same way.
+type RequestError struct {
+	Err error
+}
+
+func (e *RequestError) Error() string { return e.Err.Error() }
+
+func (e *RequestError) Unwrap() error { return e.Err }
+
+// Permanent reports true, so the outbox drops the request instead of retrying it ahead of later ones.
+func (e *RequestError) Permanent() bool { return true }
+
+// Client sends JSON bodies to the device repository API, retrying 5xx, 408, 429 and transport errors with backoff.
+type Client struct {
+	cfg    Config
+	http   *http.Client
+	logger logging.Logger
+}
+
+func NewClient(cfg Config, logger logging.Logger) *Client {
+	if logger == nil {
+		panic("nil logger")
+	}
+
+	cfg = cfg.withDefaults()
+	return &Client{
+		cfg:    cfg,
+		http:   &http.Client{Timeout: cfg.RequestTimeout},
+		logger: logger,
+	}
+}
+
+// Send issues method against the base URL extended by urlSuffix.
+// Non-2xx responses are returned as *StatusError.
+func (c *Client) Send(ctx context.Context, method, urlSuffix string, body []byte) error {
+	target := c.cfg.BaseURL + escapeURLSuffix(urlSuffix)
+
+	delay := c.cfg.InitialRetryDelay
+	for attempt := 1; ; attempt++ {
+		retryAfter, err := c.send(ctx, method, target, body)
+		if err == nil {
+			return nil
+		}
+		if !IsTemporary(err) || attempt >= c.cfg.MaxAttempts {
+			return fmt.Errorf("rest request failed after %d attempt(s): %w", attempt, err)
+		}
+
+		wait := delay
+		if retryAfter > wait {
+			wait = minDuration(retryAfter, c.cfg.MaxRetryDelay)
+		}
+		c.logf("[warn, rest client] attempt %d/%d failed: %v. Retrying in %s...", attempt, c.cfg.MaxAttempts, err, wait)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		delay = minDuration(delay*2, c.cfg.MaxRetryDelay)
+	}
+}
+
+// send performs one attempt and returns the server's Retry-After hint, if any.
+func (c *Client) send(ctx context.Context, method, target string, body []byte) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, &RequestError{Err: fmt.Errorf("build rest request: %w", err)}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	switch {
+	case c.cfg.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.cfg.BearerToken)
+	case c.cfg.User != "":
+		req.SetBasicAuth(c.cfg.User, c.cfg.Password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return 0, nil
+	}
+
+	text, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+	return parseRetryAfter(resp.Header.Get("Retry-After")), &StatusError{
+		Method:     method,
+		URL:        target,
+		StatusCode: resp.StatusCode,
+		Body:       strings.TrimSpace(string(text)),
+	}
+}
+
+func (c *Client) logf(format string, args ...interface{}) {
+	c.logger.Printf(format, args...)
+}
+
+// IsTemporary reports whether repeating a failed Send may succeed: a temporary status or a transport error
+// such as a refused or reset connection, a timeout or a connection closed mid-response.
+// Cancellation, requests that can not be built and other errors are not temporary.
+func IsTemporary(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Temporary()
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	// http.Client wraps every error in *url.Error, also an unsupported scheme; judge the cause.
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// escapeURLSuffix escapes each path segment, since PnP IDs may contain reserved characters.
+func escapeURLSuffix(suffix string) string {
+	if suffix == "" {
+		return ""
+	}
+	segments := strings.Split(suffix, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
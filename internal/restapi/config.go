@@ -0,0 +1,117 @@
+package restapi
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRequestTimeout    = 10 * time.Second
+	defaultMaxAttempts       = 5
+	defaultInitialRetryDelay = 500 * time.Millisecond
+	defaultMaxRetryDelay     = 15 * time.Second
+)
+
+// Config defines the device repository endpoint, credentials and retry settings.
+type Config struct {
+	BaseURL           string
+	BearerToken       string
+	User              string
+	Password          string
+	RequestTimeout    time.Duration
+	MaxAttempts       int
+	InitialRetryDelay time.Duration
+	MaxRetryDelay     time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		RequestTimeout:    defaultRequestTimeout,
+		MaxAttempts:       defaultMaxAttempts,
+		InitialRetryDelay: defaultInitialRetryDelay,
+		MaxRetryDelay:     defaultMaxRetryDelay,
+	}
+}
+
+func (c Config) withDefaults() Config {
+	d := DefaultConfig()
+
+	c.BaseURL = strings.TrimRight(strings.TrimSpace(c.BaseURL), "/")
+	if c.RequestTimeout <= 0 {
+		c.RequestTimeout = d.RequestTimeout
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = d.MaxAttempts
+	}
+	if c.InitialRetryDelay <= 0 {
+		c.InitialRetryDelay = d.InitialRetryDelay
+	}
+	if c.MaxRetryDelay <= 0 {
+		c.MaxRetryDelay = d.MaxRetryDelay
+	}
+	if c.MaxRetryDelay < c.InitialRetryDelay {
+		c.MaxRetryDelay = c.InitialRetryDelay
+	}
+
+	return c
+}
+
+func (c Config) validate() error {
+	if c.BaseURL == "" {
+		return errors.New("WIN_SOUND_HTTP_BASE_URL is required")
+	}
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return fmt.Errorf("invalid WIN_SOUND_HTTP_BASE_URL %q: %w", c.BaseURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("invalid WIN_SOUND_HTTP_BASE_URL %q: expected http(s)://host[/path]", c.BaseURL)
+	}
+	if c.BearerToken != "" && c.User != "" {
+		return errors.New("WIN_SOUND_HTTP_BEARER_TOKEN and WIN_SOUND_HTTP_USER are mutually exclusive")
+	}
+	return nil
+}
+
+// LoadConfigFromEnv loads REST API configuration from environment variables.
+// Empty values are replaced by defaults; the base URL is required.
+func LoadConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
+
+	cfg.BaseURL = os.Getenv("WIN_SOUND_HTTP_BASE_URL")
+	cfg.BearerToken = strings.TrimSpace(os.Getenv("WIN_SOUND_HTTP_BEARER_TOKEN"))
+	cfg.User = os.Getenv("WIN_SOUND_HTTP_USER")
+	cfg.Password = os.Getenv("WIN_SOUND_HTTP_PASSWORD")
+
+	if v := strings.TrimSpace(os.Getenv("WIN_SOUND_HTTP_TIMEOUT_MS")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid WIN_SOUND_HTTP_TIMEOUT_MS %q: %w", v, err)
+		}
+		if n < 0 {
+			return Config{}, fmt.Errorf("WIN_SOUND_HTTP_TIMEOUT_MS can not be negative %q", v)
+		}
+		cfg.RequestTimeout = time.Duration(n) * time.Millisecond
+	}
+	if v := strings.TrimSpace(os.Getenv("WIN_SOUND_HTTP_MAX_ATTEMPTS")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid WIN_SOUND_HTTP_MAX_ATTEMPTS %q: %w", v, err)
+		}
+		if n < 0 {
+			return Config{}, fmt.Errorf("WIN_SOUND_HTTP_MAX_ATTEMPTS can not be negative %q", v)
+		}
+		cfg.MaxAttempts = n
+	}
+
+	cfg = cfg.withDefaults()
+	if err := cfg.validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
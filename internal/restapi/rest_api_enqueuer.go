@@ -0,0 +1,78 @@
+package restapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/enqueuer"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/logging"
+)
+
+// RestApiEnqueuer sends requests directly to the device repository API,
+// doing the POST/PUT calls the RmqToRestApiForwarder would replay from RabbitMQ.
+type RestApiEnqueuer struct {
+	baseCtx context.Context
+	client  *Client
+	logger  logging.Logger
+
+	mu          sync.Mutex
+	failing     bool // a request failed for a reason other than a rejection since the last success
+	onRecovered func()
+}
+
+func NewRestApiEnqueuerWithContext(baseCtx context.Context, cfg Config, logger logging.Logger) *RestApiEnqueuer {
+	if baseCtx == nil {
+		panic("nil context")
+	}
+	if logger == nil {
+		panic("nil logger")
+	}
+
+	return &RestApiEnqueuer{
+		baseCtx: baseCtx,
+		client:  NewClient(cfg, logger),
+		logger:  logger,
+	}
+}
+
+func (e *RestApiEnqueuer) EnqueueRequest(request enqueuer.Request) error {
+	restRequest := enqueuer.NewRestRequest(request)
+
+	body, err := json.Marshal(restRequest.Payload)
+	if err != nil {
+		return &RequestError{Err: fmt.Errorf("marshal rest payload: %w", err)}
+	}
+
+	e.logf("[info, rest enqueuer] sending method=%s urlSuffix=%s", restRequest.Method, restRequest.URLSuffix)
+	err = e.client.Send(e.baseCtx, restRequest.Method, restRequest.URLSuffix, body)
+
+	e.mu.Lock()
+	var recovered func()
+	switch {
+	case err == nil && e.failing:
+		e.failing = false
+		recovered = e.onRecovered
+	case err != nil && !enqueuer.IsPermanent(err):
+		e.failing = true
+	}
+	e.mu.Unlock()
+
+	if recovered != nil {
+		recovered()
+	}
+	return err
+}
+
+// SetRecoveredHandler registers h to be called when a request succeeds after requests failed,
+// e.g. because the API was unreachable; requests may have been lost meanwhile. h must not block.
+func (e *RestApiEnqueuer) SetRecoveredHandler(h func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onRecovered = h
+}
+
+func (e *RestApiEnqueuer) logf(format string, args ...interface{}) {
+	e.logger.Printf(format, args...)
+}
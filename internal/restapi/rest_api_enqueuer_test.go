@@ -0,0 +1,237 @@
+package restapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/enqueuer"
+)
+
+func newTestEnqueuer(baseURL string, cfg Config) *RestApiEnqueuer {
+	cfg.BaseURL = baseURL
+	cfg.InitialRetryDelay = time.Millisecond
+	cfg.MaxRetryDelay = 5 * time.Millisecond
+	return NewRestApiEnqueuerWithContext(context.Background(), cfg, log.New(io.Discard, "", 0))
+}
+
+func TestEnqueueRequest_PostsDeviceWithBearerToken(t *testing.T) {
+	var gotMethod, gotPath, gotAuth string
+	var gotBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath, gotAuth = r.Method, r.URL.Path, r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&gotBody)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	e := newTestEnqueuer(server.URL+"/api/AudioDevices", Config{BearerToken: "secret"})
+	err := e.EnqueueRequest(enqueuer.Request{
+		Timestamp: time.Now(),
+		Event:     contract.EventTypeRenderDeviceDiscovered,
+		Data: contract.DeviceSnapshot{
+			DeviceRef:    contract.DeviceRef{HostName: "host-1", PnpID: "pnp-1"},
+			Name:         "Speakers",
+			RenderVolume: 40,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gotMethod != http.MethodPost || gotPath != "/api/AudioDevices" {
+		t.Fatalf("unexpected request %s %s", gotMethod, gotPath)
+	}
+	if gotAuth != "Bearer secret" {
+		t.Fatalf("unexpected Authorization header %q", gotAuth)
+	}
+	if gotBody[contract.FieldRenderVolume] != float64(40) || gotBody[contract.FieldFlowType] != float64(contract.FlowTypeRender) {
+		t.Fatalf("unexpected body %v", gotBody)
+	}
+	if _, ok := gotBody[contract.FieldHTTPRequest]; ok {
+		t.Fatalf("transport field leaked into body %v", gotBody)
+	}
+}
+
+func TestEnqueueRequest_PutsVolumeWithBasicAuthAfterRetries(t *testing.T) {
+	var calls atomic.Int32
+	var gotPath, gotUser string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			gotPath = r.URL.EscapedPath()
+			gotUser, _, _ = r.BasicAuth()
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	e := newTestEnqueuer(server.URL, Config{User: "scanner", Password: "pw"})
+	err := e.EnqueueRequest(enqueuer.Request{
+		Event: contract.EventTypeCaptureVolumeChanged,
+		Data: contract.VolumeChange{
+			DeviceRef: contract.DeviceRef{HostName: "host-1", PnpID: "{0.0.1.00000000}.{abc}"},
+			Volume:    70,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if calls.Load() != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls.Load())
+	}
+	if gotPath != "/%7B0.0.1.00000000%7D.%7Babc%7D/host-1" {
+		t.Fatalf("unexpected path %q", gotPath)
+	}
+	if gotUser != "scanner" {
+		t.Fatalf("unexpected basic auth user %q", gotUser)
+	}
+}
+
+func TestEnqueueRequest_ClientErrorIsNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "unknown device", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	e := newTestEnqueuer(server.URL, Config{})
+	err := e.EnqueueRequest(enqueuer.Request{
+		Event: contract.EventTypeRenderVolumeChanged,
+		Data:  contract.VolumeChange{DeviceRef: contract.DeviceRef{HostName: "host-1", PnpID: "pnp-1"}},
+	})
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected StatusError 404, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expected a single attempt, got %d", calls.Load())
+	}
+}
+
+func TestEnqueueRequest_GivesUpAfterMaxAttempts(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	e := newTestEnqueuer(server.URL, Config{MaxAttempts: 3})
+	err := e.EnqueueRequest(enqueuer.Request{Event: contract.EventTypeRenderDeviceConfirmed})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls.Load())
+	}
+}
+
+func TestEnqueueRequest_ReportsRecoveryAfterFailures(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer server.Close()
+
+	e := newTestEnqueuer(server.URL, Config{MaxAttempts: 1})
+	var recovered atomic.Int32
+	e.SetRecoveredHandler(func() { recovered.Add(1) })
+	send := func() error {
+		return e.EnqueueRequest(enqueuer.Request{Event: contract.EventTypeRenderDeviceConfirmed})
+	}
+
+	if err := send(); err == nil {
+		t.Fatal("expected an error while the API is unavailable")
+	}
+	status.Store(http.StatusNotFound)
+	_ = send() // a rejection proves the API is reachable, but it is no success
+	if recovered.Load() != 0 {
+		t.Fatalf("expected no recovery before a success, got %d", recovered.Load())
+	}
+
+	status.Store(http.StatusOK)
+	for i := 0; i < 2; i++ {
+		if err := send(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if recovered.Load() != 1 {
+		t.Fatalf("expected one recovery, got %d", recovered.Load())
+	}
+}
+
+func TestStatusError_RequestTimeoutIsTemporary(t *testing.T) {
+	for status, want := range map[int]bool{
+		http.StatusBadRequest:          false,
+		http.StatusNotFound:            false,
+		http.StatusRequestTimeout:      true,
+		http.StatusTooManyRequests:     true,
+		http.StatusServiceUnavailable:  true,
+		http.StatusInternalServerError: true,
+	} {
+		err := &StatusError{StatusCode: status}
+		if got := err.Temporary(); got != want {
+			t.Fatalf("status %d: expected temporary=%v, got %v", status, want, got)
+		}
+		if got := err.Permanent(); got == want {
+			t.Fatalf("status %d: expected permanent=%v, got %v", status, !want, got)
+		}
+	}
+}
+
+func TestIsTemporary(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	for name, tc := range map[string]struct {
+		err  error
+		want bool
+	}{
+		"5xx":                 {&StatusError{StatusCode: http.StatusBadGateway}, true},
+		"4xx":                 {&StatusError{StatusCode: http.StatusNotFound}, false},
+		"refused connection":  {&url.Error{Op: "Post", URL: "http://repo", Err: refused}, true},
+		"closed mid-response": {&url.Error{Op: "Post", URL: "http://repo", Err: io.EOF}, true},
+		"unsupported scheme":  {&url.Error{Op: "Post", URL: "ftp://repo", Err: errors.New(`unsupported protocol scheme "ftp"`)}, false},
+		"request not built":   {&RequestError{Err: errors.New("build rest request: bad URL")}, false},
+		"canceled":            {context.Canceled, false},
+		"deadline exceeded":   {fmt.Errorf("wrapped: %w", context.DeadlineExceeded), true},
+		"other error":         {errors.New("boom"), false},
+	} {
+		if got := IsTemporary(tc.err); got != tc.want {
+			t.Fatalf("%s: expected temporary=%v, got %v", name, tc.want, got)
+		}
+	}
+}
+
+func TestEnqueueRequest_RequestThatCanNotBeBuiltIsPermanent(t *testing.T) {
+	e := newTestEnqueuer("http://repo example/api", Config{MaxAttempts: 3})
+	err := e.EnqueueRequest(enqueuer.Request{Event: contract.EventTypeRenderDeviceConfirmed, Data: contract.DeviceSnapshot{DeviceRef: contract.DeviceRef{HostName: "host-1", PnpID: "spk"}}})
+
+	var requestErr *RequestError
+	if !errors.As(err, &requestErr) || !enqueuer.IsPermanent(err) {
+		t.Fatalf("expected a permanent *RequestError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "after 1 attempt(s)") {
+		t.Fatalf("expected no retries, got %v", err)
+	}
+}
@@ -8,13 +8,19 @@ import (
 	"time"
 
 	c "github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/devicesource"
 	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/enqueuer"
 	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/logging"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/outbox"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/pipeline"
 	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/rabbitmq"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/restapi"
 )
 
-func NewWithLogger(enqueue func(c.EventType, map[string]string), logger logging.Logger) (ScannerApp, error) {
+func NewWithLogger(source devicesource.DeviceSource, settings Settings, enqueue func(c.EventType, c.Event), logger logging.Logger) (ScannerApp, error) {
 	return NewImpl(
+		source,
+		settings,
 		enqueue,
 		func(format string, v ...interface{}) { logging.PrintInfo(logger, format, v...) },
 		func(format string, v ...interface{}) { logging.PrintError(logger, format, v...) },
@@ -23,18 +29,61 @@ func NewWithLogger(enqueue func(c.EventType, map[string]string), logger logging.
 
 func Run(ctx context.Context) error {
 	appLogger := logging.NewAppLogger()
-	reqEnqueuer, cleanupEnqueuer, err := newRequestEnqueuer(ctx, appLogger)
+	pipelineCfg, err := pipeline.LoadConfigFromEnv()
+	if err != nil {
+		return err
+	}
+
+	// The publisher reports reconnects here, the REST API enqueuer its recovery after failures;
+	// messages may have been lost meanwhile, so everything is posted again.
+	reconnected := make(chan struct{}, 1)
+	onReconnect := func() {
+		select {
+		case reconnected <- struct{}{}:
+		default:
+		}
+	}
+
+	// Dropped requests leave the repository behind the published state, so the next resync confirms every device.
+	// Resyncing right away could drop again, e.g. while the broker is down without an outbox.
+	dropped := make(chan struct{}, 1)
+	onDrop := func() {
+		select {
+		case dropped <- struct{}{}:
+		default:
+		}
+	}
+
+	reqEnqueuer, cleanupEnqueuer, err := newRequestEnqueuer(ctx, appLogger, onReconnect, onDrop)
 	if err != nil {
 		return err
 	}
 	defer cleanupEnqueuer()
 
-	enqueue := func(event c.EventType, fields map[string]string) {
-		if err := reqEnqueuer.EnqueueRequest(enqueuer.Request{
+	// Queue requests in memory, so device callbacks never wait for the transport.
+	// Deferred after cleanupEnqueuer, so it drains into a still open transport.
+	requestPipeline, err := pipeline.NewPipeline(pipelineCfg, reqEnqueuer, appLogger)
+	if err != nil {
+		return err
+	}
+	requestPipeline.SetDropHandler(onDrop)
+	defer func() {
+		if err := requestPipeline.Close(); err != nil {
+			logging.PrintError(appLogger, "pipeline close failed: %v", err)
+		}
+	}()
+
+	enqueue := func(event c.EventType, data c.Event) {
+		request := enqueuer.Request{
 			Timestamp: time.Now(),
 			Event:     event,
-			Fields:    fields,
-		}); err != nil {
+			Data:      data,
+		}
+		if err := request.Validate(); err != nil {
+			logging.PrintError(appLogger, "dropping invalid event: %v", err)
+			return
+		}
+		if err := requestPipeline.EnqueueRequest(request); err != nil {
 			logging.PrintError(appLogger, "enqueue failed: %v", err)
 		}
 	}
@@ -43,21 +92,44 @@ func Run(ctx context.Context) error {
 		logging.AttachSoundlibwrapBridge(logging.NewPlainLogger(), "cpp backend,")
 	}
 
+	settings, err := LoadSettingsFromEnv()
+	if err != nil {
+		return err
+	}
+
+	source, err := devicesource.New(devicesource.Options{
+		Kind:         os.Getenv(EnvWinSoundSource),
+		ScenarioPath: os.Getenv(EnvWinSoundSimulatedScenario),
+	})
+	if err != nil {
+		return err
+	}
+
 	logging.PrintInfo(appLogger, "Initializing...")
 
-	app, err := NewWithLogger(enqueue, appLogger)
+	app, err := NewWithLogger(source, settings, enqueue, appLogger)
 	if err != nil {
 		return err
 	}
 	defer app.Shutdown()
 
 	// Keep running until interrupted to receive async logs and change events.
-	<-ctx.Done()
-	logging.PrintInfo(appLogger, "Shutting down...")
-	return nil
+	for {
+		select {
+		case <-ctx.Done():
+			logging.PrintInfo(appLogger, "Shutting down...")
+			return nil
+		case <-reconnected:
+			logging.PrintInfo(appLogger, "Transport reconnected, resynchronizing all devices")
+			app.Resync(true)
+		case <-dropped:
+			logging.PrintInfo(appLogger, "Events were dropped, the next resync confirms all devices")
+			app.ForgetPublishedState()
+		}
+	}
 }
 
-func newRequestEnqueuer(ctx context.Context, logger logging.Logger) (enqueuer.EnqueueRequest, func(), error) {
+func newRequestEnqueuer(ctx context.Context, logger logging.Logger, onReconnect, onDrop func()) (enqueuer.EnqueueRequest, func(), error) {
 	mode := strings.ToLower(strings.TrimSpace(os.Getenv(EnvWinSoundEnqueuer)))
 
 	// Return a no-op enqueuer for testing or when RabbitMQ is not available.
@@ -65,23 +137,71 @@ func newRequestEnqueuer(ctx context.Context, logger logging.Logger) (enqueuer.En
 		return enqueuer.NewEmptyRequestEnqueuer(logger), func() {}, nil
 	}
 
-	// Validate that the configured mode is supported.
-	if mode != "" && mode != "rabbitmq" {
-		return nil, nil, fmt.Errorf("unsupported %s=%q (supported: empty, rabbitmq)", EnvWinSoundEnqueuer, mode)
+	outboxCfg, err := outbox.LoadConfigFromEnv()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var reqEnqueuer enqueuer.EnqueueRequest
+	var cleanup func()
+
+	switch mode {
+	case "", "rabbitmq":
+		reqEnqueuer, cleanup, err = newRabbitMqEnqueuer(ctx, logger, onReconnect)
+	case "http":
+		reqEnqueuer, cleanup, err = newRestApiEnqueuer(ctx, logger, onReconnect)
+	default:
+		return nil, nil, fmt.Errorf("unsupported %s=%q (supported: empty, rabbitmq, http)", EnvWinSoundEnqueuer, mode)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !outboxCfg.Enabled {
+		return reqEnqueuer, cleanup, nil
+	}
+
+	// Persist requests first, so events survive transport outages and restarts.
+	box, err := outbox.NewOutbox(ctx, outboxCfg, reqEnqueuer, logger)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	box.SetDropHandler(onDrop)
+	logging.PrintInfo(logger, "Outbox enabled in %s", outboxCfg.Dir)
+
+	cleanupWithOutbox := func() {
+		if err := box.Close(); err != nil {
+			logging.PrintError(logger, "outbox close failed: %v", err)
+		}
+		cleanup()
 	}
 
+	return box, cleanupWithOutbox, nil
+}
+
+func newRabbitMqEnqueuer(ctx context.Context, logger logging.Logger, onReconnect func()) (enqueuer.EnqueueRequest, func(), error) {
 	cfg, err := rabbitmq.LoadConfigFromEnv()
 	if err != nil {
 		return nil, nil, err
 	}
+	routingKeys, err := rabbitmq.NewRoutingKeys(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	publisher, err := rabbitmq.NewRequestPublisher(ctx, cfg, logger)
 	if err != nil {
 		return nil, nil, err
 	}
+	publisher.SetReconnectHandler(onReconnect)
+	publisher.SetStateHandler(connectionStateLogger(logger, publisher.State(), time.Now))
 
-	reqEnqueuer := rabbitmq.NewRabbitMqEnqueuerWithContext(ctx, publisher, logger)
+	reqEnqueuer := rabbitmq.NewRabbitMqEnqueuerWithContext(ctx, publisher, routingKeys, cfg.BodyFormat, logger)
 	cleanup := func() {
+		if state := publisher.State(); state != rabbitmq.StateReady {
+			logger.Printf("[warn] Shutting down while the RabbitMQ publisher is %s, unconfirmed events may be lost", state)
+		}
 		if err := reqEnqueuer.Close(); err != nil {
 			logging.PrintError(logger, "rabbitmq enqueuer close failed: %v", err)
 		}
@@ -89,3 +209,39 @@ func newRequestEnqueuer(ctx context.Context, logger logging.Logger) (enqueuer.En
 
 	return reqEnqueuer, cleanup, nil
 }
+
+// connectionStateLogger returns a publisher state handler that logs when publishing stops,
+// and how long it was stopped when it resumes. initial is the state at registration.
+func connectionStateLogger(logger logging.Logger, initial rabbitmq.ConnectionState, now func() time.Time) func(rabbitmq.ConnectionState) {
+	var stoppedAt time.Time
+	if initial != rabbitmq.StateReady {
+		stoppedAt = now()
+	}
+
+	return func(state rabbitmq.ConnectionState) {
+		switch state {
+		case rabbitmq.StateReady:
+			if !stoppedAt.IsZero() {
+				logging.PrintInfo(logger, "RabbitMQ publishing resumed after %s", now().Sub(stoppedAt).Round(time.Second))
+				stoppedAt = time.Time{}
+			}
+		case rabbitmq.StateConnecting, rabbitmq.StateBlocked:
+			if stoppedAt.IsZero() {
+				stoppedAt = now()
+			}
+			logger.Printf("[warn] RabbitMQ publishing stopped, the publisher is %s", state)
+		}
+	}
+}
+
+func newRestApiEnqueuer(ctx context.Context, logger logging.Logger, onRecovered func()) (enqueuer.EnqueueRequest, func(), error) {
+	cfg, err := restapi.LoadConfigFromEnv()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logging.PrintInfo(logger, "Sending requests directly to %s", cfg.BaseURL)
+	reqEnqueuer := restapi.NewRestApiEnqueuerWithContext(ctx, cfg, logger)
+	reqEnqueuer.SetRecoveredHandler(onRecovered)
+	return reqEnqueuer, func() {}, nil
+}
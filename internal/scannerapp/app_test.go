@@ -0,0 +1,52 @@
+package scannerapp
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/rabbitmq"
+)
+
+type lineLogger struct{ lines []string }
+
+func (l *lineLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestConnectionStateLogger_ReportsHowLongPublishingStopped(t *testing.T) {
+	logger := &lineLogger{}
+	clk := newFakeClock()
+	onState := connectionStateLogger(logger, rabbitmq.StateReady, clk.Now)
+
+	onState(rabbitmq.StateBlocked)
+	clk.Advance(30 * time.Second)
+	onState(rabbitmq.StateConnecting)
+	clk.Advance(45 * time.Second)
+	onState(rabbitmq.StateReady)
+	onState(rabbitmq.StateClosed)
+
+	want := []string{
+		"[warn] RabbitMQ publishing stopped, the publisher is blocked",
+		"[warn] RabbitMQ publishing stopped, the publisher is connecting",
+		"[info] RabbitMQ publishing resumed after 1m15s",
+	}
+	if !reflect.DeepEqual(logger.lines, want) {
+		t.Fatalf("expected %q, got %q", want, logger.lines)
+	}
+}
+
+func TestConnectionStateLogger_CountsFromRegistrationWhenNotReady(t *testing.T) {
+	logger := &lineLogger{}
+	clk := newFakeClock()
+	onState := connectionStateLogger(logger, rabbitmq.StateConnecting, clk.Now)
+
+	clk.Advance(10 * time.Second)
+	onState(rabbitmq.StateReady)
+
+	want := []string{"[info] RabbitMQ publishing resumed after 10s"}
+	if !reflect.DeepEqual(logger.lines, want) {
+		t.Fatalf("expected %q, got %q", want, logger.lines)
+	}
+}
@@ -4,33 +4,60 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/collect-sound-devices/sound-win-scanner/v4/pkg/soundlibwrap"
 	c "github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/devicesource"
 	"github.com/collect-sound-devices/win-sound-dev-go-bridge/pkg/appinfo"
 )
 
 type ScannerApp interface {
 	RepostRenderDeviceToApi(c.EventType)
 	RepostCaptureDeviceToApi(c.EventType)
+	Resync(force bool)
+	ForgetPublishedState()
 	Shutdown()
 }
 
 type scannerAppImpl struct {
-	soundLibHandle soundlibwrap.Handle
-	enqueueFunc    func(c.EventType, map[string]string)
-	logInfo        func(string, ...interface{})
-	logError       func(string, ...interface{})
-	osName         string
-	hostName       string
+	source      devicesource.DeviceSource
+	settings    Settings
+	enumerator  devicesource.EndpointEnumerator
+	volumes     *volumeCoalescer // nil when volume changes are published as they come
+	published   *stateCache
+	clock       clock
+	initialized bool
+	enqueueFunc func(c.EventType, c.Event)
+	logInfo     func(string, ...interface{})
+	logError    func(string, ...interface{})
+	osName      string
+	hostName    string
+
+	mu             sync.Mutex
+	renderDefault  defaultDevice
+	captureDefault defaultDevice
+	knownEndpoints map[string]knownEndpoint
+	resyncTimer    timer
+	stopped        bool
+}
+
+func NewImpl(source devicesource.DeviceSource, settings Settings, enqueue func(c.EventType, c.Event), logInfo func(string, ...interface{}), logError func(string, ...interface{})) (*scannerAppImpl, error) {
+	return newImplWithClock(source, settings, enqueue, logInfo, logError, systemClock{})
 }
 
-func NewImpl(enqueue func(c.EventType, map[string]string), logInfo func(string, ...interface{}), logError func(string, ...interface{})) (*scannerAppImpl, error) {
+func newImplWithClock(source devicesource.DeviceSource, settings Settings, enqueue func(c.EventType, c.Event), logInfo func(string, ...interface{}), logError func(string, ...interface{}), clk clock) (*scannerAppImpl, error) {
 	app := &scannerAppImpl{
+		source:      source,
+		settings:    settings,
 		enqueueFunc: enqueue,
 		logInfo:     logInfo,
 		logError:    logError,
+		published:   newStateCache(),
+		clock:       clk,
+	}
+	if settings.VolumeQuietPeriod > 0 {
+		app.volumes = newVolumeCoalescer(settings.VolumeQuietPeriod, settings.VolumeMaxLatency, clk, app.putVolumeChangeToApi)
 	}
 	app.attachHandlers()
 	if err := app.init(); err != nil {
@@ -41,23 +68,26 @@ func NewImpl(enqueue func(c.EventType, map[string]string), logInfo func(string,
 	app.RepostRenderDeviceToApi(c.EventTypeRenderDeviceConfirmed)
 	app.RepostCaptureDeviceToApi(c.EventTypeCaptureDeviceConfirmed)
 
+	// Post the other active endpoints, if requested and supported.
+	if app.enumerator != nil {
+		app.postAllEndpointsToApi()
+	}
+
+	// Re-read the devices now and then, in case a notification was missed.
+	if settings.ResyncInterval > 0 {
+		app.scheduleResync()
+	}
+
 	return app, nil
 }
 
 func (app *scannerAppImpl) init() error {
-	h, err := soundlibwrap.Initialize(appinfo.AppName, appinfo.Version)
-	if err != nil {
-		return err
-	}
-
-	app.soundLibHandle = h
-	if err := soundlibwrap.RegisterCallbacks(app.soundLibHandle); err != nil {
-		_ = soundlibwrap.Uninitialize(app.soundLibHandle)
-		app.soundLibHandle = 0
+	if err := app.source.Initialize(appinfo.AppName, appinfo.Version); err != nil {
 		return err
 	}
+	app.initialized = true
 
-	if osName, err := soundlibwrap.GetExtendedOperatingSystemName(app.soundLibHandle); err != nil || strings.TrimSpace(osName) == "" {
+	if osName, err := app.source.OperatingSystemName(); err != nil || strings.TrimSpace(osName) == "" {
 		app.logInfo("Cannot get OS name")
 		app.osName = "Unknown OS"
 	} else {
@@ -76,94 +106,309 @@ func (app *scannerAppImpl) init() error {
 
 func (app *scannerAppImpl) attachHandlers() {
 	// Device default change notifications.
-	soundlibwrap.SetDefaultRenderHandler(func(present bool) {
+	app.source.SetDefaultRenderHandler(func(present bool) {
 		if present {
 			app.RepostRenderDeviceToApi(c.EventTypeRenderDeviceDiscovered)
 		} else {
-			// not yet implemented removeDeviceToApi
-			app.logInfo("Render device removed")
+			app.removeDeviceFromApi(c.EventTypeRenderDeviceDetached, c.FlowTypeRender)
 		}
 	})
-	soundlibwrap.SetDefaultCaptureHandler(func(present bool) {
+	app.source.SetDefaultCaptureHandler(func(present bool) {
 		if present {
 			app.RepostCaptureDeviceToApi(c.EventTypeCaptureDeviceDiscovered)
 		} else {
-			// not yet implemented removeDeviceToApi
-			app.logInfo("Capture device removed")
+			app.removeDeviceFromApi(c.EventTypeCaptureDeviceDetached, c.FlowTypeCapture)
 		}
 	})
 
 	// Volume change notifications.
-	soundlibwrap.SetRenderVolumeChangedHandler(func() {
-		if desc, err := soundlibwrap.GetDefaultRender(app.soundLibHandle); err == nil {
-			app.putVolumeChangeToApi(c.EventTypeRenderVolumeChanged, desc.PnpID, int(desc.RenderVolume))
+	app.source.SetRenderVolumeChangedHandler(func() {
+		if desc, err := app.source.DefaultRender(); err == nil {
+			if previous := app.rememberPnpID(c.FlowTypeRender, desc.PnpID); previous != "" {
+				app.putDefaultChangedToApi(c.FlowTypeRender, previous, desc.PnpID)
+			}
+			app.volumeChanged(c.FlowTypeRender, desc.PnpID, int(desc.RenderVolume))
 			app.logInfo("Render volume changed: name=%q pnpId=%q vol=%d", desc.Name, desc.PnpID, desc.RenderVolume)
 		} else {
 			app.logError("Render volume changed, can not read it: %v", err)
 		}
 	})
-	soundlibwrap.SetCaptureVolumeChangedHandler(func() {
-		if desc, err := soundlibwrap.GetDefaultCapture(app.soundLibHandle); err == nil {
-			app.putVolumeChangeToApi(c.EventTypeCaptureVolumeChanged, desc.PnpID, int(desc.CaptureVolume))
+	app.source.SetCaptureVolumeChangedHandler(func() {
+		if desc, err := app.source.DefaultCapture(); err == nil {
+			if previous := app.rememberPnpID(c.FlowTypeCapture, desc.PnpID); previous != "" {
+				app.putDefaultChangedToApi(c.FlowTypeCapture, previous, desc.PnpID)
+			}
+			app.volumeChanged(c.FlowTypeCapture, desc.PnpID, int(desc.CaptureVolume))
 			app.logInfo("Capture volume changed: name=%q pnpId=%q vol=%d", desc.Name, desc.PnpID, desc.CaptureVolume)
 		} else {
 			app.logError("Capture volume changed, can not read it: %v", err)
 		}
 	})
+
+	// Mute change notifications, only when the source reports mute state.
+	if notifier, ok := app.source.(devicesource.MuteNotifier); ok {
+		notifier.SetRenderMuteChangedHandler(func() {
+			if desc, err := app.source.DefaultRender(); err == nil {
+				if previous := app.rememberPnpID(c.FlowTypeRender, desc.PnpID); previous != "" {
+					app.putDefaultChangedToApi(c.FlowTypeRender, previous, desc.PnpID)
+				}
+				if desc.RenderMuted == nil {
+					app.logError("Render mute changed, can not read it: name=%q pnpId=%q", desc.Name, desc.PnpID)
+					return
+				}
+				app.putMuteChangeToApi(c.EventTypeRenderMuteChanged, desc.PnpID, *desc.RenderMuted)
+				app.logInfo("Render mute changed: name=%q pnpId=%q muted=%t", desc.Name, desc.PnpID, *desc.RenderMuted)
+			} else {
+				app.logError("Render mute changed, can not read it: %v", err)
+			}
+		})
+		notifier.SetCaptureMuteChangedHandler(func() {
+			if desc, err := app.source.DefaultCapture(); err == nil {
+				if previous := app.rememberPnpID(c.FlowTypeCapture, desc.PnpID); previous != "" {
+					app.putDefaultChangedToApi(c.FlowTypeCapture, previous, desc.PnpID)
+				}
+				if desc.CaptureMuted == nil {
+					app.logError("Capture mute changed, can not read it: name=%q pnpId=%q", desc.Name, desc.PnpID)
+					return
+				}
+				app.putMuteChangeToApi(c.EventTypeCaptureMuteChanged, desc.PnpID, *desc.CaptureMuted)
+				app.logInfo("Capture mute changed: name=%q pnpId=%q muted=%t", desc.Name, desc.PnpID, *desc.CaptureMuted)
+			} else {
+				app.logError("Capture mute changed, can not read it: %v", err)
+			}
+		})
+	}
+
+	// Endpoint add/remove notifications, only when all endpoints are reported.
+	if app.settings.AllEndpoints {
+		if enumerator, ok := app.source.(devicesource.EndpointEnumerator); ok {
+			app.enumerator = enumerator
+			enumerator.SetEndpointsChangedHandler(app.syncEndpointsToApi)
+		} else {
+			app.logInfo("Device source can not enumerate endpoints, reporting default devices only")
+		}
+	}
 }
 
 func (app *scannerAppImpl) Shutdown() {
-	if app.soundLibHandle != 0 {
-		_ = soundlibwrap.Uninitialize(app.soundLibHandle)
-		app.soundLibHandle = 0
+	app.stopResync()
+	if app.volumes != nil {
+		app.volumes.Flush(c.FlowTypeRender)
+		app.volumes.Flush(c.FlowTypeCapture)
+	}
+	if suppressed := app.published.Suppressed(); suppressed > 0 {
+		app.logInfo("Duplicate events suppressed: %d", suppressed)
 	}
+	if app.initialized {
+		_ = app.source.Uninitialize()
+		app.initialized = false
+	}
+}
+
+// volumeChanged publishes a volume change, or hands it to the coalescer when that is enabled.
+func (app *scannerAppImpl) volumeChanged(flow c.FlowType, pnpID string, volume int) {
+	if app.volumes != nil {
+		app.volumes.Observe(flow, pnpID, volume)
+		return
+	}
+	app.putVolumeChangeToApi(settledVolume{key: volumeKey{flow: flow, pnpID: pnpID}, volume: volume, min: volume, max: volume, changes: 1})
+}
+
+// flushVolume publishes a pending coalesced volume change of flow before another event of that flow.
+func (app *scannerAppImpl) flushVolume(flow c.FlowType) {
+	if app.volumes != nil {
+		app.volumes.Flush(flow)
+	}
+}
+
+func (app *scannerAppImpl) putVolumeChangeToApi(v settledVolume) {
+	event, stateField := c.EventTypeRenderVolumeChanged, c.FieldRenderVolume
+	if v.key.flow == c.FlowTypeCapture {
+		event, stateField = c.EventTypeCaptureVolumeChanged, c.FieldCaptureVolume
+	}
+	if !app.stateChanged(event, v.key.pnpID, map[string]string{stateField: strconv.Itoa(v.volume)}) {
+		return
+	}
+
+	change := c.VolumeChange{
+		DeviceRef:  c.DeviceRef{HostName: app.hostName, PnpID: v.key.pnpID},
+		UpdateDate: time.Now(),
+		Volume:     v.volume,
+	}
+	if app.settings.VolumeReportRange {
+		change.VolumeMin, change.VolumeMax = &v.min, &v.max
+	}
+
+	app.enqueueFunc(event, change)
 }
 
-func (app *scannerAppImpl) putVolumeChangeToApi(event c.EventType, pnpID string, volume int) {
-	fields := map[string]string{
-		c.FieldUpdateDate: time.Now().UTC().Format(time.RFC3339),
-		c.FieldVolume:     strconv.Itoa(volume),
-		c.FieldHostName:   app.hostName,
+func (app *scannerAppImpl) putMuteChangeToApi(event c.EventType, pnpID string, muted bool) {
+	stateField := c.FieldRenderMuted
+	if event == c.EventTypeCaptureMuteChanged {
+		stateField = c.FieldCaptureMuted
 	}
-	if pnpID != "" {
-		fields[c.FieldPnpID] = pnpID
+	if !app.stateChanged(event, pnpID, map[string]string{stateField: strconv.FormatBool(muted)}) {
+		return
 	}
 
-	app.enqueueFunc(event, fields)
+	app.enqueueFunc(event, c.MuteChange{
+		DeviceRef:  c.DeviceRef{HostName: app.hostName, PnpID: pnpID},
+		UpdateDate: time.Now(),
+		Muted:      muted,
+	})
 }
 
 func (app *scannerAppImpl) RepostRenderDeviceToApi(event c.EventType) {
-	if desc, err := soundlibwrap.GetDefaultRender(app.soundLibHandle); err == nil {
-		renderVolume := int(desc.RenderVolume)
-		captureVolume := int(desc.CaptureVolume)
-		app.postDeviceToApi(event, desc.Name, desc.PnpID, renderVolume, captureVolume)
+	app.flushVolume(c.FlowTypeRender)
+	if desc, err := app.source.DefaultRender(); err == nil {
+		previous := app.rememberPnpID(c.FlowTypeRender, desc.PnpID)
+		app.postDeviceToApi(event, desc, true)
 		app.logInfo("Render device identified and updated: name=%q pnpId=%q renderVol=%d captureVol=%d", desc.Name, desc.PnpID, desc.RenderVolume, desc.CaptureVolume)
+		if previous != "" {
+			app.putDefaultChangedToApi(c.FlowTypeRender, previous, desc.PnpID)
+		}
 	} else {
 		app.logError("Render device can not be identified: %v", err)
 	}
 }
 
 func (app *scannerAppImpl) RepostCaptureDeviceToApi(event c.EventType) {
-	if desc, err := soundlibwrap.GetDefaultCapture(app.soundLibHandle); err == nil {
-		renderVolume := int(desc.RenderVolume)
-		captureVolume := int(desc.CaptureVolume)
-		app.postDeviceToApi(event, desc.Name, desc.PnpID, renderVolume, captureVolume)
+	app.flushVolume(c.FlowTypeCapture)
+	if desc, err := app.source.DefaultCapture(); err == nil {
+		previous := app.rememberPnpID(c.FlowTypeCapture, desc.PnpID)
+		app.postDeviceToApi(event, desc, true)
 		app.logInfo("Capture device identified and updated: name=%q pnpId=%q renderVol=%d captureVol=%d", desc.Name, desc.PnpID, desc.RenderVolume, desc.CaptureVolume)
+		if previous != "" {
+			app.putDefaultChangedToApi(c.FlowTypeCapture, previous, desc.PnpID)
+		}
 	} else {
 		app.logError("Capture device can not be identified: %v", err)
 	}
 }
 
-func (app *scannerAppImpl) postDeviceToApi(event c.EventType, name, pnpID string, renderVolume, captureVolume int) {
-	fields := map[string]string{
-		c.FieldUpdateDate:          time.Now().UTC().Format(time.RFC3339),
-		c.FieldName:                name,
-		c.FieldPnpID:               pnpID,
-		c.FieldRenderVolume:        strconv.Itoa(renderVolume),
-		c.FieldCaptureVolume:       strconv.Itoa(captureVolume),
-		c.FieldOperationSystemName: app.osName,
-		c.FieldHostName:            app.hostName,
+func (app *scannerAppImpl) postDeviceToApi(event c.EventType, desc devicesource.Description, isDefault bool) {
+	snapshot := app.deviceSnapshot(desc, isDefault)
+
+	// Startup confirmations are always published, the repository may have lost anything sent before.
+	if isConfirmedEvent(event) {
+		app.published.record(desc.PnpID, c.Fields(snapshot))
+	} else if !app.stateChanged(event, desc.PnpID, c.Fields(snapshot)) {
+		return
+	}
+
+	app.enqueueFunc(event, snapshot)
+}
+
+func (app *scannerAppImpl) deviceSnapshot(desc devicesource.Description, isDefault bool) c.DeviceSnapshot {
+	snapshot := c.DeviceSnapshot{
+		DeviceRef:           c.DeviceRef{HostName: app.hostName, PnpID: desc.PnpID},
+		UpdateDate:          time.Now(),
+		Name:                desc.Name,
+		RenderVolume:        int(desc.RenderVolume),
+		CaptureVolume:       int(desc.CaptureVolume),
+		OperationSystemName: app.osName,
+		IsDefault:           isDefault,
+		// An unknown mute state is left out, so it neither reaches the repository nor the state cache.
+		RenderMuted:  desc.RenderMuted,
+		CaptureMuted: desc.CaptureMuted,
+	}
+	return snapshot
+}
+
+func isConfirmedEvent(event c.EventType) bool {
+	return event == c.EventTypeRenderDeviceConfirmed || event == c.EventTypeCaptureDeviceConfirmed
+}
+
+func (app *scannerAppImpl) removeDeviceFromApi(event c.EventType, flow c.FlowType) {
+	app.flushVolume(flow)
+	pnpID := app.forgetPnpID(flow)
+	if pnpID == "" {
+		app.logInfo("Default device removed (flow=%d), but no device was known", flow)
+		return
+	}
+
+	app.putDetachedToApi(event, pnpID, true)
+	app.logInfo("Device removed: flow=%d pnpId=%q", flow, pnpID)
+}
+
+func (app *scannerAppImpl) putDetachedToApi(event c.EventType, pnpID string, isDefault bool) {
+	app.published.forget(pnpID)
+	app.enqueueFunc(event, c.DeviceDetached{
+		DeviceRef:  c.DeviceRef{HostName: app.hostName, PnpID: pnpID},
+		UpdateDate: time.Now(),
+		IsDefault:  isDefault,
+	})
+}
+
+// stateChanged records the device state an event carries and reports whether publishing it would change anything.
+func (app *scannerAppImpl) stateChanged(event c.EventType, pnpID string, state map[string]string) bool {
+	if pnpID == "" {
+		return true
+	}
+	if app.published.update(pnpID, state) {
+		return true
 	}
+	app.logInfo("Duplicate event suppressed: event=%d pnpId=%q", event, pnpID)
+	return false
+}
+
+// SuppressedDuplicates reports the number of events not published because they repeated the last published state.
+func (app *scannerAppImpl) SuppressedDuplicates() uint64 {
+	return app.published.Suppressed()
+}
+
+func (app *scannerAppImpl) putDefaultChangedToApi(flow c.FlowType, previousPnpID, pnpID string) {
+	event := c.EventTypeDefaultRenderChanged
+	if flow == c.FlowTypeCapture {
+		event = c.EventTypeDefaultCaptureChanged
+	}
+
+	app.enqueueFunc(event, c.DefaultChange{
+		DeviceRef:     c.DeviceRef{HostName: app.hostName, PnpID: pnpID},
+		UpdateDate:    time.Now(),
+		PreviousPnpID: previousPnpID,
+	})
+	app.logInfo("Default device switched: flow=%d from=%q to=%q", flow, previousPnpID, pnpID)
+}
+
+// defaultDevice tracks the default endpoint of one flow.
+type defaultDevice struct {
+	// current is cleared on removal, so a removal can name the device that is already gone only once.
+	current string
+	// lastKnown survives removal, so unplug + plug of another device is still reported as a switch.
+	lastKnown string
+}
+
+func (app *scannerAppImpl) defaultDeviceLocked(flow c.FlowType) *defaultDevice {
+	if flow == c.FlowTypeCapture {
+		return &app.captureDefault
+	}
+	return &app.renderDefault
+}
+
+// rememberPnpID records the current default device and returns the previous one if the default switched.
+func (app *scannerAppImpl) rememberPnpID(flow c.FlowType, pnpID string) string {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	d := app.defaultDeviceLocked(flow)
+	d.current = pnpID
+	if pnpID == "" || d.lastKnown == pnpID {
+		return ""
+	}
+	previous := d.lastKnown
+	d.lastKnown = pnpID
+	return previous
+}
+
+func (app *scannerAppImpl) forgetPnpID(flow c.FlowType) string {
+	app.mu.Lock()
+	defer app.mu.Unlock()
 
-	app.enqueueFunc(event, fields)
+	d := app.defaultDeviceLocked(flow)
+	pnpID := d.current
+	d.current = ""
+	// The caller publishes the detach, endpoint sync must not repeat it.
+	delete(app.knownEndpoints, pnpID)
+	return pnpID
 }
@@ -0,0 +1,340 @@
+package scannerapp
+
+import (
+	"sync"
+	"testing"
+
+	c "github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/devicesource"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/enqueuer"
+)
+
+type capturedEvent struct {
+	event  c.EventType
+	fields map[string]string
+}
+
+type eventRecorder struct {
+	mu      sync.Mutex
+	events  []capturedEvent
+	invalid []error
+}
+
+func (r *eventRecorder) enqueue(event c.EventType, data c.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := (enqueuer.Request{Event: event, Data: data}).Validate(); err != nil {
+		r.invalid = append(r.invalid, err)
+	}
+	r.events = append(r.events, capturedEvent{event: event, fields: c.Fields(data)})
+}
+
+func (r *eventRecorder) snapshot() []capturedEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]capturedEvent(nil), r.events...)
+}
+
+func newTestApp(t *testing.T, settings Settings, scenario string) (*scannerAppImpl, *devicesource.SimulatedSource, *eventRecorder) {
+	t.Helper()
+	return newTestAppWithClock(t, settings, scenario, systemClock{})
+}
+
+func newTestAppWithClock(t *testing.T, settings Settings, scenario string, clk clock) (*scannerAppImpl, *devicesource.SimulatedSource, *eventRecorder) {
+	t.Helper()
+
+	parsed, err := devicesource.ParseScenario([]byte(scenario))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := devicesource.NewSimulatedSource(parsed)
+	recorder := &eventRecorder{}
+	logf := func(string, ...interface{}) {}
+
+	app, err := newImplWithClock(source, settings, recorder.enqueue, logf, logf, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(app.Shutdown)
+	t.Cleanup(func() {
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		for _, err := range recorder.invalid {
+			t.Errorf("invalid event published: %v", err)
+		}
+	})
+	return app, source, recorder
+}
+
+func TestScannerApp_PublishesStartupAndChangeEvents(t *testing.T) {
+	_, source, recorder := newTestApp(t, Settings{}, `{
+	  "operatingSystemName": "Test OS",
+	  "render": {"pnpId": "speakers", "name": "Speakers", "renderVolume": 40},
+	  "capture": {"pnpId": "mic", "name": "Mic", "captureVolume": 70},
+	  "events": [
+	    {"after": "1ms", "action": "volume", "flow": "capture", "volume": 20},
+	    {"after": "1ms", "action": "plug", "flow": "render", "device": {"pnpId": "headset", "name": "Headset", "renderVolume": 30}}
+	  ]
+	}`)
+	<-source.Done()
+
+	events := recorder.snapshot()
+	want := []c.EventType{
+		c.EventTypeRenderDeviceConfirmed,
+		c.EventTypeCaptureDeviceConfirmed,
+		c.EventTypeCaptureVolumeChanged,
+		c.EventTypeRenderDeviceDiscovered,
+		c.EventTypeDefaultRenderChanged,
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), events)
+	}
+	for i, ev := range events {
+		if ev.event != want[i] {
+			t.Fatalf("event %d: expected %d, got %d", i, want[i], ev.event)
+		}
+	}
+
+	if events[0].fields[c.FieldOperationSystemName] != "Test OS" || events[0].fields[c.FieldPnpID] != "speakers" {
+		t.Fatalf("unexpected confirmed fields %v", events[0].fields)
+	}
+	if events[2].fields[c.FieldVolume] != "20" || events[2].fields[c.FieldPnpID] != "mic" {
+		t.Fatalf("unexpected volume fields %v", events[2].fields)
+	}
+	if events[3].fields[c.FieldName] != "Headset" {
+		t.Fatalf("unexpected discovered fields %v", events[3].fields)
+	}
+	if events[4].fields[c.FieldPnpID] != "headset" || events[4].fields[c.FieldPreviousPnpID] != "speakers" {
+		t.Fatalf("unexpected default changed fields %v", events[4].fields)
+	}
+}
+
+func TestScannerApp_PublishesDefaultChangedAcrossUnplug(t *testing.T) {
+	_, source, recorder := newTestApp(t, Settings{}, `{
+	  "render": {"pnpId": "speakers", "name": "Speakers"},
+	  "capture": {"pnpId": "mic", "name": "Mic"},
+	  "events": [
+	    {"after": "1ms", "action": "unplug", "flow": "capture"},
+	    {"after": "1ms", "action": "plug", "flow": "capture", "device": {"pnpId": "mic"}},
+	    {"after": "1ms", "action": "unplug", "flow": "capture"},
+	    {"after": "1ms", "action": "plug", "flow": "capture", "device": {"pnpId": "webcam-mic"}}
+	  ]
+	}`)
+	<-source.Done()
+
+	events := recorder.snapshot()
+	want := []c.EventType{
+		c.EventTypeRenderDeviceConfirmed,
+		c.EventTypeCaptureDeviceConfirmed,
+		c.EventTypeCaptureDeviceDetached,
+		c.EventTypeCaptureDeviceDiscovered,
+		c.EventTypeCaptureDeviceDetached,
+		c.EventTypeCaptureDeviceDiscovered,
+		c.EventTypeDefaultCaptureChanged,
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), events)
+	}
+	for i, ev := range events {
+		if ev.event != want[i] {
+			t.Fatalf("event %d: expected %d, got %d", i, want[i], ev.event)
+		}
+	}
+	if last := events[len(events)-1]; last.fields[c.FieldPnpID] != "webcam-mic" || last.fields[c.FieldPreviousPnpID] != "mic" {
+		t.Fatalf("unexpected default changed fields %v", last.fields)
+	}
+}
+
+func TestScannerApp_PublishesDetachedWithLastKnownPnpID(t *testing.T) {
+	_, source, recorder := newTestApp(t, Settings{}, `{
+	  "render": {"pnpId": "speakers", "name": "Speakers"},
+	  "capture": {"pnpId": "mic", "name": "Mic"},
+	  "events": [
+	    {"after": "1ms", "action": "unplug", "flow": "capture"},
+	    {"after": "1ms", "action": "unplug", "flow": "capture"}
+	  ]
+	}`)
+	<-source.Done()
+
+	events := recorder.snapshot()
+	if len(events) != 3 {
+		t.Fatalf("expected two confirmed and one detached event, got %+v", events)
+	}
+	detached := events[2]
+	if detached.event != c.EventTypeCaptureDeviceDetached || detached.fields[c.FieldPnpID] != "mic" {
+		t.Fatalf("unexpected detached event %+v", detached)
+	}
+}
+
+func TestScannerApp_ReportsAllEndpoints(t *testing.T) {
+	_, source, recorder := newTestApp(t, Settings{AllEndpoints: true}, `{
+	  "render": {"pnpId": "speakers", "name": "Speakers"},
+	  "capture": {"pnpId": "mic", "name": "Mic"},
+	  "endpoints": [{"flow": "render", "pnpId": "hdmi", "name": "HDMI"}],
+	  "events": [
+	    {"after": "1ms", "action": "add", "flow": "capture", "device": {"pnpId": "webcam-mic", "name": "Webcam Mic"}},
+	    {"after": "1ms", "action": "plug", "flow": "render", "device": {"pnpId": "headset", "name": "Headset"}},
+	    {"after": "1ms", "action": "remove", "flow": "render", "device": {"pnpId": "hdmi"}}
+	  ]
+	}`)
+	<-source.Done()
+
+	assertPublishedEndpoints(t, recorder.snapshot(), []publishedEndpoint{
+		{c.EventTypeRenderDeviceConfirmed, "speakers", "true"},
+		{c.EventTypeCaptureDeviceConfirmed, "mic", "true"},
+		{c.EventTypeRenderDeviceConfirmed, "hdmi", "false"},
+		{c.EventTypeCaptureDeviceDiscovered, "webcam-mic", "false"},
+		{c.EventTypeRenderDeviceDiscovered, "headset", "true"},
+		{c.EventTypeDefaultRenderChanged, "headset", ""},
+		{c.EventTypeRenderDeviceDiscovered, "speakers", "false"},
+		{c.EventTypeRenderDeviceDetached, "hdmi", "false"},
+	})
+}
+
+type publishedEndpoint struct {
+	event     c.EventType
+	pnpID     string
+	isDefault string
+}
+
+func assertPublishedEndpoints(t *testing.T, events []capturedEvent, want []publishedEndpoint) {
+	t.Helper()
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), events)
+	}
+	for i, ev := range events {
+		got := publishedEndpoint{ev.event, ev.fields[c.FieldPnpID], ev.fields[c.FieldIsDefault]}
+		if got != want[i] {
+			t.Fatalf("event %d: expected %+v, got %+v", i, want[i], got)
+		}
+	}
+}
+
+func TestScannerApp_DetachesAFormerDefaultEndpoint(t *testing.T) {
+	_, source, recorder := newTestApp(t, Settings{AllEndpoints: true}, `{
+	  "render": {"pnpId": "speakers", "name": "Speakers"},
+	  "capture": {"pnpId": "mic", "name": "Mic"},
+	  "events": [
+	    {"after": "1ms", "action": "plug", "flow": "render", "device": {"pnpId": "headset", "name": "Headset"}},
+	    {"after": "1ms", "action": "remove", "flow": "render", "device": {"pnpId": "speakers"}}
+	  ]
+	}`)
+	<-source.Done()
+
+	assertPublishedEndpoints(t, recorder.snapshot(), []publishedEndpoint{
+		{c.EventTypeRenderDeviceConfirmed, "speakers", "true"},
+		{c.EventTypeCaptureDeviceConfirmed, "mic", "true"},
+		{c.EventTypeRenderDeviceDiscovered, "headset", "true"},
+		{c.EventTypeDefaultRenderChanged, "headset", ""},
+		{c.EventTypeRenderDeviceDiscovered, "speakers", "false"},
+		{c.EventTypeRenderDeviceDetached, "speakers", "false"},
+	})
+}
+
+// lateEnumerationSource reports endpoint changes only when the test enumerates,
+// like a polling backend that sees several changes at once.
+type lateEnumerationSource struct {
+	*devicesource.SimulatedSource
+}
+
+func (lateEnumerationSource) SetEndpointsChangedHandler(func()) {}
+
+func TestScannerApp_DetachesAFormerDefaultRemovedBetweenEnumerations(t *testing.T) {
+	scenario, err := devicesource.ParseScenario([]byte(`{
+	  "render": {"pnpId": "headset", "name": "Headset"},
+	  "capture": {"pnpId": "mic", "name": "Mic"},
+	  "endpoints": [{"flow": "render", "pnpId": "speakers", "name": "Speakers"}],
+	  "events": [
+	    {"after": "1ms", "action": "plug", "flow": "render", "device": {"pnpId": "speakers", "name": "Speakers"}},
+	    {"after": "1ms", "action": "remove", "flow": "render", "device": {"pnpId": "headset"}}
+	  ]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulated := devicesource.NewSimulatedSource(scenario)
+	recorder := &eventRecorder{}
+	logf := func(string, ...interface{}) {}
+
+	app, err := newImplWithClock(lateEnumerationSource{simulated}, Settings{AllEndpoints: true}, recorder.enqueue, logf, logf, systemClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Shutdown()
+	<-simulated.Done()
+
+	// The headset was the default at the last enumeration, lost it and was removed before the next one.
+	app.syncEndpointsToApi()
+
+	assertPublishedEndpoints(t, recorder.snapshot(), []publishedEndpoint{
+		{c.EventTypeRenderDeviceConfirmed, "headset", "true"},
+		{c.EventTypeCaptureDeviceConfirmed, "mic", "true"},
+		{c.EventTypeRenderDeviceConfirmed, "speakers", "false"},
+		{c.EventTypeRenderDeviceDiscovered, "speakers", "true"},
+		{c.EventTypeDefaultRenderChanged, "speakers", ""},
+		{c.EventTypeRenderDeviceDetached, "headset", "false"},
+	})
+}
+
+func TestScannerApp_PublishesMuteState(t *testing.T) {
+	_, source, recorder := newTestApp(t, Settings{}, `{
+	  "render": {"pnpId": "speakers", "name": "Speakers"},
+	  "capture": {"pnpId": "mic", "name": "Mic", "captureVolume": 80, "captureMuted": true},
+	  "events": [
+	    {"after": "1ms", "action": "mute", "flow": "capture", "muted": false}
+	  ]
+	}`)
+	<-source.Done()
+
+	events := recorder.snapshot()
+	if len(events) != 3 {
+		t.Fatalf("expected two confirmed and one mute event, got %+v", events)
+	}
+	if _, ok := events[1].fields[c.FieldRenderMuted]; ok || events[1].fields[c.FieldCaptureMuted] != "true" {
+		t.Fatalf("expected only the capture mute state of a microphone, got %v", events[1].fields)
+	}
+	if events[2].event != c.EventTypeCaptureMuteChanged || events[2].fields[c.FieldMuted] != "false" || events[2].fields[c.FieldPnpID] != "mic" {
+		t.Fatalf("unexpected mute event %+v", events[2])
+	}
+}
+
+func TestScannerApp_SuppressesUnchangedState(t *testing.T) {
+	app, source, recorder := newTestApp(t, Settings{}, `{
+	  "render": {"pnpId": "speakers", "name": "Speakers", "renderVolume": 40},
+	  "capture": {"pnpId": "mic", "name": "Mic"},
+	  "events": [
+	    {"after": "1ms", "action": "volume", "flow": "render", "volume": 40},
+	    {"after": "1ms", "action": "plug", "flow": "render", "device": {"pnpId": "speakers", "name": "Speakers", "renderVolume": 40}},
+	    {"after": "1ms", "action": "volume", "flow": "render", "volume": 45},
+	    {"after": "1ms", "action": "volume", "flow": "render", "volume": 45}
+	  ]
+	}`)
+	<-source.Done()
+
+	events := recorder.snapshot()
+	want := []c.EventType{
+		c.EventTypeRenderDeviceConfirmed,
+		c.EventTypeCaptureDeviceConfirmed,
+		c.EventTypeRenderVolumeChanged,
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), events)
+	}
+	for i, ev := range events {
+		if ev.event != want[i] {
+			t.Fatalf("event %d: expected %d, got %d", i, want[i], ev.event)
+		}
+	}
+	if events[2].fields[c.FieldVolume] != "45" {
+		t.Fatalf("unexpected volume event %+v", events[2])
+	}
+	if app.SuppressedDuplicates() != 3 {
+		t.Fatalf("expected 3 suppressed duplicates, got %d", app.SuppressedDuplicates())
+	}
+
+	// Startup confirmations are published even when nothing changed.
+	app.RepostRenderDeviceToApi(c.EventTypeRenderDeviceConfirmed)
+	if got := recorder.snapshot(); len(got) != 4 || got[3].event != c.EventTypeRenderDeviceConfirmed {
+		t.Fatalf("expected the confirmation to be published, got %+v", got)
+	}
+}
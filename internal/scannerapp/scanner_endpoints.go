@@ -0,0 +1,136 @@
+package scannerapp
+
+import (
+	"sort"
+
+	c "github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/devicesource"
+)
+
+// knownEndpoint is an active endpoint as seen at the last enumeration.
+type knownEndpoint struct {
+	desc      devicesource.Description
+	isDefault bool
+}
+
+// endpointEvents returns the confirmed, discovered and detached events for the endpoint's flow.
+func endpointEvents(desc devicesource.Description) (c.EventType, c.EventType, c.EventType) {
+	if desc.IsCapture && !desc.IsRender {
+		return c.EventTypeCaptureDeviceConfirmed, c.EventTypeCaptureDeviceDiscovered, c.EventTypeCaptureDeviceDetached
+	}
+	return c.EventTypeRenderDeviceConfirmed, c.EventTypeRenderDeviceDiscovered, c.EventTypeRenderDeviceDetached
+}
+
+// postAllEndpointsToApi confirms every active non-default endpoint at startup.
+// The default devices are already confirmed by RepostRenderDeviceToApi/RepostCaptureDeviceToApi.
+func (app *scannerAppImpl) postAllEndpointsToApi() {
+	active, err := app.enumerator.ActiveEndpoints()
+	if err != nil {
+		app.logError("Endpoints can not be enumerated: %v", err)
+		return
+	}
+
+	known := app.classifyEndpoints(active)
+
+	app.mu.Lock()
+	app.knownEndpoints = known
+	app.mu.Unlock()
+
+	for _, ep := range sortedEndpoints(known) {
+		if ep.isDefault {
+			continue
+		}
+		confirmed, _, _ := endpointEvents(ep.desc)
+		app.postEndpointToApi(confirmed, ep.desc)
+	}
+	app.logInfo("Endpoints enumerated: %d active", len(known))
+}
+
+// syncEndpointsToApi compares the active endpoints with the last enumeration and publishes
+// discovered/detached events for non-default endpoints. Default devices are reported by their own handlers,
+// an endpoint whose default flag changed since the last enumeration is published again with the new flag.
+func (app *scannerAppImpl) syncEndpointsToApi() {
+	active, err := app.enumerator.ActiveEndpoints()
+	if err != nil {
+		app.logError("Endpoints can not be enumerated: %v", err)
+		return
+	}
+
+	current := app.classifyEndpoints(active)
+
+	app.mu.Lock()
+	var added, changed, removed []knownEndpoint
+	for id, ep := range current {
+		previous, ok := app.knownEndpoints[id]
+		switch {
+		case !ok && !ep.isDefault:
+			added = append(added, ep)
+		case ok && previous.isDefault != ep.isDefault:
+			changed = append(changed, ep)
+		}
+	}
+	for id, ep := range app.knownEndpoints {
+		// A gone endpoint that is still the default is detached by removeDeviceFromApi.
+		if _, ok := current[id]; !ok && !app.isDefaultLocked(id) {
+			removed = append(removed, ep)
+		}
+	}
+	app.knownEndpoints = current
+	app.mu.Unlock()
+
+	sortEndpoints(added)
+	sortEndpoints(changed)
+	sortEndpoints(removed)
+	for _, ep := range added {
+		_, discovered, _ := endpointEvents(ep.desc)
+		app.postEndpointToApi(discovered, ep.desc)
+		app.logInfo("Endpoint added: name=%q pnpId=%q", ep.desc.Name, ep.desc.PnpID)
+	}
+	for _, ep := range changed {
+		// The default handlers may have published the same flag already, the state cache suppresses the repeat.
+		_, discovered, _ := endpointEvents(ep.desc)
+		app.postDeviceToApi(discovered, ep.desc, ep.isDefault)
+		app.logInfo("Endpoint default flag changed: name=%q pnpId=%q isDefault=%t", ep.desc.Name, ep.desc.PnpID, ep.isDefault)
+	}
+	for _, ep := range removed {
+		_, _, detached := endpointEvents(ep.desc)
+		app.putDetachedToApi(detached, ep.desc.PnpID, false)
+		app.logInfo("Endpoint removed: name=%q pnpId=%q", ep.desc.Name, ep.desc.PnpID)
+	}
+}
+
+func (app *scannerAppImpl) postEndpointToApi(event c.EventType, desc devicesource.Description) {
+	app.postDeviceToApi(event, desc, false)
+}
+
+// classifyEndpoints marks the endpoints that are the current default render or capture device.
+func (app *scannerAppImpl) classifyEndpoints(active []devicesource.Description) map[string]knownEndpoint {
+	app.mu.Lock()
+	renderPnpID, capturePnpID := app.renderDefault.current, app.captureDefault.current
+	app.mu.Unlock()
+
+	known := make(map[string]knownEndpoint, len(active))
+	for _, desc := range active {
+		isDefault := desc.PnpID != "" && (desc.PnpID == renderPnpID || desc.PnpID == capturePnpID)
+		known[desc.PnpID] = knownEndpoint{desc: desc, isDefault: isDefault}
+	}
+	return known
+}
+
+// isDefaultLocked reports whether pnpID is the current default render or capture device.
+func (app *scannerAppImpl) isDefaultLocked(pnpID string) bool {
+	return pnpID != "" && (pnpID == app.renderDefault.current || pnpID == app.captureDefault.current)
+}
+
+func sortedEndpoints(known map[string]knownEndpoint) []knownEndpoint {
+	endpoints := make([]knownEndpoint, 0, len(known))
+	for _, ep := range known {
+		endpoints = append(endpoints, ep)
+	}
+	sortEndpoints(endpoints)
+	return endpoints
+}
+
+func sortEndpoints(endpoints []knownEndpoint) {
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].desc.PnpID < endpoints[j].desc.PnpID })
+}
@@ -0,0 +1,103 @@
+package scannerapp
+
+import (
+	"errors"
+
+	c "github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/devicesource"
+)
+
+// Resync re-reads the default devices (and endpoints, when enumerated) and re-posts Confirmed events
+// for devices that drifted from the last published state. A forced resync re-posts every device,
+// e.g. after the publisher reconnected and the broker may have lost messages.
+func (app *scannerAppImpl) Resync(force bool) {
+	app.resyncFlow(c.FlowTypeRender, force)
+	app.resyncFlow(c.FlowTypeCapture, force)
+
+	if app.enumerator != nil {
+		app.syncEndpointsToApi()
+		app.confirmEndpointsToApi(force)
+	}
+	app.logInfo("Devices resynchronized (force=%t)", force)
+}
+
+// ForgetPublishedState forgets what was published, so the next resync confirms every device.
+// It is called when events were dropped on the way and the repository may not have seen the last state.
+func (app *scannerAppImpl) ForgetPublishedState() {
+	app.published.forgetAll()
+}
+
+func (app *scannerAppImpl) resyncFlow(flow c.FlowType, force bool) {
+	read, confirmed, detached := app.source.DefaultRender, c.EventTypeRenderDeviceConfirmed, c.EventTypeRenderDeviceDetached
+	if flow == c.FlowTypeCapture {
+		read, confirmed, detached = app.source.DefaultCapture, c.EventTypeCaptureDeviceConfirmed, c.EventTypeCaptureDeviceDetached
+	}
+
+	app.flushVolume(flow)
+	desc, err := read()
+	if err != nil {
+		if errors.Is(err, devicesource.ErrNoDevice) {
+			// A missed removal; reported only if a default device is still known.
+			app.removeDeviceFromApi(detached, flow)
+		} else {
+			app.logError("Resync can not read the default device (flow=%d): %v", flow, err)
+		}
+		return
+	}
+
+	previous := app.rememberPnpID(flow, desc.PnpID)
+	app.confirmDeviceToApi(confirmed, desc, true, force)
+	if previous != "" {
+		app.putDefaultChangedToApi(flow, previous, desc.PnpID)
+	}
+}
+
+// confirmEndpointsToApi re-posts the non-default endpoints of the last enumeration.
+func (app *scannerAppImpl) confirmEndpointsToApi(force bool) {
+	app.mu.Lock()
+	known := sortedEndpoints(app.knownEndpoints)
+	app.mu.Unlock()
+
+	for _, ep := range known {
+		if ep.isDefault {
+			continue
+		}
+		confirmed, _, _ := endpointEvents(ep.desc)
+		app.confirmDeviceToApi(confirmed, ep.desc, false, force)
+	}
+}
+
+// confirmDeviceToApi posts a Confirmed event if forced or if the device drifted from its published state.
+func (app *scannerAppImpl) confirmDeviceToApi(event c.EventType, desc devicesource.Description, isDefault, force bool) {
+	snapshot := app.deviceSnapshot(desc, isDefault)
+	if changed := app.published.reconcile(desc.PnpID, c.Fields(snapshot)); !changed && !force {
+		return
+	}
+	if !force {
+		app.logInfo("Device drifted, confirming again: name=%q pnpId=%q", desc.Name, desc.PnpID)
+	}
+	app.enqueueFunc(event, snapshot)
+}
+
+func (app *scannerAppImpl) scheduleResync() {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	if app.stopped {
+		return
+	}
+	app.resyncTimer = app.clock.AfterFunc(app.settings.ResyncInterval, func() {
+		app.Resync(false)
+		app.scheduleResync()
+	})
+}
+
+func (app *scannerAppImpl) stopResync() {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	app.stopped = true
+	if app.resyncTimer != nil {
+		app.resyncTimer.Stop()
+	}
+}
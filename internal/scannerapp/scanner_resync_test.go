@@ -0,0 +1,137 @@
+package scannerapp
+
+import (
+	"testing"
+	"time"
+
+	c "github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/devicesource"
+)
+
+// deafSource misses every render volume notification, like a paused service would.
+type deafSource struct {
+	*devicesource.SimulatedSource
+}
+
+func (deafSource) SetRenderVolumeChangedHandler(func()) {}
+
+func TestScannerApp_ResyncConfirmsDriftedDevices(t *testing.T) {
+	scenario, err := devicesource.ParseScenario([]byte(`{
+	  "render": {"pnpId": "speakers", "name": "Speakers", "renderVolume": 40},
+	  "capture": {"pnpId": "mic", "name": "Mic"},
+	  "events": [
+	    {"after": "1ms", "action": "volume", "flow": "render", "volume": 55}
+	  ]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulated := devicesource.NewSimulatedSource(scenario)
+	recorder := &eventRecorder{}
+	clk := newFakeClock()
+	logf := func(string, ...interface{}) {}
+
+	app, err := newImplWithClock(deafSource{simulated}, Settings{ResyncInterval: time.Minute}, recorder.enqueue, logf, logf, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Shutdown()
+	<-simulated.Done()
+
+	if got := recorder.snapshot(); len(got) != 2 {
+		t.Fatalf("expected only the startup confirmations, got %+v", got)
+	}
+
+	clk.Advance(time.Minute)
+	events := recorder.snapshot()
+	if len(events) != 3 {
+		t.Fatalf("expected one drift confirmation, got %+v", events)
+	}
+	if events[2].event != c.EventTypeRenderDeviceConfirmed || events[2].fields[c.FieldRenderVolume] != "55" {
+		t.Fatalf("unexpected drift confirmation %+v", events[2])
+	}
+
+	// Nothing drifted since, so the next periodic resync is silent.
+	clk.Advance(time.Minute)
+	if got := recorder.snapshot(); len(got) != 3 {
+		t.Fatalf("expected no events without drift, got %+v", got[3:])
+	}
+
+	app.Resync(true)
+	if got := recorder.snapshot(); len(got) != 5 || got[3].event != c.EventTypeRenderDeviceConfirmed || got[4].event != c.EventTypeCaptureDeviceConfirmed {
+		t.Fatalf("expected a forced resync to confirm both devices, got %+v", got)
+	}
+	if app.SuppressedDuplicates() != 0 {
+		t.Fatalf("resync checks must not count as duplicates, got %d", app.SuppressedDuplicates())
+	}
+}
+
+func TestScannerApp_ResyncConfirmsEveryDeviceAfterDrops(t *testing.T) {
+	scenario, err := devicesource.ParseScenario([]byte(`{
+	  "render": {"pnpId": "speakers", "name": "Speakers", "renderVolume": 40},
+	  "capture": {"pnpId": "mic", "name": "Mic"}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulated := devicesource.NewSimulatedSource(scenario)
+	recorder := &eventRecorder{}
+	clk := newFakeClock()
+	logf := func(string, ...interface{}) {}
+
+	app, err := newImplWithClock(simulated, Settings{ResyncInterval: time.Minute}, recorder.enqueue, logf, logf, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Shutdown()
+	<-simulated.Done()
+
+	clk.Advance(time.Minute)
+	if got := recorder.snapshot(); len(got) != 2 {
+		t.Fatalf("expected no drift before the drop, got %+v", got)
+	}
+
+	// An event was dropped on the way, so the repository may be behind even without drift.
+	app.ForgetPublishedState()
+	clk.Advance(time.Minute)
+	if got := recorder.snapshot(); len(got) != 4 || got[2].event != c.EventTypeRenderDeviceConfirmed || got[3].event != c.EventTypeCaptureDeviceConfirmed {
+		t.Fatalf("expected the resync to confirm both devices, got %+v", got)
+	}
+}
+
+func TestScannerApp_HeadsetMuteStateDoesNotDrift(t *testing.T) {
+	scenario, err := devicesource.ParseScenario([]byte(`{
+	  "render": {"pnpId": "headset", "name": "Headset"},
+	  "capture": {"pnpId": "headset", "name": "Headset", "captureMuted": true}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulated := devicesource.NewSimulatedSource(scenario)
+	recorder := &eventRecorder{}
+	clk := newFakeClock()
+	logf := func(string, ...interface{}) {}
+
+	app, err := newImplWithClock(simulated, Settings{ResyncInterval: time.Minute}, recorder.enqueue, logf, logf, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Shutdown()
+	<-simulated.Done()
+
+	// Default in both flows, so both confirmations carry the mute state of both.
+	events := recorder.snapshot()
+	if len(events) != 2 {
+		t.Fatalf("expected the startup confirmations, got %+v", events)
+	}
+	for _, ev := range events {
+		if ev.fields[c.FieldRenderMuted] != "false" || ev.fields[c.FieldCaptureMuted] != "true" {
+			t.Fatalf("unexpected mute state %v", ev.fields)
+		}
+	}
+
+	clk.Advance(time.Minute)
+	if got := recorder.snapshot(); len(got) != 2 {
+		t.Fatalf("expected no drift, got %+v", got[2:])
+	}
+}
@@ -0,0 +1,97 @@
+package scannerapp
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultVolumeQuietPeriod = 250 * time.Millisecond
+	defaultVolumeMaxLatency  = 1 * time.Second
+	defaultResyncInterval    = 5 * time.Minute
+)
+
+// Settings tune what the scanner reports.
+type Settings struct {
+	// AllEndpoints reports every active endpoint, not only the default render and capture devices.
+	AllEndpoints bool
+
+	// VolumeQuietPeriod coalesces volume changes of a device until it has been quiet this long; zero disables it.
+	VolumeQuietPeriod time.Duration
+	// VolumeMaxLatency bounds how long a coalesced volume change may be held back while changes keep coming.
+	VolumeMaxLatency time.Duration
+	// VolumeReportRange adds the minimum and maximum volume seen while coalescing.
+	VolumeReportRange bool
+
+	// ResyncInterval re-reads the devices periodically and confirms drifted ones again; zero disables it.
+	ResyncInterval time.Duration
+}
+
+// LoadSettingsFromEnv loads scanner settings from environment variables.
+func LoadSettingsFromEnv() (Settings, error) {
+	settings := Settings{
+		VolumeQuietPeriod: defaultVolumeQuietPeriod,
+		VolumeMaxLatency:  defaultVolumeMaxLatency,
+		ResyncInterval:    defaultResyncInterval,
+	}
+
+	switch v := strings.ToLower(strings.TrimSpace(os.Getenv(EnvWinSoundEndpoints))); v {
+	case "", "default":
+	case "all":
+		settings.AllEndpoints = true
+	default:
+		return Settings{}, fmt.Errorf("unsupported %s=%q (supported: default, all)", EnvWinSoundEndpoints, v)
+	}
+
+	if v := strings.TrimSpace(os.Getenv(EnvWinSoundVolumeQuietPeriod)); v != "" {
+		d, err := parseMilliseconds(EnvWinSoundVolumeQuietPeriod, v)
+		if err != nil {
+			return Settings{}, err
+		}
+		settings.VolumeQuietPeriod = d
+	}
+	if v := strings.TrimSpace(os.Getenv(EnvWinSoundVolumeMaxLatency)); v != "" {
+		d, err := parseMilliseconds(EnvWinSoundVolumeMaxLatency, v)
+		if err != nil {
+			return Settings{}, err
+		}
+		settings.VolumeMaxLatency = d
+	}
+	switch v := strings.ToLower(strings.TrimSpace(os.Getenv(EnvWinSoundVolumeRange))); v {
+	case "", "off", "false", "0":
+	case "on", "true", "1":
+		settings.VolumeReportRange = true
+	default:
+		return Settings{}, fmt.Errorf("unsupported %s=%q (supported: on, off)", EnvWinSoundVolumeRange, v)
+	}
+
+	if v := strings.TrimSpace(os.Getenv(EnvWinSoundResyncInterval)); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return Settings{}, fmt.Errorf("invalid %s %q: %w", EnvWinSoundResyncInterval, v, err)
+		}
+		if n < 0 {
+			return Settings{}, fmt.Errorf("%s can not be negative %q", EnvWinSoundResyncInterval, v)
+		}
+		settings.ResyncInterval = time.Duration(n) * time.Second
+	}
+
+	if settings.VolumeMaxLatency < settings.VolumeQuietPeriod {
+		settings.VolumeMaxLatency = settings.VolumeQuietPeriod
+	}
+	return settings, nil
+}
+
+func parseMilliseconds(key, value string) (time.Duration, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("%s can not be negative %q", key, value)
+	}
+	return time.Duration(n) * time.Millisecond, nil
+}
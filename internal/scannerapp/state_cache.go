@@ -0,0 +1,88 @@
+package scannerapp
+
+import (
+	"sync"
+
+	c "github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+)
+
+// stateCache remembers the last published state of every device, keyed by PnP ID,
+// so that events which would not change anything on the repository are not published again.
+type stateCache struct {
+	mu         sync.Mutex
+	devices    map[string]map[string]string
+	suppressed uint64
+}
+
+func newStateCache() *stateCache {
+	return &stateCache{devices: make(map[string]map[string]string)}
+}
+
+// update merges fields into the device state and reports whether any of them changed.
+// An unchanged update counts as a suppressed duplicate.
+func (sc *stateCache) update(pnpID string, fields map[string]string) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.mergeLocked(pnpID, fields) {
+		return true
+	}
+	sc.suppressed++
+	return false
+}
+
+// reconcile merges fields into the device state and reports whether any of them changed,
+// without counting an unchanged state as a duplicate.
+func (sc *stateCache) reconcile(pnpID string, fields map[string]string) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.mergeLocked(pnpID, fields)
+}
+
+// record merges fields into the device state regardless of what was published before.
+func (sc *stateCache) record(pnpID string, fields map[string]string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.mergeLocked(pnpID, fields)
+}
+
+// forget drops the device, so the next event for it is published whatever it contains.
+func (sc *stateCache) forget(pnpID string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	delete(sc.devices, pnpID)
+}
+
+// forgetAll drops every device, e.g. after events were lost on the way to the repository.
+func (sc *stateCache) forgetAll() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	clear(sc.devices)
+}
+
+// Suppressed reports the number of duplicate events not published.
+func (sc *stateCache) Suppressed() uint64 {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.suppressed
+}
+
+func (sc *stateCache) mergeLocked(pnpID string, fields map[string]string) bool {
+	state, ok := sc.devices[pnpID]
+	if !ok {
+		state = make(map[string]string, len(fields))
+		sc.devices[pnpID] = state
+	}
+
+	changed := !ok
+	for key, value := range fields {
+		if key == c.FieldUpdateDate {
+			continue
+		}
+		if previous, seen := state[key]; !seen || previous != value {
+			state[key] = value
+			changed = true
+		}
+	}
+	return changed
+}
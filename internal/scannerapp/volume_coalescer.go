@@ -0,0 +1,132 @@
+package scannerapp
+
+import (
+	"sync"
+	"time"
+
+	c "github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+)
+
+// clock is the time source of the volume coalescer; tests replace it with a fake they advance by hand.
+type clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) timer
+}
+
+type timer interface {
+	Stop() bool
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) AfterFunc(d time.Duration, f func()) timer { return time.AfterFunc(d, f) }
+
+type volumeKey struct {
+	flow  c.FlowType
+	pnpID string
+}
+
+// settledVolume is the last volume of a burst of changes, with the range seen during the burst.
+type settledVolume struct {
+	key      volumeKey
+	volume   int
+	min, max int
+	changes  int
+}
+
+type volumeWindow struct {
+	settledVolume
+	first time.Time
+	timer timer
+	// generation counts the timers armed for the window; only the latest one may emit it.
+	generation uint64
+}
+
+// volumeCoalescer collapses bursts of volume changes per device and flow, e.g. while a slider is dragged,
+// into the settled value. A burst ends after quietPeriod without changes, or maxLatency after it began.
+type volumeCoalescer struct {
+	quietPeriod time.Duration
+	maxLatency  time.Duration
+	clock       clock
+	emit        func(settledVolume)
+
+	mu      sync.Mutex
+	windows map[volumeKey]*volumeWindow
+}
+
+func newVolumeCoalescer(quietPeriod, maxLatency time.Duration, clk clock, emit func(settledVolume)) *volumeCoalescer {
+	if maxLatency < quietPeriod {
+		maxLatency = quietPeriod
+	}
+	return &volumeCoalescer{
+		quietPeriod: quietPeriod,
+		maxLatency:  maxLatency,
+		clock:       clk,
+		emit:        emit,
+		windows:     make(map[volumeKey]*volumeWindow),
+	}
+}
+
+// Observe records a volume change and (re)arms the timer that emits the settled value.
+func (co *volumeCoalescer) Observe(flow c.FlowType, pnpID string, volume int) {
+	key := volumeKey{flow: flow, pnpID: pnpID}
+	now := co.clock.Now()
+
+	co.mu.Lock()
+	defer co.mu.Unlock()
+
+	w, ok := co.windows[key]
+	if !ok {
+		w = &volumeWindow{settledVolume: settledVolume{key: key, min: volume, max: volume}, first: now}
+		co.windows[key] = w
+	} else {
+		w.timer.Stop()
+	}
+	w.volume = volume
+	w.min = min(w.min, volume)
+	w.max = max(w.max, volume)
+	w.changes++
+	w.generation++
+	generation := w.generation
+
+	wait := co.quietPeriod
+	if deadline := w.first.Add(co.maxLatency); now.Add(wait).After(deadline) {
+		wait = deadline.Sub(now)
+	}
+	// A stopped timer may have fired already and wait for co.mu, the generation makes it a no-op.
+	w.timer = co.clock.AfterFunc(wait, func() { co.fire(key, w, generation) })
+}
+
+// Flush emits the pending volume of flow right away, so it is not reported after a later device event.
+func (co *volumeCoalescer) Flush(flow c.FlowType) {
+	co.mu.Lock()
+	var settled []settledVolume
+	for key, w := range co.windows {
+		if key.flow == flow {
+			w.timer.Stop()
+			delete(co.windows, key)
+			settled = append(settled, w.settledVolume)
+		}
+	}
+	co.mu.Unlock()
+
+	for _, s := range settled {
+		co.emit(s)
+	}
+}
+
+func (co *volumeCoalescer) fire(key volumeKey, w *volumeWindow, generation uint64) {
+	co.mu.Lock()
+	if co.windows[key] != w || w.generation != generation {
+		// Flushed, superseded by a newer window, or rearmed by a later change meanwhile.
+		co.mu.Unlock()
+		return
+	}
+	delete(co.windows, key)
+	settled := w.settledVolume
+	co.mu.Unlock()
+
+	co.emit(settled)
+}
@@ -0,0 +1,232 @@
+package scannerapp
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	c "github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+)
+
+// fakeClock runs timer callbacks synchronously from Advance, in deadline order.
+// While held, due callbacks are kept back until runHeld, like a timer that fired but waits for a lock.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+	hold   bool
+	held   []func()
+}
+
+type fakeTimer struct {
+	clock    *fakeClock
+	deadline time.Time
+	f        func()
+	stopped  bool
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)}
+}
+
+func (fc *fakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.now
+}
+
+func (fc *fakeClock) AfterFunc(d time.Duration, f func()) timer {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	t := &fakeTimer{clock: fc, deadline: fc.now.Add(d), f: f}
+	fc.timers = append(fc.timers, t)
+	return t
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	wasActive := !t.stopped
+	t.stopped = true
+	return wasActive
+}
+
+func (fc *fakeClock) Advance(d time.Duration) {
+	fc.mu.Lock()
+	end := fc.now.Add(d)
+	fc.mu.Unlock()
+
+	for {
+		fc.mu.Lock()
+		sort.Slice(fc.timers, func(i, j int) bool { return fc.timers[i].deadline.Before(fc.timers[j].deadline) })
+		var due *fakeTimer
+		for len(fc.timers) > 0 {
+			next := fc.timers[0]
+			if next.stopped {
+				fc.timers = fc.timers[1:]
+				continue
+			}
+			if next.deadline.After(end) {
+				break
+			}
+			fc.timers = fc.timers[1:]
+			next.stopped = true
+			fc.now = next.deadline
+			due = next
+			break
+		}
+		if due == nil {
+			fc.now = end
+			fc.mu.Unlock()
+			return
+		}
+		if fc.hold {
+			fc.held = append(fc.held, due.f)
+			fc.mu.Unlock()
+			continue
+		}
+		fc.mu.Unlock()
+		due.f()
+	}
+}
+
+func (fc *fakeClock) holdCallbacks() {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.hold = true
+}
+
+// runHeld stops holding callbacks and runs the ones kept back.
+func (fc *fakeClock) runHeld() {
+	fc.mu.Lock()
+	held := fc.held
+	fc.hold, fc.held = false, nil
+	fc.mu.Unlock()
+
+	for _, f := range held {
+		f()
+	}
+}
+
+func newTestCoalescer(clk clock) (*volumeCoalescer, *[]settledVolume) {
+	var emitted []settledVolume
+	co := newVolumeCoalescer(100*time.Millisecond, 500*time.Millisecond, clk, func(v settledVolume) {
+		emitted = append(emitted, v)
+	})
+	return co, &emitted
+}
+
+func TestVolumeCoalescer_EmitsSettledValueAfterQuietPeriod(t *testing.T) {
+	clk := newFakeClock()
+	co, emitted := newTestCoalescer(clk)
+
+	for _, v := range []int{40, 55, 20, 35} {
+		co.Observe(c.FlowTypeRender, "speakers", v)
+		clk.Advance(30 * time.Millisecond)
+	}
+	if len(*emitted) != 0 {
+		t.Fatalf("expected nothing before the quiet period, got %+v", *emitted)
+	}
+
+	clk.Advance(100 * time.Millisecond)
+	if len(*emitted) != 1 {
+		t.Fatalf("expected one settled volume, got %+v", *emitted)
+	}
+	got := (*emitted)[0]
+	if got.volume != 35 || got.min != 20 || got.max != 55 || got.changes != 4 {
+		t.Fatalf("unexpected settled volume %+v", got)
+	}
+}
+
+func TestVolumeCoalescer_MaxLatencyBoundsAContinuousDrag(t *testing.T) {
+	clk := newFakeClock()
+	co, emitted := newTestCoalescer(clk)
+
+	for i := 0; i < 30; i++ {
+		co.Observe(c.FlowTypeCapture, "mic", i)
+		clk.Advance(50 * time.Millisecond)
+	}
+
+	// 1.5s of changes every 50ms: never quiet, so the max latency emits every 500ms.
+	if len(*emitted) != 3 {
+		t.Fatalf("expected 3 emissions bounded by max latency, got %+v", *emitted)
+	}
+	if (*emitted)[0].volume != 9 {
+		t.Fatalf("unexpected first emission %+v", (*emitted)[0])
+	}
+}
+
+func TestVolumeCoalescer_IgnoresATimerThatFiredWhileAChangeRearmedIt(t *testing.T) {
+	clk := newFakeClock()
+	co, emitted := newTestCoalescer(clk)
+
+	co.Observe(c.FlowTypeRender, "speakers", 40)
+	clk.holdCallbacks()
+	clk.Advance(100 * time.Millisecond)
+
+	// The timer fired already, so stopping it fails; its callback runs only after the change is recorded.
+	co.Observe(c.FlowTypeRender, "speakers", 55)
+	clk.runHeld()
+	if len(*emitted) != 0 {
+		t.Fatalf("expected the rearmed window to stay open, got %+v", *emitted)
+	}
+
+	clk.Advance(100 * time.Millisecond)
+	if len(*emitted) != 1 {
+		t.Fatalf("expected one settled volume, got %+v", *emitted)
+	}
+	if got := (*emitted)[0]; got.volume != 55 || got.min != 40 || got.max != 55 || got.changes != 2 {
+		t.Fatalf("unexpected settled volume %+v", got)
+	}
+}
+
+func TestVolumeCoalescer_KeepsDevicesAndFlowsApart(t *testing.T) {
+	clk := newFakeClock()
+	co, emitted := newTestCoalescer(clk)
+
+	co.Observe(c.FlowTypeRender, "speakers", 10)
+	co.Observe(c.FlowTypeRender, "headset", 20)
+	co.Observe(c.FlowTypeCapture, "headset", 30)
+	co.Flush(c.FlowTypeCapture)
+
+	if len(*emitted) != 1 || (*emitted)[0].key != (volumeKey{c.FlowTypeCapture, "headset"}) {
+		t.Fatalf("expected only the capture volume to be flushed, got %+v", *emitted)
+	}
+
+	clk.Advance(time.Second)
+	if len(*emitted) != 3 {
+		t.Fatalf("expected the render volumes after the quiet period, got %+v", *emitted)
+	}
+}
+
+func TestScannerApp_CoalescesVolumeChanges(t *testing.T) {
+	parsed := `{
+	  "render": {"pnpId": "speakers", "name": "Speakers", "renderVolume": 40},
+	  "capture": {"pnpId": "mic", "name": "Mic"},
+	  "events": [
+	    {"after": "1ms", "action": "volume", "flow": "render", "volume": 50},
+	    {"after": "1ms", "action": "volume", "flow": "render", "volume": 60},
+	    {"after": "1ms", "action": "volume", "flow": "render", "volume": 45},
+	    {"after": "1ms", "action": "unplug", "flow": "render"}
+	  ]
+	}`
+	clk := newFakeClock()
+	settings := Settings{VolumeQuietPeriod: time.Second, VolumeMaxLatency: time.Minute, VolumeReportRange: true}
+	_, source, recorder := newTestAppWithClock(t, settings, parsed, clk)
+	<-source.Done()
+
+	// The unplug flushes the pending volume first, so it is not published after the detached event.
+	events := recorder.snapshot()
+	if len(events) != 4 {
+		t.Fatalf("expected confirmed x2, one volume and detached, got %+v", events)
+	}
+	volume := events[2]
+	if volume.event != c.EventTypeRenderVolumeChanged || volume.fields[c.FieldVolume] != "45" ||
+		volume.fields[c.FieldVolumeMin] != "45" || volume.fields[c.FieldVolumeMax] != "60" {
+		t.Fatalf("unexpected volume event %+v", volume)
+	}
+	if events[3].event != c.EventTypeRenderDeviceDetached {
+		t.Fatalf("expected detached last, got %+v", events[3])
+	}
+}
@@ -3,6 +3,16 @@ package scannerapp
 const (
 	EnvWinSoundEnqueuer = "WIN_SOUND_ENQUEUER"
 
+	EnvWinSoundSource            = "WIN_SOUND_SOURCE"
+	EnvWinSoundSimulatedScenario = "WIN_SOUND_SIMULATED_SCENARIO"
+	EnvWinSoundEndpoints         = "WIN_SOUND_ENDPOINTS"
+
+	EnvWinSoundVolumeQuietPeriod = "WIN_SOUND_VOLUME_QUIET_MS"
+	EnvWinSoundVolumeMaxLatency  = "WIN_SOUND_VOLUME_MAX_LATENCY_MS"
+	EnvWinSoundVolumeRange       = "WIN_SOUND_VOLUME_RANGE"
+	EnvWinSoundResyncInterval    = "WIN_SOUND_RESYNC_INTERVAL_SEC"
+
+	EnvWinSoundRabbitMQURL        = "WIN_SOUND_RABBITMQ_URL"
 	EnvWinSoundRabbitMQHost       = "WIN_SOUND_RABBITMQ_HOST"
 	EnvWinSoundRabbitMQPort       = "WIN_SOUND_RABBITMQ_PORT"
 	EnvWinSoundRabbitMQVHost      = "WIN_SOUND_RABBITMQ_VHOST"
@@ -12,9 +22,51 @@ const (
 	EnvWinSoundRabbitMQQueue      = "WIN_SOUND_RABBITMQ_QUEUE"
 	EnvWinSoundRabbitMQRoutingKey = "WIN_SOUND_RABBITMQ_ROUTING_KEY"
 
+	EnvWinSoundRabbitMQRoutingKeyTemplate   = "WIN_SOUND_RABBITMQ_ROUTING_KEY_TEMPLATE"
+	EnvWinSoundRabbitMQBodyFormat           = "WIN_SOUND_RABBITMQ_BODY_FORMAT"
+	EnvWinSoundRabbitMQTopology             = "WIN_SOUND_RABBITMQ_TOPOLOGY"
+	EnvWinSoundRabbitMQExchangeType         = "WIN_SOUND_RABBITMQ_EXCHANGE_TYPE"
+	EnvWinSoundRabbitMQQueueType            = "WIN_SOUND_RABBITMQ_QUEUE_TYPE"
+	EnvWinSoundRabbitMQMessageTTL           = "WIN_SOUND_RABBITMQ_MESSAGE_TTL_MS"
+	EnvWinSoundRabbitMQQueueMaxLength       = "WIN_SOUND_RABBITMQ_QUEUE_MAX_LENGTH"
+	EnvWinSoundRabbitMQQueueOverflow        = "WIN_SOUND_RABBITMQ_QUEUE_OVERFLOW"
+	EnvWinSoundRabbitMQDeadLetterExchange   = "WIN_SOUND_RABBITMQ_DLX"
+	EnvWinSoundRabbitMQDeadLetterRoutingKey = "WIN_SOUND_RABBITMQ_DLX_ROUTING_KEY"
+	EnvWinSoundRabbitMQAlternateExchange    = "WIN_SOUND_RABBITMQ_ALTERNATE_EXCHANGE"
+
+	EnvWinSoundRabbitMQHosts          = "WIN_SOUND_RABBITMQ_HOSTS"
+	EnvWinSoundRabbitMQHostSelection  = "WIN_SOUND_RABBITMQ_HOST_SELECTION"
+	EnvWinSoundRabbitMQHostQuarantine = "WIN_SOUND_RABBITMQ_HOST_QUARANTINE_SEC"
+
+	EnvWinSoundRabbitMQTLS                   = "WIN_SOUND_RABBITMQ_TLS"
+	EnvWinSoundRabbitMQTLSCAFile             = "WIN_SOUND_RABBITMQ_TLS_CA_FILE"
+	EnvWinSoundRabbitMQTLSCertFile           = "WIN_SOUND_RABBITMQ_TLS_CERT_FILE"
+	EnvWinSoundRabbitMQTLSKeyFile            = "WIN_SOUND_RABBITMQ_TLS_KEY_FILE"
+	EnvWinSoundRabbitMQTLSServerName         = "WIN_SOUND_RABBITMQ_TLS_SERVER_NAME"
+	EnvWinSoundRabbitMQTLSInsecureSkipVerify = "WIN_SOUND_RABBITMQ_TLS_INSECURE_SKIP_VERIFY"
+	EnvWinSoundRabbitMQAuth                  = "WIN_SOUND_RABBITMQ_AUTH"
+
 	EnvWinSoundRabbitMQConnectionThresholdSec = "WIN_SOUND_RABBITMQ_CONNECTION_THRESHOLD_SEC"
 	EnvWinSoundRabbitMQMaxReconnectAttempts   = "WIN_SOUND_RABBITMQ_MAX_RECONNECT_ATTEMPTS"
 	EnvWinSoundRabbitMQInitialReconnectDelay  = "WIN_SOUND_RABBITMQ_INITIAL_RECONNECT_DELAY_MS"
 	EnvWinSoundRabbitMQMaxReconnectDelay      = "WIN_SOUND_RABBITMQ_MAX_RECONNECT_DELAY_MS"
 	EnvWinSoundRabbitMQPublishConfirmTimeout  = "WIN_SOUND_RABBITMQ_PUBLISH_CONFIRM_TIMEOUT_MS"
+	EnvWinSoundRabbitMQMaxInFlight            = "WIN_SOUND_RABBITMQ_MAX_IN_FLIGHT"
+	EnvWinSoundRabbitMQStartup                = "WIN_SOUND_RABBITMQ_STARTUP"
+
+	EnvWinSoundQueueCapacity     = "WIN_SOUND_QUEUE_CAPACITY"
+	EnvWinSoundQueueOverflow     = "WIN_SOUND_QUEUE_OVERFLOW"
+	EnvWinSoundQueueDrainTimeout = "WIN_SOUND_QUEUE_DRAIN_TIMEOUT_MS"
+
+	EnvWinSoundOutbox            = "WIN_SOUND_OUTBOX"
+	EnvWinSoundOutboxDir         = "WIN_SOUND_OUTBOX_DIR"
+	EnvWinSoundOutboxMaxMB       = "WIN_SOUND_OUTBOX_MAX_MB"
+	EnvWinSoundOutboxMaxAgeHours = "WIN_SOUND_OUTBOX_MAX_AGE_HOURS"
+
+	EnvWinSoundHTTPBaseURL     = "WIN_SOUND_HTTP_BASE_URL"
+	EnvWinSoundHTTPBearerToken = "WIN_SOUND_HTTP_BEARER_TOKEN"
+	EnvWinSoundHTTPUser        = "WIN_SOUND_HTTP_USER"
+	EnvWinSoundHTTPPassword    = "WIN_SOUND_HTTP_PASSWORD"
+	EnvWinSoundHTTPTimeout     = "WIN_SOUND_HTTP_TIMEOUT_MS"
+	EnvWinSoundHTTPMaxAttempts = "WIN_SOUND_HTTP_MAX_ATTEMPTS"
 )
@@ -0,0 +1,150 @@
+package schema
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/rabbitmq"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/pkg/appinfo"
+)
+
+const (
+	asyncAPIVersion     = "3.0.0"
+	amqpBindingVersion  = "0.3.0"
+	exchangeChannel     = "deviceEvents"
+	queueChannel        = "deviceEventQueue"
+	envelopeMessageName = "Envelope"
+)
+
+// asyncAPIDocument describes the default RabbitMQ topology and the messages published to it.
+// Exchange and queue are durable and not auto-deleted, as the scanner declares them.
+func asyncAPIDocument(samples []sample, messages []messageDoc) (map[string]any, error) {
+	cfg := rabbitmq.DefaultConfig()
+
+	schemas := map[string]any{}
+	componentMessages := map[string]any{}
+	channelMessages := map[string]any{}
+	var exchangeRefs, queueRefs []any
+
+	add := func(name string, message map[string]any) {
+		componentMessages[name] = message
+		channelMessages[name] = map[string]any{"$ref": "#/components/messages/" + name}
+		exchangeRefs = append(exchangeRefs, map[string]any{"$ref": "#/channels/" + exchangeChannel + "/messages/" + name})
+		queueRefs = append(queueRefs, map[string]any{"$ref": "#/channels/" + queueChannel + "/messages/" + name})
+	}
+
+	for _, doc := range messages {
+		schemas[doc.name] = doc.body
+		add(doc.name, map[string]any{
+			"name":        doc.name,
+			"title":       doc.name,
+			"summary":     doc.body["description"],
+			"contentType": "application/json",
+			"headers":     doc.headers,
+			"payload":     map[string]any{"$ref": "#/components/schemas/" + doc.name},
+			"bindings": map[string]any{
+				"amqp": map[string]any{"messageType": doc.name, "bindingVersion": amqpBindingVersion},
+			},
+		})
+	}
+
+	envelope, err := envelopeSchema(messages, func(name string) string { return "#/components/schemas/" + name })
+	if err != nil {
+		return nil, err
+	}
+	headers, err := envelopeHeaders(samples)
+	if err != nil {
+		return nil, fmt.Errorf("envelope headers: %w", err)
+	}
+	schemas[envelopeMessageName] = envelope
+	add(envelopeMessageName, map[string]any{
+		"name":        envelopeMessageName,
+		"title":       envelopeMessageName,
+		"summary":     envelope["description"],
+		"contentType": "application/json",
+		"headers":     headers,
+		"payload":     map[string]any{"$ref": "#/components/schemas/" + envelopeMessageName},
+		"bindings": map[string]any{
+			"amqp": map[string]any{"bindingVersion": amqpBindingVersion},
+		},
+	})
+
+	return map[string]any{
+		"asyncapi": asyncAPIVersion,
+		"info": map[string]any{
+			"title":   appinfo.AppName,
+			"version": appinfo.Version,
+			"description": "Sound device events the scanner publishes to RabbitMQ. The flat body is the default; " +
+				"WIN_SOUND_RABBITMQ_BODY_FORMAT=" + rabbitmq.BodyEnvelope + " publishes the Envelope, =" + rabbitmq.BodyBoth +
+				" the envelope fields and the flat fields in one body. The schemaVersion header tells them apart.",
+		},
+		"defaultContentType": "application/json",
+		"servers": map[string]any{
+			"rabbitmq": map[string]any{
+				"host":            cfg.Host + ":" + strconv.Itoa(cfg.Port),
+				"protocol":        "amqp",
+				"protocolVersion": "0.9.1",
+				"description":     "Default broker; see the WIN_SOUND_RABBITMQ_* settings.",
+			},
+		},
+		"channels": map[string]any{
+			exchangeChannel: map[string]any{
+				"address": cfg.RoutingKey,
+				"description": "Routing key the scanner publishes with. WIN_SOUND_RABBITMQ_ROUTING_KEY_TEMPLATE " +
+					"replaces it with a key per message built from {host}, {flow}, {event}, {type} and {pnpId}.",
+				"messages": channelMessages,
+				"bindings": map[string]any{
+					"amqp": map[string]any{
+						"is": "routingKey",
+						"exchange": map[string]any{
+							"name":       cfg.ExchangeName,
+							"type":       cfg.ExchangeType,
+							"durable":    true,
+							"autoDelete": false,
+							"vhost":      cfg.VHost,
+						},
+						"bindingVersion": amqpBindingVersion,
+					},
+				},
+			},
+			queueChannel: map[string]any{
+				"address":     cfg.QueueName,
+				"description": "Queue bound to the exchange with the routing key.",
+				"messages":    channelMessages,
+				"bindings": map[string]any{
+					"amqp": map[string]any{
+						"is": "queue",
+						"queue": map[string]any{
+							"name":       cfg.QueueName,
+							"durable":    true,
+							"exclusive":  false,
+							"autoDelete": false,
+							"vhost":      cfg.VHost,
+						},
+						"bindingVersion": amqpBindingVersion,
+					},
+				},
+			},
+		},
+		"operations": map[string]any{
+			"publishDeviceEvent": map[string]any{
+				"action":   "send",
+				"summary":  "The scanner publishes persistent, mandatory messages and waits for the publisher confirm.",
+				"channel":  map[string]any{"$ref": "#/channels/" + exchangeChannel},
+				"messages": exchangeRefs,
+				"bindings": map[string]any{"amqp": map[string]any{"deliveryMode": 2, "mandatory": true, "timestamp": true, "bindingVersion": amqpBindingVersion}},
+			},
+			"consumeDeviceEvent": map[string]any{
+				"action":   "receive",
+				"summary":  "Consumers such as the rmq-rest-forwarder read the events from the queue.",
+				"channel":  map[string]any{"$ref": "#/channels/" + queueChannel},
+				"messages": queueRefs,
+				"bindings": map[string]any{"amqp": map[string]any{"ack": true, "bindingVersion": amqpBindingVersion}},
+			},
+		},
+		"components": map[string]any{
+			"schemas":  schemas,
+			"messages": componentMessages,
+		},
+	}, nil
+}
@@ -0,0 +1,403 @@
+package schema
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/enqueuer"
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/rabbitmq"
+)
+
+// kinds are the event structs; every event type must fit one of them.
+var kinds = []contract.Event{
+	contract.DeviceSnapshot{},
+	contract.VolumeChange{},
+	contract.MuteChange{},
+	contract.DeviceDetached{},
+	contract.DefaultChange{},
+}
+
+// constFields are the body and header fields that are fixed per event type.
+var constFields = []string{
+	contract.FieldDeviceMessageType,
+	contract.FieldFlowType,
+	contract.FieldHTTPRequest,
+	contract.FieldSchemaVersion,
+}
+
+// volumeFields get the bounds contract.Validate checks.
+var volumeFields = []string{
+	contract.FieldRenderVolume,
+	contract.FieldCaptureVolume,
+	contract.FieldVolume,
+	contract.FieldVolumeMin,
+	contract.FieldVolumeMax,
+}
+
+var sampleTime = time.Date(2026, time.January, 2, 3, 4, 5, 0, time.UTC)
+
+// sample is an event type published with every field set (full) and with as few fields as validate (minimal).
+type sample struct {
+	event    contract.EventType
+	full     rabbitmq.Message
+	minimal  rabbitmq.Message
+	envelope rabbitmq.Message
+}
+
+// messageDoc is the generated description of the messages of one event type.
+type messageDoc struct {
+	event   contract.EventType
+	name    string
+	body    map[string]any
+	headers map[string]any
+}
+
+// recordingPublisher keeps the messages instead of sending them.
+type recordingPublisher struct {
+	messages []rabbitmq.Message
+}
+
+func (r *recordingPublisher) Publish(_ context.Context, msg rabbitmq.Message) error {
+	r.messages = append(r.messages, msg)
+	return nil
+}
+
+func (r *recordingPublisher) Close() error { return nil }
+
+// publishSamples runs a full and a minimal event of every event type through the RabbitMQ enqueuer.
+func publishSamples() ([]sample, error) {
+	keys, err := rabbitmq.NewRoutingKeys(rabbitmq.DefaultConfig())
+	if err != nil {
+		return nil, err
+	}
+	flat := &recordingPublisher{}
+	envelope := &recordingPublisher{}
+	discard := log.New(io.Discard, "", 0)
+	flatEnqueuer := rabbitmq.NewRabbitMqEnqueuerWithContext(context.Background(), flat, keys, rabbitmq.BodyFlat, discard)
+	envelopeEnqueuer := rabbitmq.NewRabbitMqEnqueuerWithContext(context.Background(), envelope, keys, rabbitmq.BodyEnvelope, discard)
+
+	var samples []sample
+	for event := contract.EventType(1); event.String() != "Unknown"; event++ {
+		i := slices.IndexFunc(kinds, func(kind contract.Event) bool { return contract.Fits(event, kind) })
+		if i < 0 {
+			return nil, fmt.Errorf("%s: no event struct fits the event type", event)
+		}
+		full := fullEvent(kinds[i])
+		if err := full.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: full sample: %w", event, err)
+		}
+
+		for _, request := range []enqueuer.Request{
+			{Timestamp: sampleTime, Event: event, Data: full},
+			{Timestamp: sampleTime, Event: event, Data: minimalEvent(full)},
+		} {
+			if err := flatEnqueuer.EnqueueRequest(request); err != nil {
+				return nil, fmt.Errorf("%s: %w", event, err)
+			}
+		}
+		if err := envelopeEnqueuer.EnqueueRequest(enqueuer.Request{Timestamp: sampleTime, Event: event, Data: full}); err != nil {
+			return nil, fmt.Errorf("%s: %w", event, err)
+		}
+
+		n := len(flat.messages)
+		samples = append(samples, sample{
+			event:    event,
+			full:     flat.messages[n-2],
+			minimal:  flat.messages[n-1],
+			envelope: envelope.messages[len(envelope.messages)-1],
+		})
+	}
+	return samples, nil
+}
+
+// fullEvent returns a valid event of the prototype's struct with every field set.
+func fullEvent(prototype contract.Event) contract.Event {
+	v := reflect.New(reflect.TypeOf(prototype)).Elem()
+	fill(v)
+	return v.Interface().(contract.Event)
+}
+
+func fill(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			v.Set(reflect.ValueOf(sampleTime))
+			return
+		}
+		for i := range v.NumField() {
+			fill(v.Field(i))
+		}
+	case reflect.String:
+		v.SetString("sample")
+	case reflect.Int:
+		v.SetInt(50)
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Pointer:
+		p := reflect.New(v.Type().Elem())
+		fill(p.Elem())
+		v.Set(p)
+	}
+}
+
+// minimalEvent clears the fields of full that Validate does not insist on, one at a time or in pairs,
+// so fields that must be set together are cleared together.
+func minimalEvent(full contract.Event) contract.Event {
+	v := reflect.New(reflect.TypeOf(full)).Elem()
+	v.Set(reflect.ValueOf(full))
+	leaves := leafFields(v.Type(), nil)
+
+	for clearOptional(v, leaves) {
+	}
+	return v.Interface().(contract.Event)
+}
+
+// clearOptional clears the first set field, or else pair of set fields, the event still validates without.
+func clearOptional(v reflect.Value, leaves [][]int) bool {
+	var set []reflect.Value
+	for _, index := range leaves {
+		if f := v.FieldByIndex(index); !f.IsZero() {
+			set = append(set, f)
+		}
+	}
+
+	var groups [][]reflect.Value
+	for i := range set {
+		groups = append(groups, []reflect.Value{set[i]})
+	}
+	for i := range set {
+		for j := i + 1; j < len(set); j++ {
+			groups = append(groups, []reflect.Value{set[i], set[j]})
+		}
+	}
+
+	for _, group := range groups {
+		saved := make([]reflect.Value, len(group))
+		for i, f := range group {
+			saved[i] = reflect.ValueOf(f.Interface())
+			f.SetZero()
+		}
+		if v.Interface().(contract.Event).Validate() == nil {
+			return true
+		}
+		for i, f := range group {
+			f.Set(saved[i])
+		}
+	}
+	return false
+}
+
+func leafFields(t reflect.Type, parent []int) [][]int {
+	var leaves [][]int
+	for i := range t.NumField() {
+		index := append(slices.Clone(parent), i)
+		if f := t.Field(i).Type; f.Kind() == reflect.Struct && f != reflect.TypeOf(time.Time{}) {
+			leaves = append(leaves, leafFields(f, index)...)
+			continue
+		}
+		leaves = append(leaves, index)
+	}
+	return leaves
+}
+
+func newMessageDoc(s sample) (messageDoc, error) {
+	full, err := decodeBody(s.full.Body)
+	if err != nil {
+		return messageDoc{}, err
+	}
+	minimal, err := decodeBody(s.minimal.Body)
+	if err != nil {
+		return messageDoc{}, err
+	}
+	body, err := objectSchema([]map[string]any{full}, []map[string]any{minimal})
+	if err != nil {
+		return messageDoc{}, fmt.Errorf("body: %w", err)
+	}
+	body["title"] = s.event.String()
+	body["description"] = contract.EventDescriptions[s.event]
+	if body["description"] == "" {
+		return messageDoc{}, errors.New("no entry in contract.EventDescriptions")
+	}
+
+	headers, err := objectSchema([]map[string]any{s.full.Headers}, []map[string]any{s.minimal.Headers})
+	if err != nil {
+		return messageDoc{}, fmt.Errorf("headers: %w", err)
+	}
+	if s.full.Type != s.event.String() {
+		return messageDoc{}, fmt.Errorf("message type %q differs from the event type name", s.full.Type)
+	}
+	return messageDoc{event: s.event, name: s.event.String(), body: body, headers: headers}, nil
+}
+
+func decodeBody(body []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var fields map[string]any
+	if err := dec.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("decode body: %w", err)
+	}
+	return fields, nil
+}
+
+// objectSchema describes the objects: a property for every key of a full object,
+// required when every minimal object has it, const when it is a constField with a single value.
+func objectSchema(full, minimal []map[string]any) (map[string]any, error) {
+	properties := map[string]any{}
+	for _, object := range full {
+		for key, value := range object {
+			if _, ok := properties[key]; ok {
+				continue
+			}
+			p, err := propertySchema(key, value)
+			if err != nil {
+				return nil, err
+			}
+			properties[key] = p
+		}
+	}
+
+	for key, p := range properties {
+		if !slices.Contains(constFields, key) {
+			continue
+		}
+		values := map[string]bool{}
+		for _, object := range slices.Concat(full, minimal) {
+			values[fmt.Sprint(object[key])] = true
+		}
+		if len(values) == 1 {
+			p.(map[string]any)["const"] = full[0][key]
+		}
+	}
+
+	required := []string{}
+	for key := range properties {
+		if !slices.ContainsFunc(minimal, func(object map[string]any) bool { _, ok := object[key]; return !ok }) {
+			required = append(required, key)
+		}
+	}
+	sort.Strings(required)
+
+	return map[string]any{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}, nil
+}
+
+func propertySchema(key string, value any) (map[string]any, error) {
+	description, ok := contract.FieldDescriptions[key]
+	if !ok {
+		return nil, fmt.Errorf("field %q has no entry in contract.FieldDescriptions", key)
+	}
+	p := map[string]any{"description": description}
+
+	switch v := value.(type) {
+	case json.Number:
+		if _, err := v.Int64(); err != nil {
+			return nil, fmt.Errorf("field %q: unsupported number %s", key, v)
+		}
+		p["type"] = "integer"
+		if slices.Contains(volumeFields, key) {
+			p["minimum"] = 0
+			p["maximum"] = contract.MaxVolume
+		}
+	case int32:
+		p["type"] = "integer"
+	case bool:
+		p["type"] = "boolean"
+	case string:
+		p["type"] = "string"
+		if key == contract.FieldUpdateDate {
+			p["format"] = "date-time"
+		}
+	default:
+		return nil, fmt.Errorf("field %q: unsupported value %T", key, value)
+	}
+	return p, nil
+}
+
+// envelopeSchema describes contract.Envelope with the payload being one of the message bodies, referenced by ref.
+func envelopeSchema(messages []messageDoc, ref func(name string) string) (map[string]any, error) {
+	payload := make([]any, len(messages))
+	names := make([]string, len(messages))
+	for i, doc := range messages {
+		payload[i] = map[string]any{"$ref": ref(doc.name)}
+		names[i] = doc.name
+	}
+
+	schema, err := structSchema(reflect.TypeOf(contract.Envelope{}), "")
+	if err != nil {
+		return nil, err
+	}
+	properties := schema["properties"].(map[string]any)
+	properties[contract.FieldSchemaVersion].(map[string]any)["const"] = contract.SchemaVersionEnvelope
+	properties[contract.FieldEventType].(map[string]any)["enum"] = names
+	properties[contract.FieldPayload].(map[string]any)["oneOf"] = payload
+
+	schema["title"] = "Envelope"
+	schema["description"] = fmt.Sprintf("Message body with %s=%s: the event metadata around the flat body.",
+		"WIN_SOUND_RABBITMQ_BODY_FORMAT", rabbitmq.BodyEnvelope)
+	return schema, nil
+}
+
+// structSchema describes a struct by its json tags; fields without omitempty are required.
+func structSchema(t reflect.Type, prefix string) (map[string]any, error) {
+	properties := map[string]any{}
+	required := []string{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, options, _ := strings.Cut(f.Tag.Get("json"), ",")
+		description, ok := contract.FieldDescriptions[prefix+name]
+		if !ok {
+			return nil, fmt.Errorf("field %q has no entry in contract.FieldDescriptions", prefix+name)
+		}
+
+		var p map[string]any
+		switch {
+		case f.Type == reflect.TypeOf(time.Time{}):
+			p = map[string]any{"type": "string", "format": "date-time"}
+		case f.Type.Kind() == reflect.Struct:
+			nested, err := structSchema(f.Type, name+".")
+			if err != nil {
+				return nil, err
+			}
+			p = nested
+		case f.Type.Kind() == reflect.Map:
+			p = map[string]any{"type": "object"}
+		case f.Type.Kind() == reflect.String:
+			p = map[string]any{"type": "string"}
+		case f.Type.Kind() == reflect.Int:
+			p = map[string]any{"type": "integer"}
+		default:
+			return nil, fmt.Errorf("field %q: unsupported type %s", prefix+name, f.Type)
+		}
+		p["description"] = description
+		properties[name] = p
+
+		if options != "omitempty" {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+	return map[string]any{"type": "object", "properties": properties, "required": required}, nil
+}
+
+// envelopeHeaders describes the headers of envelope messages across all event types.
+func envelopeHeaders(samples []sample) (map[string]any, error) {
+	headers := make([]map[string]any, len(samples))
+	for i, s := range samples {
+		headers[i] = s.envelope.Headers
+	}
+	return objectSchema(headers, headers)
+}
@@ -0,0 +1,162 @@
+// Package schema generates the JSON Schema and AsyncAPI documents of the RabbitMQ messages.
+// The documents are derived from sample events run through the RabbitMQ enqueuer, so they follow the code;
+// TestGeneratedDocumentsAreUpToDate fails when the committed copies in docs/schema are stale.
+package schema
+
+//go:generate go run ../../cmd/win-sound-scanner schema -out ../../docs/schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+	// AsyncAPIFile, EnvelopeFile and MessagesDir name the documents below the output directory.
+	AsyncAPIFile = "asyncapi.json"
+	EnvelopeFile = "envelope.schema.json"
+	MessagesDir  = "messages"
+)
+
+// DefaultDir is where the documents are committed, relative to the repository root.
+const DefaultDir = "docs/schema"
+
+// Generate returns the documents keyed by their slash-separated path below the output directory.
+func Generate() (map[string][]byte, error) {
+	samples, err := publishSamples()
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]messageDoc, 0, len(samples))
+	for _, s := range samples {
+		doc, err := newMessageDoc(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.event, err)
+		}
+		messages = append(messages, doc)
+	}
+
+	docs := make(map[string][]byte, len(messages)+2)
+	for _, doc := range messages {
+		if docs[messageFile(doc.name)], err = encode(standalone(doc.body)); err != nil {
+			return nil, err
+		}
+	}
+
+	envelope, err := envelopeSchema(messages, messageFile)
+	if err != nil {
+		return nil, err
+	}
+	if docs[EnvelopeFile], err = encode(standalone(envelope)); err != nil {
+		return nil, err
+	}
+
+	asyncAPI, err := asyncAPIDocument(samples, messages)
+	if err != nil {
+		return nil, err
+	}
+	if docs[AsyncAPIFile], err = encode(asyncAPI); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// Write generates the documents into dir and removes generated files that are no longer produced.
+func Write(dir string) error {
+	docs, err := Generate()
+	if err != nil {
+		return err
+	}
+
+	for name, content := range docs {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, content, 0o644); err != nil {
+			return err
+		}
+	}
+
+	stale, err := Stale(dir, docs)
+	if err != nil {
+		return err
+	}
+	for _, name := range stale {
+		if _, ok := docs[name]; !ok {
+			if err := os.Remove(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Stale lists the documents in dir that differ from docs, are missing, or are JSON files docs does not have.
+func Stale(dir string, docs map[string][]byte) ([]string, error) {
+	var stale []string
+	for name, want := range docs {
+		got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if !bytes.Equal(got, want) {
+			stale = append(stale, name)
+		}
+	}
+
+	err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && file == dir {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || filepath.Ext(file) != ".json" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		if _, ok := docs[filepath.ToSlash(rel)]; !ok {
+			stale = append(stale, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(stale)
+	return stale, nil
+}
+
+func messageFile(name string) string {
+	return MessagesDir + "/" + name + ".schema.json"
+}
+
+// standalone returns schema as a document of its own, with the dialect it is written in.
+func standalone(schema map[string]any) map[string]any {
+	doc := maps.Clone(schema)
+	doc["$schema"] = jsonSchemaDraft
+	return doc
+}
+
+func encode(doc map[string]any) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
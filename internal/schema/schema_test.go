@@ -0,0 +1,51 @@
+package schema
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/collect-sound-devices/win-sound-dev-go-bridge/internal/contract"
+)
+
+func TestGeneratedDocumentsAreUpToDate(t *testing.T) {
+	docs, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stale, err := Stale(filepath.Join("..", "..", filepath.FromSlash(DefaultDir)), docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) > 0 {
+		t.Fatalf("%s is out of date with the contract (%v); run go generate ./internal/schema", DefaultDir, stale)
+	}
+}
+
+func TestMessageSchema_OptionalFieldsAreNotRequired(t *testing.T) {
+	docs, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var schema struct {
+		Properties map[string]any `json:"properties"`
+		Required   []string       `json:"required"`
+	}
+	if err := json.Unmarshal(docs[messageFile(contract.EventTypeRenderVolumeChanged.String())], &schema); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{contract.FieldVolumeMin, contract.FieldVolumeMax, contract.FieldPnpID} {
+		if _, ok := schema.Properties[field]; !ok {
+			t.Fatalf("expected a %s property", field)
+		}
+		if slices.Contains(schema.Required, field) {
+			t.Fatalf("expected %s to be optional, required: %v", field, schema.Required)
+		}
+	}
+	if !slices.Contains(schema.Required, contract.FieldVolume) {
+		t.Fatalf("expected %s to be required, required: %v", contract.FieldVolume, schema.Required)
+	}
+}